@@ -3,11 +3,15 @@ package main
 import (
 	"log"
 
+	"github.com/damirbeybitov/todo_project/internal/config"
 	"github.com/damirbeybitov/todo_project/internal/handlers"
 	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/damirbeybitov/todo_project/internal/redis"
 	"github.com/damirbeybitov/todo_project/internal/repository"
 	"github.com/damirbeybitov/todo_project/internal/service"
+	token "github.com/damirbeybitov/todo_project/internal/token"
 	pbAuth "github.com/damirbeybitov/todo_project/proto/auth"
+	pbProject "github.com/damirbeybitov/todo_project/proto/project"
 	pbTask "github.com/damirbeybitov/todo_project/proto/task"
 	pbUser "github.com/damirbeybitov/todo_project/proto/user"
 	"google.golang.org/grpc"
@@ -51,13 +55,38 @@ func main() {
 
 	taskClient := pbTask.NewTaskServiceClient(taskConn)
 
+	projectConn, err := grpc.Dial("localhost:50054", grpc.WithInsecure())
+	if err != nil {
+		log.Fatalf("could not connect: %v", err)
+	}
+	defer projectConn.Close()
+
+	projectClient := pbProject.NewProjectServiceClient(projectConn)
+
 	microServiceClients := models.MicroServiceClients{
-		UserClient: userClient,
-		AuthClient: authClient,
-		TaskClient: taskClient,
+		UserClient:    userClient,
+		AuthClient:    authClient,
+		TaskClient:    taskClient,
+		ProjectClient: projectClient,
+	}
+
+	myConfig, err := config.NewConfig("config.json")
+	if err != nil {
+		log.Fatalf("failed to read config: %v", err)
+	}
+
+	// Шлюз проверяет токены ключами из конфигурации и публикует их открытые части
+	tokenKeys, err := token.LoadKeys(myConfig.TokenKeys)
+	if err != nil {
+		log.Fatalf("failed to load token keys: %v", err)
 	}
+	token.SetKeys(tokenKeys)
+
+	// Отозванные токены проверяются по общему списку в Redis
+	redisClient := redis.NewClient("localhost:6379", "", 0)
+	defer redisClient.Close()
 
-	repo := repository.NewRepository(microServiceClients)
+	repo := repository.NewRepository(microServiceClients, token.NewDenylist(redisClient))
 
 	handler := handlers.NewHandler(repo)
 
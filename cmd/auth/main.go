@@ -8,6 +8,8 @@ import (
 	auth "github.com/damirbeybitov/todo_project/internal/auth/service"
 	"github.com/damirbeybitov/todo_project/internal/config"
 	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/redis"
+	token "github.com/damirbeybitov/todo_project/internal/token"
 	pb "github.com/damirbeybitov/todo_project/proto/auth"
 	_ "github.com/go-sql-driver/mysql"
 	"google.golang.org/grpc"
@@ -25,12 +27,23 @@ func main() {
 		log.ErrorLogger.Fatalf("failed to read config: %v", err)
 	}
 
+	// Ключи подписи токенов задаются в конфигурации
+	tokenKeys, err := token.LoadKeys(myConfig.TokenKeys)
+	if err != nil {
+		log.ErrorLogger.Fatalf("failed to load token keys: %v", err)
+	}
+	token.SetKeys(tokenKeys)
+
 	db, err := sql.Open("mysql", myConfig.SqlConnection)
 	if err != nil {
 		log.ErrorLogger.Fatalf("failed to connect to database: %v", err)
 	}
 
-	repo := repository.NewRepository(db)
+	// Refresh token хранятся в Redis, чтобы их можно было отозвать
+	redisClient := redis.NewClient("localhost:6379", "", 0)
+	defer redisClient.Close()
+
+	repo := repository.NewRepository(db, redisClient)
 
 	server := grpc.NewServer()
 	authService := auth.NewAuthService(repo) // Создание экземпляра сервиса пользователей
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"net"
+	"time"
 
 	"github.com/damirbeybitov/todo_project/internal/config"
 	"github.com/damirbeybitov/todo_project/internal/log"
@@ -36,8 +38,26 @@ func main() {
 
 	repo := repository.NewRepository(db, redisClient)
 
+	workflow, err := task.NewWorkflow(myConfig.TaskTransitions)
+	if err != nil {
+		log.ErrorLogger.Fatalf("failed to read task transitions: %v", err)
+	}
+
+	// Повторяющиеся задачи создаются в фоне, пока сервис работает
+	scheduler := task.NewScheduler(repo, time.Duration(myConfig.RecurrenceCheckSeconds)*time.Second)
+	go scheduler.Run(context.Background())
+
+	// Задачи, пролежавшие в корзине дольше срока хранения, удаляются окончательно
+	cleaner := task.NewTrashCleaner(repo, time.Duration(myConfig.TrashRetentionDays)*24*time.Hour)
+	go cleaner.Run(context.Background())
+
+	// Доставки подписок отправляются в фоне и повторяются при ошибках
+	webhookTargets := task.NewWebhookTargets(myConfig.WebhookAllowedHosts)
+	dispatcher := task.NewWebhookDispatcher(repo, time.Duration(myConfig.WebhookDispatchSeconds)*time.Second, webhookTargets)
+	go dispatcher.Run(context.Background())
+
 	server := grpc.NewServer()
-	taskService := task.NewTaskService(repo)
+	taskService := task.NewTaskService(repo, workflow, webhookTargets)
 	pb.RegisterTaskServiceServer(server, taskService)
 
 	log.InfoLogger.Println("Task manager service is running on port 50053")
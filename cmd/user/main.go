@@ -6,6 +6,8 @@ import (
 
 	"github.com/damirbeybitov/todo_project/internal/config"
 	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/redis"
+	token "github.com/damirbeybitov/todo_project/internal/token"
 	"github.com/damirbeybitov/todo_project/internal/user/repository"
 	user "github.com/damirbeybitov/todo_project/internal/user/serivice"
 	pb "github.com/damirbeybitov/todo_project/proto/user"
@@ -33,7 +35,11 @@ func main() {
 	repo := repository.NewRepository(db)
 
 	server := grpc.NewServer()
-	userService := user.NewUserService(repo) // Создание экземпляра сервиса пользователей
+	// Токены удаленных пользователей отзываются через общий список в Redis
+	redisClient := redis.NewClient("localhost:6379", "", 0)
+	defer redisClient.Close()
+
+	userService := user.NewUserService(repo, token.NewDenylist(redisClient)) // Создание экземпляра сервиса пользователей
 	pb.RegisterUserServiceServer(server, userService)
 
 	log.InfoLogger.Println("User service is running on port 50051")
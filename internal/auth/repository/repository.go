@@ -1,25 +1,72 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/damirbeybitov/todo_project/internal/log"
 	token "github.com/damirbeybitov/todo_project/internal/token"
+	"github.com/redis/go-redis/v9"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrTokenReused is returned when a refresh token is used a second time; its
+// whole family is revoked then. Revoked and unknown refresh tokens fail with
+// token.ErrTokenRevoked.
+var ErrTokenReused = errors.New("refresh token reused")
+
+// ErrAccountDisabled is returned when a disabled user logs in or refreshes
+// a token.
+var ErrAccountDisabled = errors.New("account disabled")
+
+const (
+	// refreshTokenKey holds the state of a refresh token by its id: active,
+	// or used once it was rotated.
+	refreshTokenKey = "refresh-token:%s"
+	// refreshFamilyKey holds the user of a token family while it is not revoked.
+	refreshFamilyKey = "refresh-family:%s"
+	// refreshFamiliesKey is the set of the token families of a user.
+	refreshFamiliesKey = "refresh-families:%s"
+
+	tokenActive = "active"
+	tokenUsed   = "used"
+)
+
+// rotateScript marks an active refresh token of a live family as used. A
+// token used before revokes its family.
+var rotateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return 'revoked'
+end
+local state = redis.call('GET', KEYS[1])
+if not state then
+	return 'revoked'
+end
+if state == '` + tokenUsed + `' then
+	redis.call('DEL', KEYS[2])
+	return 'reused'
+end
+redis.call('SET', KEYS[1], '` + tokenUsed + `', 'KEEPTTL')
+return 'ok'
+`)
+
 type Repository struct {
-	db *sql.DB
+	db       *sql.DB
+	redis    *redis.Client
+	denylist *token.Denylist
 }
 
-func NewRepository (db *sql.DB) *Repository{
-	return &Repository{db: db}
+func NewRepository (db *sql.DB, redis *redis.Client) *Repository{
+	return &Repository{db: db, redis: redis, denylist: token.NewDenylist(redis)}
 }
 
 func (r *Repository) CheckPassword(username string, password string) error {
 	var storedPassword string
-	err := r.db.QueryRow("SELECT password FROM users WHERE username = ?", username).Scan(&storedPassword)
+	var disabled bool
+	err := r.db.QueryRow("SELECT password, disabled FROM users WHERE username = ?", username).Scan(&storedPassword, &disabled)
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to retrieve stored password: %v", err)
 		return err
@@ -31,20 +78,201 @@ func (r *Repository) CheckPassword(username string, password string) error {
 		return fmt.Errorf("invalid password")
 	}
 
+	// Only the right password tells that the account is disabled
+	if disabled {
+		log.ErrorLogger.Printf("Disabled user tried to log in: %s", username)
+		return ErrAccountDisabled
+	}
+
 	return nil
 }
 
+// GenerateTokens returns an access token and the refresh token of a new
+// token family of the user.
 func (r *Repository) GenerateTokens(username string) (string, string, error) {
-	accessToken, err := token.GenerateAccessToken(username)
+	generation, err := r.denylist.Generation(username)
+	if err != nil {
+		return "", "", err
+	}
+	return r.issueTokens(username, "", generation)
+}
+
+// RotateRefreshToken exchanges a refresh token for a new access token and
+// refresh token of the same family. Every refresh token is accepted once:
+// presenting it again revokes the family, so a stolen token stops working for
+// the thief and the user alike.
+func (r *Repository) RotateRefreshToken(refreshToken string) (string, string, error) {
+	claims, err := token.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return "", "", err
+	}
+	if err := r.denylist.Check(claims.StandardClaims, claims.Generation); err != nil {
+		return "", "", err
+	}
+
+	keys := []string{fmt.Sprintf(refreshTokenKey, claims.Id), fmt.Sprintf(refreshFamilyKey, claims.Family)}
+	result, err := rotateScript.Run(context.Background(), r.redis, keys).Text()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to rotate refresh token: %v", err)
+		return "", "", err
+	}
+
+	switch result {
+	case "revoked":
+		log.ErrorLogger.Printf("Refresh token of a revoked family used by user: %s", claims.Subject)
+		return "", "", token.ErrTokenRevoked
+	case "reused":
+		log.ErrorLogger.Printf("Refresh token reused, family %s of user %s revoked", claims.Family, claims.Subject)
+		return "", "", ErrTokenReused
+	}
+
+	// The new tokens keep the generation, so a revocation racing with the
+	// rotation revokes them too
+	return r.issueTokens(claims.Subject, claims.Family, claims.Generation)
+}
+
+// RevokeRefreshToken revokes the family of a refresh token. Revoking a family
+// twice is fine.
+func (r *Repository) RevokeRefreshToken(refreshToken string) error {
+	claims, err := token.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, fmt.Sprintf(refreshFamilyKey, claims.Family))
+		pipe.SRem(ctx, fmt.Sprintf(refreshFamiliesKey, claims.Subject), claims.Family)
+		return nil
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to revoke refresh token: %v", err)
+		return err
+	}
+
+	log.InfoLogger.Printf("Refresh token family revoked for user: %s", claims.Subject)
+	return nil
+}
+
+// RevokeAccessToken revokes an access token until it expires. Tokens that
+// are no longer valid need no revoking.
+func (r *Repository) RevokeAccessToken(accessToken string) error {
+	claims, err := token.ParseAccessToken(accessToken)
+	if err != nil {
+		return nil
+	}
+	return r.denylist.DenyToken(claims.StandardClaims)
+}
+
+// RevokeAllTokens revokes every token family of the user and every access
+// token issued to the user up to now.
+func (r *Repository) RevokeAllTokens(username string) error {
+	ctx := context.Background()
+	familiesKey := fmt.Sprintf(refreshFamiliesKey, username)
+	families, err := r.redis.SMembers(ctx, familiesKey).Result()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get refresh token families: %v", err)
+		return err
+	}
+
+	keys := []string{familiesKey}
+	for _, family := range families {
+		keys = append(keys, fmt.Sprintf(refreshFamilyKey, family))
+	}
+	if err := r.redis.Del(ctx, keys...).Err(); err != nil {
+		log.ErrorLogger.Printf("Failed to revoke refresh tokens: %v", err)
+		return err
+	}
+
+	if err := r.denylist.DenyUserTokens(username); err != nil {
+		return err
+	}
+
+	log.InfoLogger.Printf("All tokens revoked for user: %s", username)
+	return nil
+}
+
+// issueTokens returns an access token and a refresh token in the family and
+// the token generation, and keeps the family alive as long as its newest
+// refresh token.
+func (r *Repository) issueTokens(username string, family string, generation int64) (string, string, error) {
+	identity, err := r.userIdentity(username)
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := token.GenerateAccessToken(identity, generation)
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to generate access token: %v", err)
 		return "", "", err
 	}
-	refreshToken, err := token.GenerateRefreshToken(username)
+	refreshToken, claims, err := token.GenerateRefreshToken(username, family, generation)
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to generate refresh token: %v", err)
 		return "", "", err
 	}
 
+	ctx := context.Background()
+	ttl := time.Until(time.Unix(claims.ExpiresAt, 0))
+	familiesKey := fmt.Sprintf(refreshFamiliesKey, username)
+	_, err = r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, fmt.Sprintf(refreshTokenKey, claims.Id), tokenActive, ttl)
+		if family == "" {
+			pipe.Set(ctx, fmt.Sprintf(refreshFamilyKey, claims.Family), username, ttl)
+		} else {
+			// A family revoked since the rotation stays revoked
+			pipe.SetXX(ctx, fmt.Sprintf(refreshFamilyKey, claims.Family), username, ttl)
+		}
+		pipe.SAdd(ctx, familiesKey, claims.Family)
+		pipe.Expire(ctx, familiesKey, ttl)
+		return nil
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to store refresh token: %v", err)
+		return "", "", err
+	}
+
 	return accessToken, refreshToken, nil
-}
\ No newline at end of file
+}
+
+// userIdentity returns the id, roles and scopes of the user. Tokens of users
+// deleted since they logged in are revoked, disabled users get none.
+func (r *Repository) userIdentity(username string) (token.Identity, error) {
+	identity := token.Identity{Username: username, Roles: []string{token.RoleUser}}
+	var disabled bool
+	err := r.db.QueryRow("SELECT id, disabled FROM users WHERE username = ?", username).Scan(&identity.UserId, &disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.ErrorLogger.Printf("Tokens requested for unknown user: %s", username)
+		return token.Identity{}, token.ErrTokenRevoked
+	}
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get user: %v", err)
+		return token.Identity{}, err
+	}
+	if disabled {
+		log.ErrorLogger.Printf("Tokens requested for disabled user: %s", username)
+		return token.Identity{}, ErrAccountDisabled
+	}
+
+	rows, err := r.db.Query("SELECT role FROM user_roles WHERE user_id = ? ORDER BY role", identity.UserId)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get user roles: %v", err)
+		return token.Identity{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			log.ErrorLogger.Printf("Failed to scan user role: %v", err)
+			return token.Identity{}, err
+		}
+		identity.Roles = append(identity.Roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Failed to get user roles: %v", err)
+		return token.Identity{}, err
+	}
+
+	identity.Scopes = token.ScopesForRoles(identity.Roles)
+	return identity, nil
+}
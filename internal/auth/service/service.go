@@ -2,11 +2,14 @@ package auth
 
 import (
 	"context"
+	"errors"
 
 	"github.com/damirbeybitov/todo_project/internal/auth/repository"
 	"github.com/damirbeybitov/todo_project/internal/log"
 	token "github.com/damirbeybitov/todo_project/internal/token"
 	authPB "github.com/damirbeybitov/todo_project/proto/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // AuthService представляет сервис аутентификации.
@@ -26,12 +29,15 @@ func (s *AuthService) Authenticate(ctx context.Context, req *authPB.Authenticate
 
 	// Реализация аутентификации пользователя
 	if err := s.repo.CheckPassword(req.Username, req.Password); err != nil {
+		if errors.Is(err, repository.ErrAccountDisabled) {
+			return nil, tokenError(err)
+		}
 		return nil, err
 	}
 
 	accessToken, refreshToken, err := s.repo.GenerateTokens(req.Username)
 	if err != nil {
-		return nil, err
+		return nil, tokenError(err)
 	}
 
 	// В данном примере просто возвращается фиктивный access token и refresh token.
@@ -42,17 +48,61 @@ func (s *AuthService) Authenticate(ctx context.Context, req *authPB.Authenticate
 }
 
 // RefreshToken реализует метод обновления токена в рамках интерфейса AuthServiceServer.
+// Refresh token действует один раз: в ответе выдается новый.
 func (s *AuthService) RefreshToken(ctx context.Context, req *authPB.RefreshTokenRequest) (*authPB.RefreshTokenResponse, error) {
 	log.InfoLogger.Println("Refreshing token")
 
-	// Реализация обновления токена
-	accessToken, err := token.RefreshToken(req.RefreshToken)
+	accessToken, refreshToken, err := s.repo.RotateRefreshToken(req.RefreshToken)
 	if err != nil {
-		return nil, err
+		return nil, tokenError(err)
 	}
 
-	// В данном примере просто возвращается фиктивный access token.
 	return &authPB.RefreshTokenResponse{
-		AccessToken: accessToken,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
 	}, nil
 }
+
+// Logout реализует метод выхода: отзывает refresh token вместе со всеми
+// токенами, полученными обновлением от того же входа, и переданный access token.
+func (s *AuthService) Logout(ctx context.Context, req *authPB.LogoutRequest) (*authPB.LogoutResponse, error) {
+	log.InfoLogger.Println("Logging out")
+
+	if err := s.repo.RevokeRefreshToken(req.RefreshToken); err != nil {
+		return nil, tokenError(err)
+	}
+	if req.AccessToken != "" {
+		if err := s.repo.RevokeAccessToken(req.AccessToken); err != nil {
+			return nil, tokenError(err)
+		}
+	}
+
+	return &authPB.LogoutResponse{Message: "Logged out successfully"}, nil
+}
+
+// LogoutAll реализует метод выхода на всех устройствах: отзывает все токены пользователя.
+func (s *AuthService) LogoutAll(ctx context.Context, req *authPB.LogoutAllRequest) (*authPB.LogoutAllResponse, error) {
+	log.InfoLogger.Printf("Logging out everywhere for user: %s", req.Username)
+
+	if req.Username == "" {
+		return nil, status.Error(codes.InvalidArgument, "username is required")
+	}
+
+	if err := s.repo.RevokeAllTokens(req.Username); err != nil {
+		return nil, tokenError(err)
+	}
+
+	return &authPB.LogoutAllResponse{Message: "Logged out on all devices successfully"}, nil
+}
+
+// tokenError переводит ошибку проверки токена в статус gRPC. Отключенным
+// пользователям токены не выдаются.
+func tokenError(err error) error {
+	if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenRevoked) || errors.Is(err, repository.ErrTokenReused) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if errors.Is(err, repository.ErrAccountDisabled) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
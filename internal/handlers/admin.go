@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/gorilla/mux"
+
+	pbUser "github.com/damirbeybitov/todo_project/proto/user"
+)
+
+// @Summary List users
+// @Tags admin
+// @Description list the users with their granted roles by ID. Admins only
+// @ID admin-list-users
+// @Produce json
+// @Security ApiKeyAuth
+// @Param page_size query int false "Page size, 50 by default"
+// @Param page_token query string false "Token of the page to retrieve"
+// @Success 200 {object} models.ListUsersResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal server error"
+// @Router /admin/users [get]
+func (h *Handler) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	req := &pbUser.ListUsersRequest{PageToken: r.URL.Query().Get("page_token")}
+	if pageSize := r.URL.Query().Get("page_size"); pageSize != "" {
+		size, err := strconv.ParseInt(pageSize, 10, 32)
+		if err != nil || size < 0 {
+			log.ErrorLogger.Printf("Invalid page size: %s", pageSize)
+			http.Error(w, "Invalid query parameters", http.StatusBadRequest)
+			return
+		}
+		req.PageSize = int32(size)
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.UserClient.ListUsers(r.Context(), req)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to list users: %v", err)
+		http.Error(w, "Failed to list users", httpStatus(err))
+		return
+	}
+
+	response := models.ListUsersResponse{
+		Users:         []models.UserAccount{},
+		NextPageToken: pbResponse.NextPageToken,
+	}
+	for _, user := range pbResponse.Users {
+		response.Users = append(response.Users, models.UserAccountFromPB(user))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("List users endpoint done successfully")
+}
+
+// @Summary Disable user
+// @Tags admin
+// @Description disable an account: the user can no longer log in and every token issued to the user is revoked. Admins only, and not on their own account
+// @ID admin-disable-user
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.SetUserDisabledResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 409 {string} string "Cannot disable own account"
+// @Failure 500 {string} string "Internal server error"
+// @Router /admin/users/{id}/disable [post]
+func (h *Handler) DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, true)
+}
+
+// @Summary Enable user
+// @Tags admin
+// @Description enable a disabled account. Admins only
+// @ID admin-enable-user
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.SetUserDisabledResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /admin/users/{id}/enable [post]
+func (h *Handler) EnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, false)
+}
+
+func (h *Handler) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid user ID: %v", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	callerId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// An admin disabling their own account would lock every admin out
+	if disabled && userID == callerId {
+		log.ErrorLogger.Printf("Admin %d tried to disable own account", callerId)
+		http.Error(w, "Cannot disable own account", http.StatusConflict)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.UserClient.SetUserDisabled(r.Context(), &pbUser.SetUserDisabledRequest{
+		Id:       userID,
+		Disabled: disabled,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to set user disabled: %v", err)
+		http.Error(w, "Failed to update user", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.SetUserDisabledResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Set user disabled endpoint done successfully")
+}
+
+// @Summary Reset password
+// @Tags admin
+// @Description set a new password of a user; every token issued to the user is revoked. Admins only
+// @ID admin-reset-password
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param body body models.ResetPasswordRequest true "New password"
+// @Success 200 {object} models.ResetPasswordResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /admin/users/{id}/reset-password [post]
+func (h *Handler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid user ID: %v", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Password == "" {
+		log.ErrorLogger.Print("Missing required fields")
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.UserClient.ResetPassword(r.Context(), &pbUser.ResetPasswordRequest{
+		Id:       userID,
+		Password: req.Password,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to reset password: %v", err)
+		http.Error(w, "Failed to reset password", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.ResetPasswordResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Reset password endpoint done successfully")
+}
+
+// @Summary Get user tasks
+// @Tags admin
+// @Description retrieve a page of the tasks of any user, with the filters of get-tasks. Admins only
+// @ID admin-get-user-tasks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param page_size query int false "Page size, 50 by default"
+// @Param page_token query string false "Token of the page to retrieve"
+// @Param status query string false "Filter by status" Enums(todo, in_progress, blocked, done, cancelled)
+// @Param q query string false "Search in title and description"
+// @Param sort_by query string false "Sort field" Enums(id, title, status, due_at, priority, created_at, updated_at)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param project_id query int false "Filter by project"
+// @Param tags query string false "Comma-separated tag names, tasks must have all of them"
+// @Success 200 {object} models.GetTasksResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal server error"
+// @Router /admin/users/{id}/tasks [get]
+func (h *Handler) GetUserTasksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || userID <= 0 {
+		log.ErrorLogger.Printf("Invalid user ID: %s", mux.Vars(r)["id"])
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	req, err := parseGetTasksQuery(r)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid query parameters: %v", err)
+		http.Error(w, "Invalid query parameters", http.StatusBadRequest)
+		return
+	}
+	req.UserId = userID
+
+	pbTasks, err := h.repo.MicroServiceClients.TaskClient.GetTasks(r.Context(), req)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get user tasks: %v", err)
+		http.Error(w, "Failed to get tasks", httpStatus(err))
+		return
+	}
+
+	response := models.GetTasksResponse{
+		Tasks:         []models.Task{},
+		NextPageToken: pbTasks.NextPageToken,
+	}
+	for _, task := range pbTasks.GetTasks() {
+		response.Tasks = append(response.Tasks, models.TaskFromPB(task))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get user tasks endpoint done successfully")
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pbTask "github.com/damirbeybitov/todo_project/proto/task"
+)
+
+// @Summary Batch create tasks
+// @Tags task
+// @Description create up to 100 tasks in one transaction, a task that cannot be created fails on its own
+// @ID batch-create-tasks
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.BatchCreateTasksRequest true "Tasks to create"
+// @Success 200 {object} models.BatchTasksResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/batch/create [post]
+func (h *Handler) BatchCreateTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.BatchCreateTasksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbReq := &pbTask.BatchCreateTasksRequest{UserId: userId}
+	for i, item := range req.Tasks {
+		if item.Title == "" || item.Description == "" {
+			log.ErrorLogger.Printf("Missing required fields in task %d", i)
+			http.Error(w, fmt.Sprintf("Missing required fields in task %d", i), http.StatusBadRequest)
+			return
+		}
+		if _, ok := models.PriorityToPB(item.Priority); !ok {
+			log.ErrorLogger.Printf("Invalid priority in task %d: %s", i, item.Priority)
+			http.Error(w, fmt.Sprintf("Invalid priority in task %d", i), http.StatusBadRequest)
+			return
+		}
+
+		pbReq.Tasks = append(pbReq.Tasks, models.TaskToPB(models.Task{
+			Title:       item.Title,
+			Description: item.Description,
+			UserId:      userId,
+			DueAt:       item.DueAt,
+			Priority:    item.Priority,
+			ParentId:    item.ParentId,
+			ProjectId:   item.ProjectId,
+			Recurrence:  item.Recurrence,
+		}))
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.BatchCreateTasks(r.Context(), pbReq)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to create tasks: %v", err)
+		http.Error(w, "Failed to create tasks", httpStatus(err))
+		return
+	}
+
+	writeBatchResults(w, pbResponse.Results)
+	log.InfoLogger.Print("Batch create tasks endpoint done successfully")
+}
+
+// @Summary Batch update tasks
+// @Tags task
+// @Description update up to 100 tasks in one transaction, a task that cannot be updated fails on its own
+// @ID batch-update-tasks
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.BatchUpdateTasksRequest true "Tasks to update"
+// @Success 200 {object} models.BatchTasksResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/batch/update [put]
+func (h *Handler) BatchUpdateTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.BatchUpdateTasksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbReq := &pbTask.BatchUpdateTasksRequest{UserId: userId}
+	for i, item := range req.Tasks {
+		if item.Id == 0 || item.Title == "" || item.Description == "" {
+			log.ErrorLogger.Printf("Missing required fields in task %d", i)
+			http.Error(w, fmt.Sprintf("Missing required fields in task %d", i), http.StatusBadRequest)
+			return
+		}
+		if _, ok := models.PriorityToPB(item.Priority); !ok {
+			log.ErrorLogger.Printf("Invalid priority in task %d: %s", i, item.Priority)
+			http.Error(w, fmt.Sprintf("Invalid priority in task %d", i), http.StatusBadRequest)
+			return
+		}
+		if _, ok := models.StatusToPB(item.Status); !ok {
+			log.ErrorLogger.Printf("Invalid status in task %d: %s", i, item.Status)
+			http.Error(w, fmt.Sprintf("Invalid status in task %d", i), http.StatusBadRequest)
+			return
+		}
+
+		pbReq.Tasks = append(pbReq.Tasks, models.TaskToPB(models.Task{
+			Id:          item.Id,
+			Title:       item.Title,
+			Description: item.Description,
+			Status:      item.Status,
+			UserId:      userId,
+			DueAt:       item.DueAt,
+			Priority:    item.Priority,
+			ProjectId:   item.ProjectId,
+			Recurrence:  item.Recurrence,
+		}))
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.BatchUpdateTasks(r.Context(), pbReq)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to update tasks: %v", err)
+		http.Error(w, "Failed to update tasks", httpStatus(err))
+		return
+	}
+
+	writeBatchResults(w, pbResponse.Results)
+	log.InfoLogger.Print("Batch update tasks endpoint done successfully")
+}
+
+// @Summary Batch delete tasks
+// @Tags task
+// @Description move up to 100 tasks to the trash in one transaction, a task that cannot be deleted fails on its own
+// @ID batch-delete-tasks
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.BatchDeleteTasksRequest true "Tasks to delete"
+// @Success 200 {object} models.BatchTasksResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/batch/delete [post]
+func (h *Handler) BatchDeleteTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.BatchDeleteTasksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mode, ok := deleteMode(req.Mode)
+	if !ok {
+		log.ErrorLogger.Printf("Invalid delete mode: %s", req.Mode)
+		http.Error(w, "Invalid delete mode", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.BatchDeleteTasks(r.Context(), &pbTask.BatchDeleteTasksRequest{
+		UserId: userId,
+		Ids:    req.Ids,
+		Mode:   mode,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete tasks: %v", err)
+		http.Error(w, "Failed to delete tasks", httpStatus(err))
+		return
+	}
+
+	writeBatchResults(w, pbResponse.Results)
+	log.InfoLogger.Print("Batch delete tasks endpoint done successfully")
+}
+
+// writeBatchResults writes the per-item results of a batch, each with the
+// HTTP status the item would have got from the single task endpoint.
+func writeBatchResults(w http.ResponseWriter, pbResults []*pbTask.BatchResult) {
+	response := models.BatchTasksResponse{Results: []models.BatchResult{}}
+	for _, pbResult := range pbResults {
+		result := models.BatchResult{
+			Index:  pbResult.Index,
+			Id:     pbResult.Id,
+			Status: http.StatusOK,
+			Error:  pbResult.Error,
+		}
+		if code := codes.Code(pbResult.Code); code != codes.OK {
+			result.Status = httpStatus(status.Error(code, pbResult.Error))
+		}
+		if pbResult.Task != nil {
+			task := models.TaskFromPB(pbResult.Task)
+			result.Task = &task
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/gorilla/mux"
+
+	pbTask "github.com/damirbeybitov/todo_project/proto/task"
+)
+
+// @Summary Add comment
+// @Tags comment
+// @Description add a comment to a task, the author is the caller
+// @ID add-comment
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Param body body models.CommentRequest true "Comment text"
+// @Success 200 {object} models.Comment
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/comments [post]
+func (h *Handler) AddCommentHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.AddComment(r.Context(), &pbTask.AddCommentRequest{
+		TaskId: taskID,
+		UserId: userId,
+		Body:   req.Body,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to add comment: %v", err)
+		http.Error(w, "Failed to add comment", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.CommentFromPB(pbResponse.Comment))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Add comment endpoint done successfully")
+}
+
+// @Summary List comments
+// @Tags comment
+// @Description retrieve the comments of a task, oldest first
+// @ID list-comments
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.ListCommentsResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/comments [get]
+func (h *Handler) ListCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.ListComments(r.Context(), &pbTask.ListCommentsRequest{
+		TaskId: taskID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get comments: %v", err)
+		http.Error(w, "Failed to get comments", httpStatus(err))
+		return
+	}
+
+	response := models.ListCommentsResponse{Comments: []models.Comment{}}
+	for _, comment := range pbResponse.Comments {
+		response.Comments = append(response.Comments, models.CommentFromPB(comment))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("List comments endpoint done successfully")
+}
+
+// @Summary Edit comment
+// @Tags comment
+// @Description change the text of a comment, only its author may do it
+// @ID edit-comment
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Param comment_id path int true "Comment ID"
+// @Param body body models.CommentRequest true "New comment text"
+// @Success 200 {object} models.Comment
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/comments/{comment_id} [put]
+func (h *Handler) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, commentID, ok := commentIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.EditComment(r.Context(), &pbTask.EditCommentRequest{
+		Id:     commentID,
+		TaskId: taskID,
+		UserId: userId,
+		Body:   req.Body,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to edit comment: %v", err)
+		http.Error(w, "Failed to edit comment", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.CommentFromPB(pbResponse.Comment))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Edit comment endpoint done successfully")
+}
+
+// @Summary Delete comment
+// @Tags comment
+// @Description delete a comment, only its author may do it
+// @ID delete-comment
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Param comment_id path int true "Comment ID"
+// @Success 200 {object} models.DeleteCommentResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/comments/{comment_id} [delete]
+func (h *Handler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, commentID, ok := commentIDs(w, r)
+	if !ok {
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.DeleteComment(r.Context(), &pbTask.DeleteCommentRequest{
+		Id:     commentID,
+		TaskId: taskID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete comment: %v", err)
+		http.Error(w, "Failed to delete comment", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.DeleteCommentResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Delete comment endpoint done successfully")
+}
+
+// commentIDs parses the task and comment ids of the path and reports a bad
+// request when either is malformed.
+func commentIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	commentID, err := strconv.ParseInt(mux.Vars(r)["comment_id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid comment ID: %v", err)
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return taskID, commentID, true
+}
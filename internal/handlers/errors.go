@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// httpStatus maps a gRPC error returned by a microservice to an HTTP status code.
+func httpStatus(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.FailedPrecondition, codes.Aborted:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// preconditionStatus maps an error of a request made with If-Match: a task
+// changed concurrently fails the precondition.
+func preconditionStatus(err error, version int64) int {
+	if version != 0 && status.Code(err) == codes.Aborted {
+		return http.StatusPreconditionFailed
+	}
+	return httpStatus(err)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setETag sets the ETag header to the version of the task.
+func setETag(w http.ResponseWriter, version int64) {
+	if version != 0 {
+		w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+	}
+}
+
+// ifMatch returns the task version the If-Match header requires, or 0 when
+// the header is missing or matches any version.
+func ifMatch(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+
+	tag := strings.TrimPrefix(value, "W/")
+	if unquoted, err := strconv.Unquote(tag); err == nil {
+		tag = unquoted
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid If-Match header %q", value)
+	}
+	return version, nil
+}
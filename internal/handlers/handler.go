@@ -3,13 +3,19 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/damirbeybitov/todo_project/internal/log"
 	"github.com/damirbeybitov/todo_project/internal/models"
 	"github.com/damirbeybitov/todo_project/internal/repository"
 	"github.com/gorilla/mux"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 
 	pbAuth "github.com/damirbeybitov/todo_project/proto/auth"
 	pbTask "github.com/damirbeybitov/todo_project/proto/task"
@@ -84,6 +90,7 @@ func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 // @Param body body models.LoginRequest true "User login data"
 // @Success 200 {object} models.LoginResponse
 // @Failure 400 {string} string "Bad request"
+// @Failure 403 {string} string "Account disabled"
 // @Failure 500 {string} string "Internal server error"
 // @Router /auth/login [post]
 func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -104,7 +111,7 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		Password: user.Password,
 	})
 	if err != nil {
-		http.Error(w, "Failed to login user", http.StatusInternalServerError)
+		http.Error(w, "Failed to login user", httpStatus(err))
 		return
 	}
 
@@ -126,13 +133,14 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 // @Summary Refresh user token
 // @Tags auth
-// @Description refresh user access token
+// @Description exchange a refresh token for a new access token and refresh token. A refresh token is accepted once; presenting a used one again logs out the login it came from
 // @ID refresh-token
 // @Accept json
 // @Produce json
 // @Param body body models.RefreshTokenRequest true "User refresh token data"
 // @Success 200 {object} models.RefreshTokenResponse
 // @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
 // @Failure 500 {string} string "Internal server error"
 // @Router /auth/refresh [post]
 func (h *Handler) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -151,12 +159,14 @@ func (h *Handler) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 		RefreshToken: refreshToken.RefreshToken,
 	})
 	if err != nil {
-		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		log.ErrorLogger.Printf("Failed to refresh token: %v", err)
+		http.Error(w, "Failed to refresh token", httpStatus(err))
 		return
 	}
 
 	response := models.RefreshTokenResponse{
-		AccessToken: accessToken.AccessToken,
+		AccessToken:  accessToken.AccessToken,
+		RefreshToken: accessToken.RefreshToken,
 	}
 	responseJSON, err := json.Marshal(response)
 	if err != nil {
@@ -170,6 +180,123 @@ func (h *Handler) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	log.InfoLogger.Print("Refresh token endpoint done successfully")
 }
 
+// @Summary Logout
+// @Tags auth
+// @Description revoke a refresh token together with every token refreshed from the same login, and the access token of the Authorization header when there is one
+// @ID logout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.LogoutRequest true "User refresh token data"
+// @Success 200 {object} models.LogoutResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /auth/logout [post]
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		log.ErrorLogger.Print("Missing required fields")
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	// The access token of the caller, if any, stops working at once
+	pbResponse, err := h.repo.MicroServiceClients.AuthClient.Logout(r.Context(), &pbAuth.LogoutRequest{
+		RefreshToken: req.RefreshToken,
+		AccessToken:  strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "),
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to logout: %v", err)
+		http.Error(w, "Failed to logout", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.LogoutResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Logout endpoint done successfully")
+}
+
+// @Summary Logout everywhere
+// @Tags auth
+// @Description revoke every token of the caller, on all devices: the refresh tokens and the access tokens issued so far
+// @ID logout-all
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.LogoutResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /auth/logout-all [post]
+func (h *Handler) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	identity, err := h.repo.GetIdentityFromRequest(r.Header.Get("Authorization"))
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid access token: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.AuthClient.LogoutAll(r.Context(), &pbAuth.LogoutAllRequest{
+		Username: identity.Username,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to logout everywhere: %v", err)
+		http.Error(w, "Failed to logout everywhere", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.LogoutResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Logout all endpoint done successfully")
+}
+
+// @Summary JSON Web Key Set
+// @Tags auth
+// @Description get the public keys that verify the tokens, by the kid of the token header. Keys that are being rotated out are listed until their tokens expire; secret keys are never listed
+// @ID jwks
+// @Produce json
+// @Success 200 {object} models.JWKSet
+// @Failure 500 {string} string "Internal server error"
+// @Router /.well-known/jwks.json [get]
+func (h *Handler) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	jwks, err := h.repo.GetJWKS()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get token keys: %v", err)
+		http.Error(w, "Failed to get token keys", http.StatusInternalServerError)
+		return
+	}
+
+	responseJSON, err := json.Marshal(jwks)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("JWKS endpoint done successfully")
+}
+
 // @Summary Get user profile
 // @Tags user
 // @Description get user profile by token
@@ -182,14 +309,7 @@ func (h *Handler) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 // @Failure 500 {string} string "Internal server error"
 // @Router /user/profile [get]
 func (h *Handler) GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
-	userToken := r.Header.Get("Authorization")
-	if userToken == "" {
-		log.ErrorLogger.Print("Token is missing in Header")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	id, err := h.repo.GetUserIdFromRequest(userToken)
+	id, err := getUserId(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -242,14 +362,7 @@ func (h *Handler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userToken := r.Header.Get("Authorization")
-	if userToken == "" {
-		log.ErrorLogger.Print("Token is missing in Header")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	username, err := h.repo.GetUsernameFromRequest(userToken)
+	identity, err := getIdentity(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -260,9 +373,9 @@ func (h *Handler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
-	log.InfoLogger.Printf("Username to delete user: %s", username)
+	log.InfoLogger.Printf("Username to delete user: %s", identity.Username)
 	pbResponse, err := h.repo.MicroServiceClients.UserClient.DeleteUser(r.Context(), &pbUser.DeleteUserRequest{
-		Username: username,
+		Username: identity.Username,
 		Password: user.Password,
 	})
 	if err != nil {
@@ -306,29 +419,42 @@ func (h *Handler) CreateTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Title == "" || req.Description == "" || req.UserId == 0 {
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if req.Title == "" || req.Description == "" {
 		log.ErrorLogger.Print("Missing required fields")
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
+	if _, ok := models.PriorityToPB(req.Priority); !ok {
+		log.ErrorLogger.Printf("Invalid priority: %s", req.Priority)
+		http.Error(w, "Invalid priority", http.StatusBadRequest)
+		return
+	}
+
 	task := models.Task{
 		Title:       req.Title,
 		Description: req.Description,
-		UserId:      req.UserId,
+		UserId:      userId,
+		DueAt:       req.DueAt,
+		Priority:    req.Priority,
+		ParentId:    req.ParentId,
+		ProjectId:   req.ProjectId,
+		Recurrence:  req.Recurrence,
 	}
 
 	taskID, err := h.repo.MicroServiceClients.TaskClient.CreateTask(r.Context(), &pbTask.CreateTaskRequest{
-		Task: &pbTask.Task{
-			Title:       task.Title,
-			Description: task.Description,
-			UserId:      task.UserId,
-		},
+		Task: models.TaskToPB(task),
 	})
 
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to create task: %v", err)
-		http.Error(w, "Failed to create task", http.StatusInternalServerError)
+		http.Error(w, "Failed to create task", httpStatus(err))
 		return
 	}
 
@@ -349,54 +475,58 @@ func (h *Handler) CreateTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 // @Summary Get tasks
 // @Tags task
-// @Description retrieve all tasks
+// @Description retrieve a page of tasks
 // @ID get-tasks
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
+// @Param page_size query int false "Page size, 50 by default"
+// @Param page_token query string false "Token of the page to retrieve"
+// @Param status query string false "Filter by status" Enums(todo, in_progress, blocked, done, cancelled)
+// @Param q query string false "Search in title and description"
+// @Param sort_by query string false "Sort field" Enums(id, title, status, due_at, priority, created_at, updated_at)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param project_id query int false "Filter by project"
+// @Param tags query string false "Comma-separated tag names, tasks must have all of them"
 // @Success 200 {object} models.GetTasksResponse
+// @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 500 {string} string "Internal server error"
-// @Router /task/all [get]
+// @Router /task/get-tasks [get]
 func (h *Handler) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 	// Implement logic to retrieve all tasks
 	// Placeholder implementation
 
-	userToken := r.Header.Get("Authorization")
-	if userToken == "" {
-		log.ErrorLogger.Print("Token is missing in Header")
+	identity, err := getIdentity(r)
+	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	username, err := h.repo.GetUsernameFromRequest(userToken)
+	req, err := parseGetTasksQuery(r)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.ErrorLogger.Printf("Invalid query parameters: %v", err)
+		http.Error(w, "Invalid query parameters", http.StatusBadRequest)
 		return
 	}
+	req.Username = identity.Username
+	req.UserId = identity.UserId
 
-	pbTasks, err := h.repo.MicroServiceClients.TaskClient.GetTasks(r.Context(), &pbTask.GetTasksRequest{
-		Username: username,
-	})
+	pbTasks, err := h.repo.MicroServiceClients.TaskClient.GetTasks(r.Context(), req)
 	if err != nil {
-		http.Error(w, "Failed to get tasks", http.StatusInternalServerError)
+		http.Error(w, "Failed to get tasks", httpStatus(err))
 		return
 	}
 
 	var tasks []models.Task
 	pbTask := pbTasks.GetTasks()
 	for _, task := range pbTask {
-		tasks = append(tasks, models.Task{
-			Id:          task.Id,
-			Title:       task.Title,
-			Description: task.Description,
-			Status:      task.Status,
-			UserId:      task.UserId,
-		})
+		tasks = append(tasks, models.TaskFromPB(task))
 	}
 
 	response := models.GetTasksResponse{
-		Tasks: tasks,
+		Tasks:         tasks,
+		NextPageToken: pbTasks.NextPageToken,
 	}
 
 	responseJSON, err := json.Marshal(response)
@@ -411,6 +541,54 @@ func (h *Handler) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 	log.InfoLogger.Print("Get tasks endpoint done successfully")
 }
 
+// parseGetTasksQuery reads pagination, filter and sort parameters of /task/get-tasks.
+func parseGetTasksQuery(r *http.Request) (*pbTask.GetTasksRequest, error) {
+	query := r.URL.Query()
+	req := &pbTask.GetTasksRequest{
+		PageToken: query.Get("page_token"),
+		Query:     query.Get("q"),
+		SortBy:    query.Get("sort_by"),
+	}
+
+	if pageSize := query.Get("page_size"); pageSize != "" {
+		size, err := strconv.ParseInt(pageSize, 10, 32)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid page_size %q", pageSize)
+		}
+		req.PageSize = int32(size)
+	}
+
+	if status := query.Get("status"); status != "" {
+		value, ok := models.StatusToPB(status)
+		if !ok {
+			return nil, fmt.Errorf("invalid status %q", status)
+		}
+		req.Status = value
+	}
+
+	if projectID := query.Get("project_id"); projectID != "" {
+		id, err := strconv.ParseInt(projectID, 10, 64)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("invalid project_id %q", projectID)
+		}
+		req.ProjectId = id
+	}
+
+	if tags := query.Get("tags"); tags != "" {
+		req.Tags = strings.Split(tags, ",")
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		req.SortDesc = true
+	default:
+		return nil, fmt.Errorf("invalid order %q", order)
+	}
+
+	return req, nil
+}
+
 // @Summary Get task by ID
 // @Tags task
 // @Description retrieve a task by its ID
@@ -420,6 +598,7 @@ func (h *Handler) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 // @Security ApiKeyAuth
 // @Param id path int true "Task ID"
 // @Success 200 {object} models.Task
+// @Header 200 {string} ETag "Version of the task"
 // @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 404 {string} string "Not found"
@@ -440,22 +619,30 @@ func (h *Handler) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	task, err := h.repo.MicroServiceClients.TaskClient.GetTask(r.Context(), &pbTask.GetTaskRequest{
-		Id: taskID,
+		Id:     taskID,
+		UserId: userId,
 	})
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to get task: %v", err)
-		http.Error(w, "Failed to get task", http.StatusInternalServerError)
+		http.Error(w, "Failed to get task", httpStatus(err))
 		return
 	}
 
-	responseJSON, err := json.Marshal(task)
+	responseJSON, err := json.Marshal(models.TaskFromPB(task.Task))
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
 		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
 		return
 	}
 
+	setETag(w, task.Task.GetVersion())
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(responseJSON)
 	log.InfoLogger.Print("Get task endpoint done successfully")
@@ -463,16 +650,20 @@ func (h *Handler) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 // @Summary Update task
 // @Tags task
-// @Description update a task
+// @Description update a task. Every change bumps the version of the task; an update that changes no field records nothing and keeps the version and the ETag
 // @ID update-task
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param body body models.UpdateTaskRequest true "Task update data"
+// @Param If-Match header string false "ETag of the task version the change applies to"
 // @Success 200 {object} models.UpdateTaskResponse
+// @Header 200 {string} ETag "Version of the task"
 // @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 404 {string} string "Not found"
+// @Failure 409 {string} string "Conflict"
+// @Failure 412 {string} string "Precondition failed"
 // @Failure 500 {string} string "Internal server error"
 // @Router /task/update [post]
 func (h *Handler) UpdateTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -483,14 +674,7 @@ func (h *Handler) UpdateTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userToken := r.Header.Get("Authorization")
-	if userToken == "" {
-		log.ErrorLogger.Print("Token is missing in Header")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	userId, err := h.repo.GetUserIdFromRequest(userToken)
+	userId, err := getUserId(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -502,36 +686,65 @@ func (h *Handler) UpdateTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, ok := models.PriorityToPB(req.Priority); !ok {
+		log.ErrorLogger.Printf("Invalid priority: %s", req.Priority)
+		http.Error(w, "Invalid priority", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := models.StatusToPB(req.Status); !ok {
+		log.ErrorLogger.Printf("Invalid status: %s", req.Status)
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid If-Match header: %v", err)
+		http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+		return
+	}
+
 	task := models.Task{
 		Id:          req.Id,
 		Title:       req.Title,
 		Description: req.Description,
 		Status:      req.Status,
 		UserId:      userId,
+		DueAt:       req.DueAt,
+		Priority:    req.Priority,
+		ProjectId:   req.ProjectId,
+		Recurrence:  req.Recurrence,
+		Version:     version,
 	}
 
 	UpdateTaskResponse, err := h.repo.MicroServiceClients.TaskClient.UpdateTask(r.Context(), &pbTask.UpdateTaskRequest{
-		Task: &pbTask.Task{
-			Id:          task.Id,
-			Title:       task.Title,
-			Description: task.Description,
-			Status:      task.Status,
-			UserId:      userId,
-		},
+		Task: models.TaskToPB(task),
 	})
 
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to update task: %v", err)
-		http.Error(w, "Failed to update task", http.StatusInternalServerError)
+		http.Error(w, "Failed to update task", preconditionStatus(err, version))
 		return
 	}
 
+	updatedTask := models.TaskFromPB(UpdateTaskResponse.Task)
 	response := models.UpdateTaskResponse{
-		Id:          UpdateTaskResponse.Task.Id,
-		Title:       UpdateTaskResponse.Task.Title,
-		Description: UpdateTaskResponse.Task.Description,
-		Status:      UpdateTaskResponse.Task.Status,
-		UserId:      UpdateTaskResponse.Task.UserId,
+		Id:          updatedTask.Id,
+		Title:       updatedTask.Title,
+		Description: updatedTask.Description,
+		Status:      updatedTask.Status,
+		UserId:      updatedTask.UserId,
+		DueAt:       updatedTask.DueAt,
+		Priority:    updatedTask.Priority,
+		CreatedAt:   updatedTask.CreatedAt,
+		UpdatedAt:   updatedTask.UpdatedAt,
+		ParentId:    updatedTask.ParentId,
+		ProjectId:   updatedTask.ProjectId,
+		AssigneeId:  updatedTask.AssigneeId,
+		Tags:        updatedTask.Tags,
+		Recurrence:  updatedTask.Recurrence,
+		Version:     updatedTask.Version,
 	}
 
 	responseJSON, err := json.Marshal(response)
@@ -541,23 +754,173 @@ func (h *Handler) UpdateTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, updatedTask.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(responseJSON)
 	log.InfoLogger.Print("Update task endpoint done successfully")
 }
 
+// @Summary Patch task
+// @Tags task
+// @Description change only the fields of a task present in the body, the other fields keep their values. Every change bumps the version of the task; a patch that changes no field records nothing and keeps the version and the ETag
+// @ID patch-task
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Param body body models.PatchTaskRequest true "Fields to change"
+// @Param If-Match header string false "ETag of the task version the change applies to"
+// @Success 200 {object} models.UpdateTaskResponse
+// @Header 200 {string} ETag "Version of the task"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 409 {string} string "Conflict"
+// @Failure 412 {string} string "Precondition failed"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id} [patch]
+func (h *Handler) PatchTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to read request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// The fields present in the body make up the update mask
+	var fields map[string]json.RawMessage
+	var req models.PatchTaskRequest
+	if err := json.Unmarshal(body, &fields); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var paths []string
+	for field := range fields {
+		switch field {
+		case "title", "description", "status", "due_at", "priority", "project_id", "recurrence":
+			paths = append(paths, field)
+		default:
+			log.ErrorLogger.Printf("Unknown task field: %s", field)
+			http.Error(w, fmt.Sprintf("Field %s cannot be updated", field), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(paths) == 0 {
+		log.ErrorLogger.Print("No fields to update")
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
+	sort.Strings(paths)
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if _, ok := models.PriorityToPB(req.Priority); !ok {
+		log.ErrorLogger.Printf("Invalid priority: %s", req.Priority)
+		http.Error(w, "Invalid priority", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := models.StatusToPB(req.Status); !ok {
+		log.ErrorLogger.Printf("Invalid status: %s", req.Status)
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid If-Match header: %v", err)
+		http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+		return
+	}
+
+	task := models.Task{
+		Id:          taskID,
+		Title:       req.Title,
+		Description: req.Description,
+		Status:      req.Status,
+		UserId:      userId,
+		DueAt:       req.DueAt,
+		Priority:    req.Priority,
+		ProjectId:   req.ProjectId,
+		Recurrence:  req.Recurrence,
+		Version:     version,
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.UpdateTask(r.Context(), &pbTask.UpdateTaskRequest{
+		Task:       models.TaskToPB(task),
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: paths},
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to patch task: %v", err)
+		http.Error(w, "Failed to patch task", preconditionStatus(err, version))
+		return
+	}
+
+	updatedTask := models.TaskFromPB(pbResponse.Task)
+	response := models.UpdateTaskResponse{
+		Id:          updatedTask.Id,
+		Title:       updatedTask.Title,
+		Description: updatedTask.Description,
+		Status:      updatedTask.Status,
+		UserId:      updatedTask.UserId,
+		DueAt:       updatedTask.DueAt,
+		Priority:    updatedTask.Priority,
+		CreatedAt:   updatedTask.CreatedAt,
+		UpdatedAt:   updatedTask.UpdatedAt,
+		ParentId:    updatedTask.ParentId,
+		ProjectId:   updatedTask.ProjectId,
+		AssigneeId:  updatedTask.AssigneeId,
+		Tags:        updatedTask.Tags,
+		Recurrence:  updatedTask.Recurrence,
+		Version:     updatedTask.Version,
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, updatedTask.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Patch task endpoint done successfully")
+}
+
 // @Summary Delete task
 // @Tags task
-// @Description delete a task by ID
+// @Description move a task to the trash, its subtasks are moved to the trash too or moved to its parent
 // @ID delete-task
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path int true "Task ID"
+// @Param mode query string false "What happens to subtasks, reparent by default" Enums(reparent, cascade)
+// @Param If-Match header string false "ETag of the task version the change applies to"
 // @Success 200 {object} models.DeleteTaskResponse
 // @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 404 {string} string "Not found"
+// @Failure 412 {string} string "Precondition failed"
 // @Failure 500 {string} string "Internal server error"
 // @Router /task/{id} [delete]
 func (h *Handler) DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -575,12 +938,35 @@ func (h *Handler) DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	mode, ok := deleteMode(r.URL.Query().Get("mode"))
+	if !ok {
+		log.ErrorLogger.Printf("Invalid delete mode: %s", r.URL.Query().Get("mode"))
+		http.Error(w, "Invalid delete mode", http.StatusBadRequest)
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid If-Match header: %v", err)
+		http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	DeleteTaskResponse, err := h.repo.MicroServiceClients.TaskClient.DeleteTask(r.Context(), &pbTask.DeleteTaskRequest{
-		Id: taskID,
+		Id:      taskID,
+		UserId:  userId,
+		Mode:    mode,
+		Version: version,
 	})
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to delete task: %v", err)
-		http.Error(w, "Failed to delete task", http.StatusInternalServerError)
+		http.Error(w, "Failed to delete task", preconditionStatus(err, version))
 		return
 	}
 
@@ -598,3 +984,443 @@ func (h *Handler) DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(responseJSON)
 	log.InfoLogger.Print("Delete task endpoint done successfully")
 }
+
+// deleteMode parses what happens to the subtasks of a deleted task, reparent by default.
+func deleteMode(mode string) (pbTask.DeleteMode, bool) {
+	switch mode {
+	case "", "reparent":
+		return pbTask.DeleteMode_DELETE_MODE_REPARENT, true
+	case "cascade":
+		return pbTask.DeleteMode_DELETE_MODE_CASCADE, true
+	default:
+		return pbTask.DeleteMode_DELETE_MODE_UNSPECIFIED, false
+	}
+}
+
+// @Summary Get overdue tasks
+// @Tags task
+// @Description retrieve unfinished tasks that are overdue or due within the given duration
+// @ID get-overdue-tasks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param within query string false "Also include tasks due within this duration, e.g. 24h"
+// @Success 200 {object} models.GetTasksResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/get-overdue-tasks [get]
+func (h *Handler) GetOverdueTasksHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var within time.Duration
+	if value := r.URL.Query().Get("within"); value != "" {
+		within, err = time.ParseDuration(value)
+		if err != nil || within < 0 {
+			log.ErrorLogger.Printf("Invalid within parameter: %s", value)
+			http.Error(w, "Invalid within parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pbTasks, err := h.repo.MicroServiceClients.TaskClient.GetOverdueTasks(r.Context(), &pbTask.GetOverdueTasksRequest{
+		UserId:           userId,
+		DueWithinSeconds: int64(within / time.Second),
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get overdue tasks: %v", err)
+		http.Error(w, "Failed to get overdue tasks", httpStatus(err))
+		return
+	}
+
+	var tasks []models.Task
+	for _, task := range pbTasks.Tasks {
+		tasks = append(tasks, models.TaskFromPB(task))
+	}
+
+	responseJSON, err := json.Marshal(models.GetTasksResponse{Tasks: tasks})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get overdue tasks endpoint done successfully")
+}
+
+// @Summary Transition task
+// @Tags task
+// @Description move a task to another status
+// @ID transition-task
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Param body body models.TransitionTaskRequest true "Target status"
+// @Success 200 {object} models.Task
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 409 {string} string "Transition is not allowed"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/transition [post]
+func (h *Handler) TransitionTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.TransitionTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	status, ok := models.StatusToPB(req.Status)
+	if !ok || req.Status == "" {
+		log.ErrorLogger.Printf("Invalid status: %s", req.Status)
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.TransitionTask(r.Context(), &pbTask.TransitionTaskRequest{
+		Id:     taskID,
+		UserId: userId,
+		Status: status,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to transition task: %v", err)
+		http.Error(w, "Failed to transition task", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.TaskFromPB(pbResponse.Task))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, pbResponse.Task.GetVersion())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Transition task endpoint done successfully")
+}
+
+// @Summary Get subtasks
+// @Tags task
+// @Description retrieve the direct subtasks of a task and their completion percentage
+// @ID get-subtasks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.GetSubtasksResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/subtasks [get]
+func (h *Handler) GetSubtasksHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.GetSubtasks(r.Context(), &pbTask.GetSubtasksRequest{
+		Id:     taskID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get subtasks: %v", err)
+		http.Error(w, "Failed to get subtasks", httpStatus(err))
+		return
+	}
+
+	response := models.GetSubtasksResponse{
+		CompletionPercent: pbResponse.CompletionPercent,
+	}
+	for _, task := range pbResponse.Tasks {
+		response.Tasks = append(response.Tasks, models.TaskFromPB(task))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get subtasks endpoint done successfully")
+}
+
+// @Summary Move task
+// @Tags task
+// @Description attach a task to another parent task, parent_id 0 makes it a top-level task
+// @ID move-task
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Param body body models.MoveTaskRequest true "New parent task"
+// @Success 200 {object} models.Task
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/move [post]
+func (h *Handler) MoveTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.MoveTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.MoveTask(r.Context(), &pbTask.MoveTaskRequest{
+		Id:       taskID,
+		UserId:   userId,
+		ParentId: req.ParentId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to move task: %v", err)
+		http.Error(w, "Failed to move task", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.TaskFromPB(pbResponse.Task))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, pbResponse.Task.GetVersion())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Move task endpoint done successfully")
+}
+
+// @Summary Assign task
+// @Tags task
+// @Description assign a task to a user, an empty username unassigns it
+// @ID assign-task
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Param body body models.AssignTaskRequest true "Assignee"
+// @Success 200 {object} models.Task
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/assign [post]
+func (h *Handler) AssignTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AssignTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Make sure the assignee exists before assigning the task
+	var assigneeId int64
+	if req.Username != "" {
+		assignee, err := h.repo.MicroServiceClients.UserClient.GetUserIdWithUsername(r.Context(), &pbUser.GetUserIdWithUsernameRequest{
+			Username: req.Username,
+		})
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to find user %s: %v", req.Username, err)
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		assigneeId = assignee.Id
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.AssignTask(r.Context(), &pbTask.AssignTaskRequest{
+		Id:         taskID,
+		UserId:     userId,
+		AssigneeId: assigneeId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to assign task: %v", err)
+		http.Error(w, "Failed to assign task", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.TaskFromPB(pbResponse.Task))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, pbResponse.Task.GetVersion())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Assign task endpoint done successfully")
+}
+
+// @Summary Get assigned tasks
+// @Tags task
+// @Description retrieve a page of tasks assigned to the user
+// @ID get-assigned-tasks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param page_size query int false "Page size, 50 by default"
+// @Param page_token query string false "Token of the page to retrieve"
+// @Param status query string false "Filter by status" Enums(todo, in_progress, blocked, done, cancelled)
+// @Success 200 {object} models.GetTasksResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/get-assigned-tasks [get]
+func (h *Handler) GetAssignedTasksHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query, err := parseGetTasksQuery(r)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid query parameters: %v", err)
+		http.Error(w, "Invalid query parameters", http.StatusBadRequest)
+		return
+	}
+
+	pbTasks, err := h.repo.MicroServiceClients.TaskClient.GetAssignedTasks(r.Context(), &pbTask.GetAssignedTasksRequest{
+		UserId:    userId,
+		PageSize:  query.PageSize,
+		PageToken: query.PageToken,
+		Status:    query.Status,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get assigned tasks: %v", err)
+		http.Error(w, "Failed to get assigned tasks", httpStatus(err))
+		return
+	}
+
+	response := models.GetTasksResponse{
+		NextPageToken: pbTasks.NextPageToken,
+	}
+	for _, task := range pbTasks.Tasks {
+		response.Tasks = append(response.Tasks, models.TaskFromPB(task))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get assigned tasks endpoint done successfully")
+}
+
+// @Summary Get task history
+// @Tags task
+// @Description retrieve the changes made to a task, oldest first
+// @ID get-task-history
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.GetTaskHistoryResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/history [get]
+func (h *Handler) GetTaskHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.GetTaskHistory(r.Context(), &pbTask.GetTaskHistoryRequest{
+		Id:     taskID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get task history: %v", err)
+		http.Error(w, "Failed to get task history", httpStatus(err))
+		return
+	}
+
+	response := models.GetTaskHistoryResponse{Events: []models.TaskEvent{}}
+	for _, event := range pbResponse.Events {
+		response.Events = append(response.Events, models.TaskEventFromPB(event))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get task history endpoint done successfully")
+}
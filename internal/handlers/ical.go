@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+const (
+	// icalDateTime is the layout of UTC date-times in iCalendar (RFC 5545).
+	icalDateTime = "20060102T150405Z"
+	// icalLocalDateTime is the layout of floating and TZID date-times.
+	icalLocalDateTime = "20060102T150405"
+	// icalDate is the layout of dates.
+	icalDate = "20060102"
+	// icalLineLength is the length in octets at which content lines are folded.
+	icalLineLength = 75
+	// icalStatusProperty keeps the exact status, iCalendar has no "blocked".
+	icalStatusProperty = "X-TODO-STATUS"
+)
+
+// icalStatuses maps task statuses to VTODO statuses.
+var icalStatuses = map[string]string{
+	models.StatusTodo:       "NEEDS-ACTION",
+	models.StatusInProgress: "IN-PROCESS",
+	models.StatusBlocked:    "IN-PROCESS",
+	models.StatusDone:       "COMPLETED",
+	models.StatusCancelled:  "CANCELLED",
+}
+
+// icalPriorities maps task priorities to VTODO priorities, 1 is the highest.
+var icalPriorities = map[string]int{
+	models.PriorityUrgent: 1,
+	models.PriorityHigh:   3,
+	models.PriorityMedium: 5,
+	models.PriorityLow:    9,
+}
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icalEncoder writes the tasks as the VTODOs of an iCalendar file.
+type icalEncoder struct {
+	w       *bufio.Writer
+	stamp   string
+	started bool
+}
+
+func newICalEncoder(w io.Writer) *icalEncoder {
+	return &icalEncoder{w: bufio.NewWriter(w), stamp: time.Now().UTC().Format(icalDateTime)}
+}
+
+func (e *icalEncoder) Encode(task models.Task) error {
+	if !e.started {
+		e.start()
+	}
+
+	e.line("BEGIN:VTODO")
+	e.line(fmt.Sprintf("UID:task-%d@todo_project", task.Id))
+	e.line("DTSTAMP:" + e.stamp)
+	e.line("CREATED:" + task.CreatedAt.UTC().Format(icalDateTime))
+	e.line("LAST-MODIFIED:" + task.UpdatedAt.UTC().Format(icalDateTime))
+	e.line("SUMMARY:" + icalEscaper.Replace(task.Title))
+	if task.Description != "" {
+		e.line("DESCRIPTION:" + icalEscaper.Replace(task.Description))
+	}
+	if status, ok := icalStatuses[task.Status]; ok {
+		e.line("STATUS:" + status)
+		e.line(icalStatusProperty + ":" + task.Status)
+	}
+	if priority, ok := icalPriorities[task.Priority]; ok {
+		e.line("PRIORITY:" + strconv.Itoa(priority))
+	}
+	if task.DueAt != nil {
+		e.line("DUE:" + task.DueAt.UTC().Format(icalDateTime))
+	}
+	if task.Recurrence != "" {
+		e.line("RRULE:" + task.Recurrence)
+	}
+	if len(task.Tags) > 0 {
+		tags := make([]string, len(task.Tags))
+		for i, tag := range task.Tags {
+			tags[i] = icalEscaper.Replace(tag)
+		}
+		e.line("CATEGORIES:" + strings.Join(tags, ","))
+	}
+	e.line("END:VTODO")
+	return nil
+}
+
+func (e *icalEncoder) Close() error {
+	if !e.started {
+		e.start()
+	}
+	e.line("END:VCALENDAR")
+	return e.w.Flush()
+}
+
+func (e *icalEncoder) start() {
+	e.started = true
+	e.line("BEGIN:VCALENDAR")
+	e.line("VERSION:2.0")
+	e.line("PRODID:-//todo_project//tasks//EN")
+}
+
+// line writes a content line folded at icalLineLength octets, never inside
+// a UTF-8 sequence.
+func (e *icalEncoder) line(content string) {
+	limit := icalLineLength
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		e.w.WriteString(content[:cut])
+		e.w.WriteString("\r\n ")
+		content = content[cut:]
+		// The leading space of a continuation line counts against its length
+		limit = icalLineLength - 1
+	}
+	e.w.WriteString(content)
+	e.w.WriteString("\r\n")
+}
+
+// icalProperty is a content line split into its name, parameters and value.
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// decodeICal reads the VTODOs of an iCalendar file; other components are
+// skipped.
+func decodeICal(r io.Reader) ([]importedRow, error) {
+	lines, err := unfoldICal(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, errors.New("expected BEGIN:VCALENDAR")
+	}
+
+	var rows []importedRow
+	var todo []icalProperty
+	// depth counts the components open inside the current VTODO, like VALARM
+	inTodo, depth := false, 0
+	for _, line := range lines {
+		property, err := parseICalLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case property.name == "BEGIN" && strings.EqualFold(property.value, "VTODO") && !inTodo:
+			inTodo, todo = true, nil
+		case !inTodo:
+		case property.name == "BEGIN":
+			depth++
+		case property.name == "END" && depth > 0:
+			depth--
+		case property.name == "END":
+			var row importedRow
+			row.task, row.err = icalTask(todo)
+			rows = append(rows, row)
+			inTodo = false
+		case depth == 0:
+			todo = append(todo, property)
+		}
+	}
+	if inTodo {
+		return nil, errors.New("unterminated VTODO")
+	}
+
+	return rows, nil
+}
+
+// unfoldICal splits the file into content lines, joining folded lines.
+func unfoldICal(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportBytes)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseICalLine splits a content line. Parameter values may be quoted and
+// contain colons.
+func parseICalLine(line string) (icalProperty, error) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return icalProperty{}, fmt.Errorf("invalid content line %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	property := icalProperty{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string, len(parts)-1),
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		if name, value, ok := strings.Cut(param, "="); ok {
+			property.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return property, nil
+}
+
+// icalTask builds a task from the properties of a VTODO.
+func icalTask(properties []icalProperty) (models.Task, error) {
+	var task models.Task
+	var icalStatus string
+	for _, property := range properties {
+		switch property.name {
+		case "SUMMARY":
+			task.Title = unescapeICal(property.value)
+		case "DESCRIPTION":
+			task.Description = unescapeICal(property.value)
+		case "STATUS":
+			icalStatus = strings.ToUpper(property.value)
+		case icalStatusProperty:
+			task.Status = property.value
+		case "PRIORITY":
+			priority, err := icalPriority(property.value)
+			if err != nil {
+				return task, err
+			}
+			task.Priority = priority
+		case "DUE":
+			dueAt, err := parseICalTime(property)
+			if err != nil {
+				return task, err
+			}
+			task.DueAt = &dueAt
+		case "RRULE":
+			task.Recurrence = property.value
+		case "CATEGORIES":
+			for _, tag := range splitICal(property.value) {
+				task.Tags = append(task.Tags, unescapeICal(tag))
+			}
+		}
+	}
+
+	// The exact status of an exported task wins over the VTODO status
+	if task.Status == "" && icalStatus != "" {
+		for status, vtodoStatus := range icalStatuses {
+			if vtodoStatus == icalStatus && status != models.StatusBlocked {
+				task.Status = status
+			}
+		}
+		if task.Status == "" {
+			return task, fmt.Errorf("invalid STATUS %q", icalStatus)
+		}
+	}
+
+	return task, nil
+}
+
+// icalPriority maps a VTODO priority to a task priority; 0 means none.
+func icalPriority(value string) (string, error) {
+	priority, err := strconv.Atoi(value)
+	switch {
+	case err != nil || priority < 0 || priority > 9:
+		return "", fmt.Errorf("invalid PRIORITY %q", value)
+	case priority == 0:
+		return "", nil
+	case priority <= 2:
+		return models.PriorityUrgent, nil
+	case priority <= 4:
+		return models.PriorityHigh, nil
+	case priority == 5:
+		return models.PriorityMedium, nil
+	default:
+		return models.PriorityLow, nil
+	}
+}
+
+// parseICalTime parses a UTC, TZID or floating date-time, or a date. Floating
+// times and dates are taken as UTC.
+func parseICalTime(property icalProperty) (time.Time, error) {
+	value := property.value
+	if strings.EqualFold(property.params["VALUE"], "DATE") || len(value) == len(icalDate) {
+		if t, err := time.Parse(icalDate, value); err == nil {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("invalid %s %q", property.name, value)
+	}
+	if strings.HasSuffix(value, "Z") {
+		if t, err := time.Parse(icalDateTime, value); err == nil {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("invalid %s %q", property.name, value)
+	}
+
+	location := time.UTC
+	if tzid := property.params["TZID"]; tzid != "" {
+		var err error
+		if location, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID %q", tzid)
+		}
+	}
+	t, err := time.ParseInLocation(icalLocalDateTime, value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q", property.name, value)
+	}
+	return t.UTC(), nil
+}
+
+// splitICal splits a list value at the commas that are not escaped.
+func splitICal(value string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// unescapeICal undoes the escaping of a text value.
+func unescapeICal(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
@@ -1,13 +1,21 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
-	"strings"
 
 	"github.com/damirbeybitov/todo_project/internal/log"
 	token "github.com/damirbeybitov/todo_project/internal/token"
+	"github.com/gorilla/mux"
 )
 
+type ctxKey string
+
+const identityCtx ctxKey = "identity"
+
+// UserIdentity rejects requests without a valid access token and stores the
+// identity of the caller from the token claims in the request context.
 func (h *Handler) UserIdentity(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userToken := r.Header.Get("Authorization")
@@ -16,14 +24,59 @@ func (h *Handler) UserIdentity(next http.Handler) http.Handler {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		userToken = strings.TrimPrefix(userToken, "Bearer ")
 
-		_, err := token.VerifyToken(userToken)
+		// Revoked tokens are rejected like expired ones
+		identity, err := h.repo.GetIdentityFromRequest(userToken)
 		if err != nil {
+			log.ErrorLogger.Printf("Failed to identify user: %v", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), identityCtx, identity)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
-}
\ No newline at end of file
+}
+
+// RequireRole lets through the callers with the role and answers the others
+// with 403. It goes after UserIdentity, which stores the caller.
+func (h *Handler) RequireRole(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, err := getIdentity(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !identity.HasRole(role) {
+				log.ErrorLogger.Printf("User %s lacks role %s for %s", identity.Username, role, r.URL.Path)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// getIdentity returns the identity of the caller stored by UserIdentity.
+func getIdentity(r *http.Request) (token.Identity, error) {
+	identity, ok := r.Context().Value(identityCtx).(token.Identity)
+	if !ok || identity.UserId == 0 {
+		log.ErrorLogger.Print("User identity is missing in request context")
+		return token.Identity{}, errors.New("user identity not found")
+	}
+
+	return identity, nil
+}
+
+// getUserId returns the id of the caller stored by UserIdentity.
+func getUserId(r *http.Request) (int64, error) {
+	identity, err := getIdentity(r)
+	if err != nil {
+		return 0, err
+	}
+
+	return identity.UserId, nil
+}
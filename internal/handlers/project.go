@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/gorilla/mux"
+
+	pbProject "github.com/damirbeybitov/todo_project/proto/project"
+	pbUser "github.com/damirbeybitov/todo_project/proto/user"
+)
+
+// @Summary Create project
+// @Tags project
+// @Description create a new project
+// @ID create-project
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.CreateProjectRequest true "Project creation data"
+// @Success 200 {object} models.CreateProjectResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /project/create-project [post]
+func (h *Handler) CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if req.Name == "" {
+		log.ErrorLogger.Print("Missing required fields")
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	project := models.Project{
+		Name:        req.Name,
+		Description: req.Description,
+		UserId:      userId,
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.ProjectClient.CreateProject(r.Context(), &pbProject.CreateProjectRequest{
+		Project: models.ProjectToPB(project),
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to create project: %v", err)
+		http.Error(w, "Failed to create project", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.CreateProjectResponse{Id: pbResponse.Id})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Create project endpoint done successfully")
+}
+
+// @Summary Get projects
+// @Tags project
+// @Description retrieve all projects of the user
+// @ID get-projects
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.GetProjectsResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /project/get-projects [get]
+func (h *Handler) GetProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.ProjectClient.GetProjects(r.Context(), &pbProject.GetProjectsRequest{
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get projects: %v", err)
+		http.Error(w, "Failed to get projects", httpStatus(err))
+		return
+	}
+
+	var response models.GetProjectsResponse
+	for _, project := range pbResponse.Projects {
+		response.Projects = append(response.Projects, models.ProjectFromPB(project))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get projects endpoint done successfully")
+}
+
+// @Summary Get project by ID
+// @Tags project
+// @Description retrieve a project by its ID
+// @ID get-project-by-id
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Project
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /project/get-project/{id} [get]
+func (h *Handler) GetProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid project ID: %v", err)
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.ProjectClient.GetProject(r.Context(), &pbProject.GetProjectRequest{
+		Id:     projectID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get project: %v", err)
+		http.Error(w, "Failed to get project", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.ProjectFromPB(pbResponse.Project))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get project endpoint done successfully")
+}
+
+// @Summary Update project
+// @Tags project
+// @Description update a project
+// @ID update-project
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.UpdateProjectRequest true "Project update data"
+// @Success 200 {object} models.Project
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /project/update-project [put]
+func (h *Handler) UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if req.Id == 0 || req.Name == "" {
+		log.ErrorLogger.Print("Missing required fields")
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	project := models.Project{
+		Id:          req.Id,
+		Name:        req.Name,
+		Description: req.Description,
+		UserId:      userId,
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.ProjectClient.UpdateProject(r.Context(), &pbProject.UpdateProjectRequest{
+		Project: models.ProjectToPB(project),
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to update project: %v", err)
+		http.Error(w, "Failed to update project", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.ProjectFromPB(pbResponse.Project))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Update project endpoint done successfully")
+}
+
+// @Summary Delete project
+// @Tags project
+// @Description delete a project by ID, its tasks are kept outside of projects
+// @ID delete-project
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.DeleteProjectResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /project/delete-project/{id} [delete]
+func (h *Handler) DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid project ID: %v", err)
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.ProjectClient.DeleteProject(r.Context(), &pbProject.DeleteProjectRequest{
+		Id:     projectID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete project: %v", err)
+		http.Error(w, "Failed to delete project", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.DeleteProjectResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Delete project endpoint done successfully")
+}
+
+// @Summary Add project member
+// @Tags project
+// @Description add a user to a project or change the role of a member, only owners may do it
+// @ID add-project-member
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Project ID"
+// @Param body body models.AddProjectMemberRequest true "Member and role"
+// @Success 200 {object} models.ProjectMember
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 409 {string} string "Project must keep an owner"
+// @Failure 500 {string} string "Internal server error"
+// @Router /project/{id}/members [post]
+func (h *Handler) AddProjectMemberHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid project ID: %v", err)
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AddProjectMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, ok := models.RoleToPB(req.Role)
+	if !ok || req.Role == "" || req.Username == "" {
+		log.ErrorLogger.Printf("Invalid member: %s as %s", req.Username, req.Role)
+		http.Error(w, "Invalid member", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	member, err := h.repo.MicroServiceClients.UserClient.GetUserIdWithUsername(r.Context(), &pbUser.GetUserIdWithUsernameRequest{
+		Username: req.Username,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to find user %s: %v", req.Username, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.ProjectClient.AddProjectMember(r.Context(), &pbProject.AddProjectMemberRequest{
+		ProjectId: projectID,
+		UserId:    userId,
+		MemberId:  member.Id,
+		Role:      role,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to add project member: %v", err)
+		http.Error(w, "Failed to add project member", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.ProjectMemberFromPB(pbResponse.Member))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Add project member endpoint done successfully")
+}
+
+// @Summary Get project members
+// @Tags project
+// @Description retrieve the members of a project
+// @ID get-project-members
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.GetProjectMembersResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /project/{id}/members [get]
+func (h *Handler) GetProjectMembersHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid project ID: %v", err)
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.ProjectClient.GetProjectMembers(r.Context(), &pbProject.GetProjectMembersRequest{
+		ProjectId: projectID,
+		UserId:    userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get project members: %v", err)
+		http.Error(w, "Failed to get project members", httpStatus(err))
+		return
+	}
+
+	var response models.GetProjectMembersResponse
+	for _, member := range pbResponse.Members {
+		response.Members = append(response.Members, models.ProjectMemberFromPB(member))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get project members endpoint done successfully")
+}
+
+// @Summary Remove project member
+// @Tags project
+// @Description remove a member from a project, owners may remove anyone and members may leave
+// @ID remove-project-member
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Project ID"
+// @Param user_id path int true "Member user ID"
+// @Success 200 {object} models.RemoveProjectMemberResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 409 {string} string "Project must keep an owner"
+// @Failure 500 {string} string "Internal server error"
+// @Router /project/{id}/members/{user_id} [delete]
+func (h *Handler) RemoveProjectMemberHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid project ID: %v", err)
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	memberID, err := strconv.ParseInt(mux.Vars(r)["user_id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid member ID: %v", err)
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.ProjectClient.RemoveProjectMember(r.Context(), &pbProject.RemoveProjectMemberRequest{
+		ProjectId: projectID,
+		UserId:    userId,
+		MemberId:  memberID,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to remove project member: %v", err)
+		http.Error(w, "Failed to remove project member", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.RemoveProjectMemberResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Remove project member endpoint done successfully")
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+
+	pbTask "github.com/damirbeybitov/todo_project/proto/task"
+)
+
+// @Summary Search tasks
+// @Tags task
+// @Description search the tasks visible to the user by title, description, comments and tags, best matches first. Snippets are HTML-escaped with the matches wrapped in <mark>
+// @ID search-tasks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param q query string true "Search query, every word also matches the words it is a prefix of"
+// @Param page_size query int false "Page size, 50 by default"
+// @Param page_token query string false "Token of the page to retrieve"
+// @Success 200 {object} models.SearchTasksResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/search [get]
+func (h *Handler) SearchTasksHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	req := &pbTask.SearchTasksRequest{
+		UserId:    userId,
+		Query:     query.Get("q"),
+		PageToken: query.Get("page_token"),
+	}
+	if pageSize := query.Get("page_size"); pageSize != "" {
+		size, err := strconv.ParseInt(pageSize, 10, 32)
+		if err != nil || size < 0 {
+			log.ErrorLogger.Printf("Invalid page_size %q", pageSize)
+			http.Error(w, "Invalid query parameters", http.StatusBadRequest)
+			return
+		}
+		req.PageSize = int32(size)
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.SearchTasks(r.Context(), req)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to search tasks: %v", err)
+		http.Error(w, "Failed to search tasks", httpStatus(err))
+		return
+	}
+
+	response := models.SearchTasksResponse{
+		Results:       []models.SearchResult{},
+		NextPageToken: pbResponse.NextPageToken,
+	}
+	for _, result := range pbResponse.Results {
+		response.Results = append(response.Results, models.SearchResultFromPB(result))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Search tasks endpoint done successfully")
+}
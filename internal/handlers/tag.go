@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+
+	pbTask "github.com/damirbeybitov/todo_project/proto/task"
+)
+
+// @Summary Create tag
+// @Tags tag
+// @Description create a new tag
+// @ID create-tag
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.TagRequest true "Tag name"
+// @Success 200 {object} models.Tag
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {string} string "Tag already exists"
+// @Failure 500 {string} string "Internal server error"
+// @Router /tag/create-tag [post]
+func (h *Handler) CreateTagHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.CreateTag(r.Context(), &pbTask.CreateTagRequest{
+		UserId: userId,
+		Name:   req.Name,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to create tag: %v", err)
+		http.Error(w, "Failed to create tag", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.TagFromPB(pbResponse.Tag))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Create tag endpoint done successfully")
+}
+
+// @Summary Get tags
+// @Tags tag
+// @Description retrieve all tags of the user
+// @ID get-tags
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.GetTagsResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /tag/get-tags [get]
+func (h *Handler) GetTagsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.GetTags(r.Context(), &pbTask.GetTagsRequest{
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get tags: %v", err)
+		http.Error(w, "Failed to get tags", httpStatus(err))
+		return
+	}
+
+	var response models.GetTagsResponse
+	for _, tag := range pbResponse.Tags {
+		response.Tags = append(response.Tags, models.TagFromPB(tag))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get tags endpoint done successfully")
+}
+
+// @Summary Rename tag
+// @Tags tag
+// @Description rename a tag, tasks carrying it show the new name
+// @ID rename-tag
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Tag ID"
+// @Param body body models.TagRequest true "New tag name"
+// @Success 200 {object} models.Tag
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 409 {string} string "Tag already exists"
+// @Failure 500 {string} string "Internal server error"
+// @Router /tag/update-tag/{id} [put]
+func (h *Handler) RenameTagHandler(w http.ResponseWriter, r *http.Request) {
+	tagID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid tag ID: %v", err)
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.RenameTag(r.Context(), &pbTask.RenameTagRequest{
+		Id:     tagID,
+		UserId: userId,
+		Name:   req.Name,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to rename tag: %v", err)
+		http.Error(w, "Failed to rename tag", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.TagFromPB(pbResponse.Tag))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Rename tag endpoint done successfully")
+}
+
+// @Summary Delete tag
+// @Tags tag
+// @Description delete a tag and remove it from all tasks
+// @ID delete-tag
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Tag ID"
+// @Success 200 {object} models.DeleteTagResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /tag/delete-tag/{id} [delete]
+func (h *Handler) DeleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	tagID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid tag ID: %v", err)
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.DeleteTag(r.Context(), &pbTask.DeleteTagRequest{
+		Id:     tagID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete tag: %v", err)
+		http.Error(w, "Failed to delete tag", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.DeleteTagResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Delete tag endpoint done successfully")
+}
+
+// @Summary Attach tag
+// @Tags task
+// @Description put a tag on a task
+// @ID attach-tag
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Param tag_id path int true "Tag ID"
+// @Success 200 {object} models.Task
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/tags/{tag_id} [post]
+func (h *Handler) AttachTagHandler(w http.ResponseWriter, r *http.Request) {
+	h.taskTag(w, r, h.repo.MicroServiceClients.TaskClient.AttachTag)
+}
+
+// @Summary Detach tag
+// @Tags task
+// @Description take a tag off a task
+// @ID detach-tag
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Param tag_id path int true "Tag ID"
+// @Success 200 {object} models.Task
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/tags/{tag_id} [delete]
+func (h *Handler) DetachTagHandler(w http.ResponseWriter, r *http.Request) {
+	h.taskTag(w, r, h.repo.MicroServiceClients.TaskClient.DetachTag)
+}
+
+// taskTag handles both attaching and detaching a tag with the given RPC.
+func (h *Handler) taskTag(w http.ResponseWriter, r *http.Request, call func(context.Context, *pbTask.TaskTagRequest, ...grpc.CallOption) (*pbTask.TaskTagResponse, error)) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(mux.Vars(r)["tag_id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid tag ID: %v", err)
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := call(r.Context(), &pbTask.TaskTagRequest{
+		TaskId: taskID,
+		TagId:  tagID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to change task tags: %v", err)
+		http.Error(w, "Failed to change task tags", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.TaskFromPB(pbResponse.Task))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Task tag endpoint done successfully")
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pbTask "github.com/damirbeybitov/todo_project/proto/task"
+)
+
+const (
+	// maxImportBytes bounds the size of an imported file.
+	maxImportBytes = 10 << 20
+	// exportFlushEvery is the number of exported tasks written between flushes.
+	exportFlushEvery = 100
+)
+
+// transferContentTypes maps the export and import formats to their content types.
+var transferContentTypes = map[string]string{
+	"json": "application/json",
+	"csv":  "text/csv; charset=utf-8",
+	"ics":  "text/calendar; charset=utf-8",
+}
+
+// csvColumns are the columns of an exported CSV file. An imported file needs
+// a header naming its columns; only title is required, id, created_at and
+// updated_at are ignored.
+var csvColumns = []string{"id", "title", "description", "status", "priority", "due_at", "project_id", "tags", "recurrence", "created_at", "updated_at"}
+
+// importedRow is a task read from an imported file, or the error that made
+// the row unreadable.
+type importedRow struct {
+	task models.Task
+	err  error
+}
+
+// taskEncoder writes exported tasks in one of the formats.
+type taskEncoder interface {
+	Encode(task models.Task) error
+	// Close writes what follows the last task
+	Close() error
+}
+
+// @Summary Export tasks
+// @Tags task
+// @Description stream the tasks of the user that are not in the trash, oldest first, as a JSON array, a CSV file or an iCalendar file of VTODOs
+// @ID export-tasks
+// @Produce json
+// @Produce text/csv
+// @Produce text/calendar
+// @Security ApiKeyAuth
+// @Param format query string false "File format, json by default" Enums(json, csv, ics)
+// @Success 200 {array} models.Task
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/export [get]
+func (h *Handler) ExportTasksHandler(w http.ResponseWriter, r *http.Request) {
+	format, ok := transferFormat(r)
+	if !ok {
+		log.ErrorLogger.Printf("Invalid format: %s", r.URL.Query().Get("format"))
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	stream, err := h.repo.MicroServiceClients.TaskClient.ExportTasks(r.Context(), &pbTask.ExportTasksRequest{UserId: userId})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to export tasks: %v", err)
+		http.Error(w, "Failed to export tasks", httpStatus(err))
+		return
+	}
+
+	// The first message tells whether the export started at all, the status
+	// cannot change once the body is being written
+	first, err := stream.Recv()
+	if err != nil && err != io.EOF {
+		log.ErrorLogger.Printf("Failed to export tasks: %v", err)
+		http.Error(w, "Failed to export tasks", httpStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", transferContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"tasks.%s\"", format))
+	encoder := newTaskEncoder(format, w)
+	flusher, _ := w.(http.Flusher)
+
+	for count := 0; err == nil; count++ {
+		if err = encoder.Encode(models.TaskFromPB(first)); err != nil {
+			break
+		}
+		if flusher != nil && count%exportFlushEvery == exportFlushEvery-1 {
+			flusher.Flush()
+		}
+		first, err = stream.Recv()
+	}
+	if err != io.EOF {
+		log.ErrorLogger.Printf("Export of tasks interrupted: %v", err)
+		return
+	}
+	if err := encoder.Close(); err != nil {
+		log.ErrorLogger.Printf("Failed to finish export: %v", err)
+		return
+	}
+
+	log.InfoLogger.Print("Export tasks endpoint done successfully")
+}
+
+// @Summary Import tasks
+// @Tags task
+// @Description create tasks from a file in one of the export formats, in one transaction. A task that cannot be imported fails on its own and is reported with the HTTP status it would have got from the create endpoint. Imported tasks keep their status, priority, due date, project, tags and recurrence; tags the user does not have are created
+// @ID import-tasks
+// @Accept json
+// @Accept text/csv
+// @Accept text/calendar
+// @Produce json
+// @Security ApiKeyAuth
+// @Param format query string false "File format, json by default" Enums(json, csv, ics)
+// @Param dry_run query bool false "Check the tasks and report the results without saving anything"
+// @Param body body []models.Task true "File with the tasks, at most 1000 tasks and 10 MB"
+// @Success 200 {object} models.ImportTasksResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/import [post]
+func (h *Handler) ImportTasksHandler(w http.ResponseWriter, r *http.Request) {
+	format, ok := transferFormat(r)
+	if !ok {
+		log.ErrorLogger.Printf("Invalid format: %s", r.URL.Query().Get("format"))
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	var dryRun bool
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			log.ErrorLogger.Printf("Invalid dry_run %q", value)
+			http.Error(w, "Invalid query parameters", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := decodeTasks(format, http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid %s file: %v", format, err)
+		http.Error(w, fmt.Sprintf("Invalid %s file: %v", format, err), http.StatusBadRequest)
+		return
+	}
+
+	// Rows that could not be read are reported without reaching the service
+	response := models.ImportTasksResponse{DryRun: dryRun, Results: make([]models.BatchResult, len(rows))}
+	pbReq := &pbTask.ImportTasksRequest{UserId: userId, DryRun: dryRun}
+	var indexes []int
+	for i, row := range rows {
+		response.Results[i] = models.BatchResult{Index: int32(i), Status: http.StatusOK}
+		if row.err == nil {
+			row.err = checkImportedTask(row.task)
+		}
+		if row.err != nil {
+			response.Results[i].Status = http.StatusBadRequest
+			response.Results[i].Error = row.err.Error()
+			continue
+		}
+
+		pbReq.Tasks = append(pbReq.Tasks, models.TaskToPB(row.task))
+		indexes = append(indexes, i)
+	}
+
+	if len(pbReq.Tasks) > 0 {
+		pbResponse, err := h.repo.MicroServiceClients.TaskClient.ImportTasks(r.Context(), pbReq)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to import tasks: %v", err)
+			http.Error(w, "Failed to import tasks", httpStatus(err))
+			return
+		}
+
+		for j, pbResult := range pbResponse.Results {
+			result := &response.Results[indexes[j]]
+			result.Id = pbResult.Id
+			if code := codes.Code(pbResult.Code); code != codes.OK {
+				result.Status = httpStatus(status.Error(code, pbResult.Error))
+				result.Error = pbResult.Error
+			}
+			if pbResult.Task != nil {
+				task := models.TaskFromPB(pbResult.Task)
+				result.Task = &task
+			}
+		}
+	}
+
+	for _, result := range response.Results {
+		if result.Status == http.StatusOK {
+			response.Imported++
+		} else {
+			response.Failed++
+		}
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Import tasks endpoint done successfully")
+}
+
+// transferFormat returns the format query parameter, json when it is absent.
+// The second result is false for unknown formats.
+func transferFormat(r *http.Request) (string, bool) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "json"
+	}
+	_, ok := transferContentTypes[format]
+	return format, ok
+}
+
+// checkImportedTask returns an error if the status or priority of an imported
+// task is unknown; they would otherwise be lost on the way to the service.
+func checkImportedTask(task models.Task) error {
+	if _, ok := models.StatusToPB(task.Status); !ok {
+		return fmt.Errorf("invalid status %q", task.Status)
+	}
+	if _, ok := models.PriorityToPB(task.Priority); !ok {
+		return fmt.Errorf("invalid priority %q", task.Priority)
+	}
+	return nil
+}
+
+func newTaskEncoder(format string, w io.Writer) taskEncoder {
+	switch format {
+	case "csv":
+		return newCSVEncoder(w)
+	case "ics":
+		return newICalEncoder(w)
+	default:
+		return &jsonEncoder{w: w}
+	}
+}
+
+// decodeTasks reads the tasks of an imported file. Errors of single rows are
+// kept in their rows; the error returned means the file cannot be read.
+func decodeTasks(format string, r io.Reader) ([]importedRow, error) {
+	switch format {
+	case "csv":
+		return decodeCSV(r)
+	case "ics":
+		return decodeICal(r)
+	default:
+		return decodeJSON(r)
+	}
+}
+
+// jsonEncoder writes the tasks as the elements of a JSON array.
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) Encode(task models.Task) error {
+	taskJSON, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	separator := ","
+	if e.count == 0 {
+		separator = "["
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(taskJSON)
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "]"
+	if e.count == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// decodeJSON reads a JSON array of tasks.
+func decodeJSON(r io.Reader) ([]importedRow, error) {
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil {
+		return nil, err
+	} else if token != json.Delim('[') {
+		return nil, errors.New("expected an array of tasks")
+	}
+
+	var rows []importedRow
+	for decoder.More() {
+		// A malformed element breaks the file, a task of the wrong shape only its row
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		var row importedRow
+		row.err = json.Unmarshal(raw, &row.task)
+		rows = append(rows, row)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// csvEncoder writes the tasks as the rows of a CSV file with csvColumns.
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	encoder := &csvEncoder{w: csv.NewWriter(w)}
+	encoder.w.Write(csvColumns)
+	return encoder
+}
+
+func (e *csvEncoder) Encode(task models.Task) error {
+	var dueAt string
+	if task.DueAt != nil {
+		dueAt = task.DueAt.UTC().Format(time.RFC3339)
+	}
+	var projectID string
+	if task.ProjectId != 0 {
+		projectID = strconv.FormatInt(task.ProjectId, 10)
+	}
+
+	// Tag names contain no commas
+	return e.w.Write([]string{
+		strconv.FormatInt(task.Id, 10),
+		task.Title,
+		task.Description,
+		task.Status,
+		task.Priority,
+		dueAt,
+		projectID,
+		strings.Join(task.Tags, ","),
+		task.Recurrence,
+		task.CreatedAt.UTC().Format(time.RFC3339),
+		task.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// decodeCSV reads a CSV file whose first row names its columns.
+func decodeCSV(r io.Reader) ([]importedRow, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("missing header")
+	} else if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("missing title column")
+	}
+
+	var rows []importedRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		// A row with the wrong number of fields is still read
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, err
+		}
+
+		var row importedRow
+		if err != nil {
+			row.err = fmt.Errorf("row has %d fields, the header has %d", len(record), len(header))
+		} else {
+			row.task, row.err = csvTask(record, columns)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// csvTask builds a task from the fields of a CSV row.
+func csvTask(record []string, columns map[string]int) (models.Task, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	task := models.Task{
+		Title:       field("title"),
+		Description: field("description"),
+		Status:      field("status"),
+		Priority:    field("priority"),
+		Recurrence:  field("recurrence"),
+	}
+	if value := field("due_at"); value != "" {
+		dueAt, err := parseDueAt(value)
+		if err != nil {
+			return task, err
+		}
+		task.DueAt = &dueAt
+	}
+	if value := field("project_id"); value != "" {
+		projectID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || projectID < 0 {
+			return task, fmt.Errorf("invalid project_id %q", value)
+		}
+		task.ProjectId = projectID
+	}
+	if value := field("tags"); value != "" {
+		task.Tags = strings.Split(value, ",")
+	}
+
+	return task, nil
+}
+
+// parseDueAt parses an RFC 3339 time or a date, which means its midnight UTC.
+func parseDueAt(value string) (time.Time, error) {
+	if dueAt, err := time.Parse(time.RFC3339, value); err == nil {
+		return dueAt.UTC(), nil
+	}
+	if dueAt, err := time.Parse("2006-01-02", value); err == nil {
+		return dueAt, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid due_at %q", value)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/gorilla/mux"
+
+	pbTask "github.com/damirbeybitov/todo_project/proto/task"
+)
+
+// @Summary List trash
+// @Tags trash
+// @Description retrieve the deleted tasks the user may restore, most recently deleted first
+// @ID list-trash
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.ListTrashResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/trash [get]
+func (h *Handler) ListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.ListTrash(r.Context(), &pbTask.ListTrashRequest{
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get trash: %v", err)
+		http.Error(w, "Failed to get trash", httpStatus(err))
+		return
+	}
+
+	response := models.ListTrashResponse{Tasks: []models.Task{}}
+	for _, task := range pbResponse.Tasks {
+		response.Tasks = append(response.Tasks, models.TaskFromPB(task))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("List trash endpoint done successfully")
+}
+
+// @Summary Restore task
+// @Tags trash
+// @Description take a task out of the trash together with the subtasks deleted with it
+// @ID restore-task
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.Task
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/restore [post]
+func (h *Handler) RestoreTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.RestoreTask(r.Context(), &pbTask.RestoreTaskRequest{
+		Id:     taskID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to restore task: %v", err)
+		http.Error(w, "Failed to restore task", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.TaskFromPB(pbResponse.Task))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, pbResponse.Task.GetVersion())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Restore task endpoint done successfully")
+}
+
+// @Summary Purge task
+// @Tags trash
+// @Description delete a task in the trash for good, its history is kept
+// @ID purge-task
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.PurgeTaskResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/{id}/purge [delete]
+func (h *Handler) PurgeTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.PurgeTask(r.Context(), &pbTask.PurgeTaskRequest{
+		Id:     taskID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to purge task: %v", err)
+		http.Error(w, "Failed to purge task", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.PurgeTaskResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Purge task endpoint done successfully")
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+
+	pbTask "github.com/damirbeybitov/todo_project/proto/task"
+)
+
+// watchHeartbeat is how often an idle change feed sends a comment, so proxies
+// keep the connection open. The access token of the feed is checked again as
+// often, so the feed ends soon after the token expires or is revoked.
+const watchHeartbeat = 25 * time.Second
+
+// @Summary Watch tasks
+// @Tags task
+// @Description stream the changes of the tasks visible to the user as Server-Sent Events. Every event is named after its action (created, updated or deleted) and carries a models.TaskChange as JSON; a task that is no longer visible to the user is reported as deleted. Comments are sent while the feed is idle. The stream is closed once the access token expires or is revoked, and the client has to reconnect with a new token
+// @ID watch-tasks
+// @Produce text/event-stream
+// @Security ApiKeyAuth
+// @Success 200 {object} models.TaskChange
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /task/watch [get]
+func (h *Handler) WatchTasksHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.ErrorLogger.Print("Streaming is not supported by the response writer")
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	stream, err := h.repo.MicroServiceClients.TaskClient.WatchTasks(r.Context(), &pbTask.WatchTasksRequest{UserId: userId})
+	if err == nil {
+		// The headers arrive once the subscription is ready
+		_, err = stream.Header()
+	}
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to watch tasks: %v", err)
+		http.Error(w, "Failed to watch tasks", httpStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": watching\n\n")
+	flusher.Flush()
+
+	// Recv blocks, so the changes are read apart from the heartbeat
+	changes := make(chan *pbTask.TaskChange)
+	done := make(chan error, 1)
+	go func() {
+		for {
+			change, err := stream.Recv()
+			if err != nil {
+				done <- err
+				return
+			}
+			select {
+			case changes <- change:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.InfoLogger.Print("Watch tasks endpoint done successfully")
+			return
+		case err := <-done:
+			log.ErrorLogger.Printf("Task change feed ended: %v", err)
+			return
+		case <-heartbeat.C:
+			// The feed must not outlive the token it was opened with
+			if _, err := h.repo.GetIdentityFromRequest(r.Header.Get("Authorization")); err != nil {
+				log.InfoLogger.Printf("Task change feed closed for user ID %d: %v", userId, err)
+				return
+			}
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case pbChange := <-changes:
+			change := models.TaskChangeFromPB(pbChange)
+			changeJSON, err := json.Marshal(change)
+			if err != nil {
+				log.ErrorLogger.Printf("Failed to marshal task change: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", change.Action, changeJSON)
+		}
+		flusher.Flush()
+	}
+}
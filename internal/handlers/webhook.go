@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/gorilla/mux"
+
+	pbTask "github.com/damirbeybitov/todo_project/proto/task"
+)
+
+// @Summary Create webhook
+// @Tags webhook
+// @Description subscribe a URL to task events. Without a project the webhook receives the events of the tasks the caller created or is assigned; only the owner of a project may subscribe to its tasks. Every delivery is a JSON models.WebhookPayload POSTed with the X-Webhook-Event, X-Webhook-Delivery, X-Webhook-Timestamp and X-Webhook-Signature headers, the signature being "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>" under the secret. The URL may not point to a loopback, private or link-local address unless its host is allowed by the task service configuration. Deliveries that are not answered with 2xx are retried with exponential backoff and end in the dead letters. The secret is only returned here
+// @ID create-webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.WebhookRequest true "Webhook"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal server error"
+// @Router /webhook/create-webhook [post]
+func (h *Handler) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := webhookToPB(req)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid webhook: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.CreateWebhook(r.Context(), &pbTask.CreateWebhookRequest{
+		UserId:  userId,
+		Webhook: webhook,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to create webhook: %v", err)
+		http.Error(w, "Failed to create webhook", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.WebhookFromPB(pbResponse.Webhook))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Create webhook endpoint done successfully")
+}
+
+// @Summary Get webhooks
+// @Tags webhook
+// @Description get the webhooks of the caller, without their secrets
+// @ID get-webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.ListWebhooksResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Router /webhook/get-webhooks [get]
+func (h *Handler) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.ListWebhooks(r.Context(), &pbTask.ListWebhooksRequest{UserId: userId})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get webhooks: %v", err)
+		http.Error(w, "Failed to get webhooks", httpStatus(err))
+		return
+	}
+
+	response := models.ListWebhooksResponse{Webhooks: []models.Webhook{}}
+	for _, webhook := range pbResponse.Webhooks {
+		response.Webhooks = append(response.Webhooks, models.WebhookFromPB(webhook))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get webhooks endpoint done successfully")
+}
+
+// @Summary Update webhook
+// @Tags webhook
+// @Description change the URL, events or secret of a webhook of the caller. The project of a webhook does not change and an empty secret keeps the current one
+// @ID update-webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Param body body models.WebhookRequest true "Webhook"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /webhook/update-webhook/{id} [put]
+func (h *Handler) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid webhook ID: %v", err)
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.ErrorLogger.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := webhookToPB(req)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid webhook: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	webhook.Id = webhookID
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.UpdateWebhook(r.Context(), &pbTask.UpdateWebhookRequest{
+		UserId:  userId,
+		Webhook: webhook,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to update webhook: %v", err)
+		http.Error(w, "Failed to update webhook", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.WebhookFromPB(pbResponse.Webhook))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Update webhook endpoint done successfully")
+}
+
+// @Summary Delete webhook
+// @Tags webhook
+// @Description delete a webhook of the caller with its queued and dead deliveries
+// @ID delete-webhook
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.DeleteWebhookResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /webhook/delete-webhook/{id} [delete]
+func (h *Handler) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid webhook ID: %v", err)
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.DeleteWebhook(r.Context(), &pbTask.DeleteWebhookRequest{
+		Id:     webhookID,
+		UserId: userId,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete webhook: %v", err)
+		http.Error(w, "Failed to delete webhook", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.DeleteWebhookResponse{Message: pbResponse.Message})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Delete webhook endpoint done successfully")
+}
+
+// @Summary Get dead letters
+// @Tags webhook
+// @Description get the deliveries of a webhook of the caller that failed every attempt, newest first
+// @ID get-webhook-dead-letters
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.ListDeadDeliveriesResponse
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /webhook/{id}/dead-letters [get]
+func (h *Handler) GetDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid webhook ID: %v", err)
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.ListDeadDeliveries(r.Context(), &pbTask.ListDeadDeliveriesRequest{
+		UserId:    userId,
+		WebhookId: webhookID,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get dead letters: %v", err)
+		http.Error(w, "Failed to get dead letters", httpStatus(err))
+		return
+	}
+
+	response := models.ListDeadDeliveriesResponse{Deliveries: []models.WebhookDelivery{}}
+	for _, delivery := range pbResponse.Deliveries {
+		response.Deliveries = append(response.Deliveries, models.WebhookDeliveryFromPB(delivery))
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Get dead letters endpoint done successfully")
+}
+
+// @Summary Redeliver dead letter
+// @Tags webhook
+// @Description queue a dead delivery of a webhook of the caller again, with all of its attempts
+// @ID redeliver-webhook
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Param delivery_id path int true "Delivery ID"
+// @Success 200 {object} models.WebhookDelivery
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not found"
+// @Failure 500 {string} string "Internal server error"
+// @Router /webhook/{id}/deliveries/{delivery_id}/redeliver [post]
+func (h *Handler) RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid webhook ID: %v", err)
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(mux.Vars(r)["delivery_id"], 10, 64)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid delivery ID: %v", err)
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserId(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pbResponse, err := h.repo.MicroServiceClients.TaskClient.RedeliverWebhook(r.Context(), &pbTask.RedeliverWebhookRequest{
+		UserId:     userId,
+		WebhookId:  webhookID,
+		DeliveryId: deliveryID,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to redeliver webhook: %v", err)
+		http.Error(w, "Failed to redeliver webhook", httpStatus(err))
+		return
+	}
+
+	responseJSON, err := json.Marshal(models.WebhookDeliveryFromPB(pbResponse.Delivery))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal response: %v", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+	log.InfoLogger.Print("Redeliver webhook endpoint done successfully")
+}
+
+// webhookToPB converts the request body to a webhook message, rejecting
+// unknown events.
+func webhookToPB(req models.WebhookRequest) (*pbTask.Webhook, error) {
+	webhook := &pbTask.Webhook{
+		ProjectId: req.ProjectId,
+		Url:       req.Url,
+		Secret:    req.Secret,
+	}
+	for _, event := range req.Events {
+		action, ok := models.EventActionToPB(event)
+		if !ok {
+			return nil, fmt.Errorf("invalid event %q", event)
+		}
+		webhook.Events = append(webhook.Events, action)
+	}
+	return webhook, nil
+}
@@ -1,27 +1,702 @@
 package models
 
 import (
+	"encoding/json"
+	"time"
+
 	pbAuth "github.com/damirbeybitov/todo_project/proto/auth"
+	pbProject "github.com/damirbeybitov/todo_project/proto/project"
 	pbTask "github.com/damirbeybitov/todo_project/proto/task"
 	pbUser "github.com/damirbeybitov/todo_project/proto/user"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Config struct {
 	SqlConnection string `json:"sqlConnection"`
+	// TaskTransitions maps a task status to the statuses it may move to.
+	// The default workflow is used when it is empty.
+	TaskTransitions map[string][]string `json:"taskTransitions"`
+	// RecurrenceCheckSeconds is how often the task service looks for recurring
+	// tasks whose time arrived. One minute is used when it is zero.
+	RecurrenceCheckSeconds int `json:"recurrenceCheckSeconds"`
+	// TrashRetentionDays is how long deleted tasks stay in the trash before
+	// they are purged. Thirty days are used when it is zero.
+	TrashRetentionDays int `json:"trashRetentionDays"`
+	// WebhookDispatchSeconds is how often the task service sends the queued
+	// webhook deliveries. Five seconds are used when it is zero.
+	WebhookDispatchSeconds int `json:"webhookDispatchSeconds"`
+	// WebhookAllowedHosts are the hosts in local and private networks that
+	// webhooks may deliver to. Other targets in such networks are rejected.
+	WebhookAllowedHosts []string `json:"webhookAllowedHosts"`
+	// TokenKeys are the keys that sign and verify access and refresh tokens.
+	TokenKeys TokenKeysConfig `json:"tokenKeys"`
+}
+
+type TokenKeysConfig struct {
+	// SigningKey is the id of the key new tokens are signed with, the other
+	// keys only verify tokens. The TOKEN_SIGNING_KEY environment variable
+	// overrides it.
+	SigningKey string           `json:"signingKey"`
+	Keys       []TokenKeyConfig `json:"keys"`
+}
+
+type TokenKeyConfig struct {
+	// Id is sent in the kid header of the tokens signed with the key.
+	Id string `json:"id"`
+	// Algorithm is HS256, RS256 or EdDSA.
+	Algorithm string `json:"algorithm"`
+	// Secret is the key of HS256. PrivateKey and PublicKey are the PEM keys
+	// of RS256 and EdDSA; a key that only verifies tokens needs only the
+	// public one. Each is given inline, as "env:NAME" to read an environment
+	// variable or as "file:PATH" to read a file.
+	Secret     string `json:"secret"`
+	PrivateKey string `json:"privateKey"`
+	PublicKey  string `json:"publicKey"`
+}
+
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+const (
+	StatusTodo       = "todo"
+	StatusInProgress = "in_progress"
+	StatusBlocked    = "blocked"
+	StatusDone       = "done"
+	StatusCancelled  = "cancelled"
+)
+
+var statusToPB = map[string]pbTask.TaskStatus{
+	"":               pbTask.TaskStatus_TASK_STATUS_UNSPECIFIED,
+	StatusTodo:       pbTask.TaskStatus_TASK_STATUS_TODO,
+	StatusInProgress: pbTask.TaskStatus_TASK_STATUS_IN_PROGRESS,
+	StatusBlocked:    pbTask.TaskStatus_TASK_STATUS_BLOCKED,
+	StatusDone:       pbTask.TaskStatus_TASK_STATUS_DONE,
+	StatusCancelled:  pbTask.TaskStatus_TASK_STATUS_CANCELLED,
+}
+
+var priorityToPB = map[string]pbTask.Priority{
+	"":             pbTask.Priority_PRIORITY_UNSPECIFIED,
+	PriorityLow:    pbTask.Priority_PRIORITY_LOW,
+	PriorityMedium: pbTask.Priority_PRIORITY_MEDIUM,
+	PriorityHigh:   pbTask.Priority_PRIORITY_HIGH,
+	PriorityUrgent: pbTask.Priority_PRIORITY_URGENT,
 }
 
 type Task struct {
-	Id          int64  `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Status      bool   `json:"status"`
-	UserId      int64  `json:"user_id"`
+	Id          int64      `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status" enums:"todo,in_progress,blocked,done,cancelled"`
+	UserId      int64      `json:"user_id"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Priority    string     `json:"priority" enums:"low,medium,high,urgent"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ParentId    int64      `json:"parent_id,omitempty"`
+	ProjectId   int64      `json:"project_id,omitempty"`
+	AssigneeId  int64      `json:"assignee_id,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=MO"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	// Version grows with every change of the task and is its ETag
+	Version int64 `json:"version"`
+}
+
+// StatusToPB converts a status name to its protobuf value.
+// The second result is false for unknown names.
+func StatusToPB(status string) (pbTask.TaskStatus, bool) {
+	st, ok := statusToPB[status]
+	return st, ok
+}
+
+// StatusFromPB converts a protobuf status to its name.
+// Unspecified statuses are reported as an empty string.
+func StatusFromPB(status pbTask.TaskStatus) string {
+	for name, st := range statusToPB {
+		if st == status {
+			return name
+		}
+	}
+	return ""
+}
+
+// PriorityToPB converts a priority name to its protobuf value.
+// The second result is false for unknown names.
+func PriorityToPB(priority string) (pbTask.Priority, bool) {
+	p, ok := priorityToPB[priority]
+	return p, ok
+}
+
+// PriorityFromPB converts a protobuf priority to its name.
+// Unspecified priorities are reported as medium.
+func PriorityFromPB(priority pbTask.Priority) string {
+	for name, p := range priorityToPB {
+		if p == priority && name != "" {
+			return name
+		}
+	}
+	return PriorityMedium
+}
+
+// TaskToPB converts a task to its protobuf message.
+func TaskToPB(task Task) *pbTask.Task {
+	priority, _ := PriorityToPB(task.Priority)
+	status, _ := StatusToPB(task.Status)
+	pb := &pbTask.Task{
+		Id:          task.Id,
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      status,
+		UserId:      task.UserId,
+		Priority:    priority,
+		ParentId:    task.ParentId,
+		ProjectId:   task.ProjectId,
+		AssigneeId:  task.AssigneeId,
+		Tags:        task.Tags,
+		Recurrence:  task.Recurrence,
+		Version:     task.Version,
+	}
+	if task.DueAt != nil {
+		pb.DueAt = timestamppb.New(*task.DueAt)
+	}
+	if !task.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(task.CreatedAt)
+	}
+	if !task.UpdatedAt.IsZero() {
+		pb.UpdatedAt = timestamppb.New(task.UpdatedAt)
+	}
+	if task.DeletedAt != nil {
+		pb.DeletedAt = timestamppb.New(*task.DeletedAt)
+	}
+	return pb
+}
+
+// TaskFromPB converts a protobuf message to a task.
+func TaskFromPB(pb *pbTask.Task) Task {
+	task := Task{
+		Id:          pb.Id,
+		Title:       pb.Title,
+		Description: pb.Description,
+		Status:      StatusFromPB(pb.Status),
+		UserId:      pb.UserId,
+		Priority:    PriorityFromPB(pb.Priority),
+		ParentId:    pb.ParentId,
+		ProjectId:   pb.ProjectId,
+		AssigneeId:  pb.AssigneeId,
+		Tags:        pb.Tags,
+		Recurrence:  pb.Recurrence,
+		Version:     pb.Version,
+	}
+	if pb.DueAt != nil {
+		dueAt := pb.DueAt.AsTime()
+		task.DueAt = &dueAt
+	}
+	if pb.CreatedAt != nil {
+		task.CreatedAt = pb.CreatedAt.AsTime()
+	}
+	if pb.UpdatedAt != nil {
+		task.UpdatedAt = pb.UpdatedAt.AsTime()
+	}
+	if pb.DeletedAt != nil {
+		deletedAt := pb.DeletedAt.AsTime()
+		task.DeletedAt = &deletedAt
+	}
+	return task
+}
+
+type SearchHighlight struct {
+	// Field is title, description, tag or comment
+	Field string `json:"field" enums:"title,description,tag,comment"`
+	// Snippet is HTML-escaped text with the matches wrapped in <mark>
+	Snippet string `json:"snippet"`
+}
+
+type SearchResult struct {
+	Task       Task              `json:"task"`
+	Score      float64           `json:"score"`
+	Highlights []SearchHighlight `json:"highlights"`
+}
+
+// SearchResultToPB converts a search result to its protobuf message.
+func SearchResultToPB(result SearchResult) *pbTask.SearchResult {
+	pb := &pbTask.SearchResult{
+		Task:  TaskToPB(result.Task),
+		Score: result.Score,
+	}
+	for _, highlight := range result.Highlights {
+		pb.Highlights = append(pb.Highlights, &pbTask.SearchHighlight{Field: highlight.Field, Snippet: highlight.Snippet})
+	}
+	return pb
+}
+
+// SearchResultFromPB converts a protobuf message to a search result.
+func SearchResultFromPB(pb *pbTask.SearchResult) SearchResult {
+	result := SearchResult{
+		Task:       TaskFromPB(pb.Task),
+		Score:      pb.Score,
+		Highlights: []SearchHighlight{},
+	}
+	for _, highlight := range pb.Highlights {
+		result.Highlights = append(result.Highlights, SearchHighlight{Field: highlight.Field, Snippet: highlight.Snippet})
+	}
+	return result
+}
+
+// Occurrence is a task of a recurring series together with its place in the series.
+type Occurrence struct {
+	Task     Task
+	SeriesId int64
+	// At is the moment the occurrence is scheduled for, the due date it was created with
+	At time.Time
+}
+
+type TaskFilter struct {
+	PageSize   int32
+	PageToken  string
+	Status     string
+	Query      string
+	SortBy     string
+	SortDesc   bool
+	ProjectId  int64
+	AssigneeId int64
+	// Tags lists the tag names a task must all have
+	Tags []string
+}
+
+type Tag struct {
+	Id     int64  `json:"id"`
+	Name   string `json:"name"`
+	UserId int64  `json:"user_id"`
+}
+
+// TagToPB converts a tag to its protobuf message.
+func TagToPB(tag Tag) *pbTask.Tag {
+	return &pbTask.Tag{
+		Id:     tag.Id,
+		Name:   tag.Name,
+		UserId: tag.UserId,
+	}
+}
+
+// TagFromPB converts a protobuf message to a tag.
+func TagFromPB(pb *pbTask.Tag) Tag {
+	return Tag{
+		Id:     pb.Id,
+		Name:   pb.Name,
+		UserId: pb.UserId,
+	}
+}
+
+type Comment struct {
+	Id        int64     `json:"id"`
+	TaskId    int64     `json:"task_id"`
+	AuthorId  int64     `json:"author_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CommentToPB converts a comment to its protobuf message.
+func CommentToPB(comment Comment) *pbTask.Comment {
+	pb := &pbTask.Comment{
+		Id:       comment.Id,
+		TaskId:   comment.TaskId,
+		AuthorId: comment.AuthorId,
+		Body:     comment.Body,
+	}
+	if !comment.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(comment.CreatedAt)
+	}
+	if !comment.UpdatedAt.IsZero() {
+		pb.UpdatedAt = timestamppb.New(comment.UpdatedAt)
+	}
+	return pb
+}
+
+// CommentFromPB converts a protobuf message to a comment.
+func CommentFromPB(pb *pbTask.Comment) Comment {
+	comment := Comment{
+		Id:       pb.Id,
+		TaskId:   pb.TaskId,
+		AuthorId: pb.AuthorId,
+		Body:     pb.Body,
+	}
+	if pb.CreatedAt != nil {
+		comment.CreatedAt = pb.CreatedAt.AsTime()
+	}
+	if pb.UpdatedAt != nil {
+		comment.UpdatedAt = pb.UpdatedAt.AsTime()
+	}
+	return comment
+}
+
+const (
+	EventCreated  = "created"
+	EventUpdated  = "updated"
+	EventDeleted  = "deleted"
+	EventRestored = "restored"
+	EventPurged   = "purged"
+)
+
+var eventActionToPB = map[string]pbTask.TaskEventAction{
+	"":            pbTask.TaskEventAction_TASK_EVENT_ACTION_UNSPECIFIED,
+	EventCreated:  pbTask.TaskEventAction_TASK_EVENT_ACTION_CREATED,
+	EventUpdated:  pbTask.TaskEventAction_TASK_EVENT_ACTION_UPDATED,
+	EventDeleted:  pbTask.TaskEventAction_TASK_EVENT_ACTION_DELETED,
+	EventRestored: pbTask.TaskEventAction_TASK_EVENT_ACTION_RESTORED,
+	EventPurged:   pbTask.TaskEventAction_TASK_EVENT_ACTION_PURGED,
+}
+
+// FieldChange is the change of one task field. Empty values stand for unset fields.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type TaskEvent struct {
+	Id     int64 `json:"id"`
+	TaskId int64 `json:"task_id"`
+	// UserId is the user who made the change, zero for changes made by the service
+	UserId    int64         `json:"user_id"`
+	Action    string        `json:"action" enums:"created,updated,deleted,restored,purged"`
+	Changes   []FieldChange `json:"changes"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// TaskEventToPB converts a task event to its protobuf message.
+func TaskEventToPB(event TaskEvent) *pbTask.TaskEvent {
+	pb := &pbTask.TaskEvent{
+		Id:     event.Id,
+		TaskId: event.TaskId,
+		UserId: event.UserId,
+		Action: eventActionToPB[event.Action],
+	}
+	for _, change := range event.Changes {
+		pb.Changes = append(pb.Changes, &pbTask.FieldChange{Field: change.Field, From: change.From, To: change.To})
+	}
+	if !event.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(event.CreatedAt)
+	}
+	return pb
+}
+
+// TaskEventFromPB converts a protobuf message to a task event.
+func TaskEventFromPB(pb *pbTask.TaskEvent) TaskEvent {
+	event := TaskEvent{
+		Id:      pb.Id,
+		TaskId:  pb.TaskId,
+		UserId:  pb.UserId,
+		Changes: []FieldChange{},
+	}
+	for name, action := range eventActionToPB {
+		if action == pb.Action {
+			event.Action = name
+		}
+	}
+	for _, change := range pb.Changes {
+		event.Changes = append(event.Changes, FieldChange{Field: change.Field, From: change.From, To: change.To})
+	}
+	if pb.CreatedAt != nil {
+		event.CreatedAt = pb.CreatedAt.AsTime()
+	}
+	return event
+}
+
+var changeActionToPB = map[string]pbTask.TaskChangeAction{
+	"":           pbTask.TaskChangeAction_TASK_CHANGE_ACTION_UNSPECIFIED,
+	EventCreated: pbTask.TaskChangeAction_TASK_CHANGE_ACTION_CREATED,
+	EventUpdated: pbTask.TaskChangeAction_TASK_CHANGE_ACTION_UPDATED,
+	EventDeleted: pbTask.TaskChangeAction_TASK_CHANGE_ACTION_DELETED,
+}
+
+// TaskChange tells a watcher that a task it can see changed.
+type TaskChange struct {
+	// Action is deleted also when the task is no longer visible to the watcher
+	Action string `json:"action" enums:"created,updated,deleted"`
+	TaskId int64  `json:"task_id"`
+	// Task is the task after the change, absent when it was deleted
+	Task *Task `json:"task,omitempty"`
+}
+
+// TaskChangeToPB converts a task change to its protobuf message.
+func TaskChangeToPB(change TaskChange) *pbTask.TaskChange {
+	pb := &pbTask.TaskChange{
+		Action: changeActionToPB[change.Action],
+		TaskId: change.TaskId,
+	}
+	if change.Task != nil {
+		pb.Task = TaskToPB(*change.Task)
+	}
+	return pb
+}
+
+// TaskChangeFromPB converts a protobuf message to a task change.
+func TaskChangeFromPB(pb *pbTask.TaskChange) TaskChange {
+	change := TaskChange{TaskId: pb.TaskId}
+	for name, action := range changeActionToPB {
+		if action == pb.Action {
+			change.Action = name
+		}
+	}
+	if pb.Task != nil {
+		task := TaskFromPB(pb.Task)
+		change.Task = &task
+	}
+	return change
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type Webhook struct {
+	Id     int64 `json:"id"`
+	UserId int64 `json:"user_id"`
+	// ProjectId is the project whose task events the webhook receives, zero
+	// for the tasks its user created or is assigned
+	ProjectId int64  `json:"project_id,omitempty"`
+	Url       string `json:"url"`
+	// Secret signs the deliveries, it is only returned when the webhook is created
+	Secret string `json:"secret,omitempty"`
+	// Events are the task event actions the webhook receives, all when empty
+	Events    []string  `json:"events" enums:"created,updated,deleted,restored,purged"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookToPB converts a webhook to its protobuf message.
+func WebhookToPB(webhook Webhook) *pbTask.Webhook {
+	pb := &pbTask.Webhook{
+		Id:        webhook.Id,
+		UserId:    webhook.UserId,
+		ProjectId: webhook.ProjectId,
+		Url:       webhook.Url,
+		Secret:    webhook.Secret,
+	}
+	for _, event := range webhook.Events {
+		pb.Events = append(pb.Events, eventActionToPB[event])
+	}
+	if !webhook.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(webhook.CreatedAt)
+	}
+	return pb
+}
+
+// WebhookFromPB converts a protobuf message to a webhook.
+func WebhookFromPB(pb *pbTask.Webhook) Webhook {
+	webhook := Webhook{
+		Id:        pb.Id,
+		UserId:    pb.UserId,
+		ProjectId: pb.ProjectId,
+		Url:       pb.Url,
+		Secret:    pb.Secret,
+		Events:    []string{},
+	}
+	for _, event := range pb.Events {
+		webhook.Events = append(webhook.Events, eventActionFromPB(event))
+	}
+	if pb.CreatedAt != nil {
+		webhook.CreatedAt = pb.CreatedAt.AsTime()
+	}
+	return webhook
+}
+
+// EventActionToPB converts a task event action to its protobuf value.
+// The second result is false for unknown actions.
+func EventActionToPB(action string) (pbTask.TaskEventAction, bool) {
+	pb, ok := eventActionToPB[action]
+	return pb, ok && action != ""
+}
+
+func eventActionFromPB(action pbTask.TaskEventAction) string {
+	for name, pb := range eventActionToPB {
+		if pb == action {
+			return name
+		}
+	}
+	return ""
+}
+
+// WebhookPayload is the body of a webhook delivery.
+type WebhookPayload struct {
+	// Event is the task event action prefixed with "task."
+	Event   string `json:"event" example:"task.updated"`
+	EventId int64  `json:"event_id"`
+	TaskId  int64  `json:"task_id"`
+	// UserId is the user who made the change, zero for changes made by the service
+	UserId  int64         `json:"user_id"`
+	Changes []FieldChange `json:"changes"`
+	// Task is the task after the change
+	Task      Task      `json:"task"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	Id        int64  `json:"id"`
+	WebhookId int64  `json:"webhook_id"`
+	EventId   int64  `json:"event_id"`
+	Action    string `json:"action" enums:"created,updated,deleted,restored,purged"`
+	// Payload is the body of the delivery
+	Payload       json.RawMessage `json:"payload" swaggertype:"object"`
+	Status        string          `json:"status" enums:"pending,delivered,dead"`
+	Attempts      int32           `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// WebhookDeliveryToPB converts a webhook delivery to its protobuf message.
+func WebhookDeliveryToPB(delivery WebhookDelivery) *pbTask.WebhookDelivery {
+	pb := &pbTask.WebhookDelivery{
+		Id:        delivery.Id,
+		WebhookId: delivery.WebhookId,
+		EventId:   delivery.EventId,
+		Action:    eventActionToPB[delivery.Action],
+		Payload:   string(delivery.Payload),
+		Status:    delivery.Status,
+		Attempts:  delivery.Attempts,
+		LastError: delivery.LastError,
+	}
+	if !delivery.NextAttemptAt.IsZero() {
+		pb.NextAttemptAt = timestamppb.New(delivery.NextAttemptAt)
+	}
+	if !delivery.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(delivery.CreatedAt)
+	}
+	return pb
+}
+
+// WebhookDeliveryFromPB converts a protobuf message to a webhook delivery.
+func WebhookDeliveryFromPB(pb *pbTask.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		Id:        pb.Id,
+		WebhookId: pb.WebhookId,
+		EventId:   pb.EventId,
+		Action:    eventActionFromPB(pb.Action),
+		Payload:   json.RawMessage(pb.Payload),
+		Status:    pb.Status,
+		Attempts:  pb.Attempts,
+		LastError: pb.LastError,
+	}
+	if pb.NextAttemptAt != nil {
+		delivery.NextAttemptAt = pb.NextAttemptAt.AsTime()
+	}
+	if pb.CreatedAt != nil {
+		delivery.CreatedAt = pb.CreatedAt.AsTime()
+	}
+	return delivery
+}
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var roleToPB = map[string]pbProject.ProjectRole{
+	"":         pbProject.ProjectRole_PROJECT_ROLE_UNSPECIFIED,
+	RoleOwner:  pbProject.ProjectRole_PROJECT_ROLE_OWNER,
+	RoleEditor: pbProject.ProjectRole_PROJECT_ROLE_EDITOR,
+	RoleViewer: pbProject.ProjectRole_PROJECT_ROLE_VIEWER,
+}
+
+// RoleToPB converts a project role name to its protobuf value.
+// The second result is false for unknown names.
+func RoleToPB(role string) (pbProject.ProjectRole, bool) {
+	r, ok := roleToPB[role]
+	return r, ok
+}
+
+// RoleFromPB converts a protobuf project role to its name.
+// Unspecified roles are reported as an empty string.
+func RoleFromPB(role pbProject.ProjectRole) string {
+	for name, r := range roleToPB {
+		if r == role {
+			return name
+		}
+	}
+	return ""
+}
+
+type Project struct {
+	Id          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	UserId      int64     `json:"user_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ProjectToPB converts a project to its protobuf message.
+func ProjectToPB(project Project) *pbProject.Project {
+	pb := &pbProject.Project{
+		Id:          project.Id,
+		Name:        project.Name,
+		Description: project.Description,
+		UserId:      project.UserId,
+	}
+	if !project.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(project.CreatedAt)
+	}
+	if !project.UpdatedAt.IsZero() {
+		pb.UpdatedAt = timestamppb.New(project.UpdatedAt)
+	}
+	return pb
+}
+
+// ProjectFromPB converts a protobuf message to a project.
+func ProjectFromPB(pb *pbProject.Project) Project {
+	project := Project{
+		Id:          pb.Id,
+		Name:        pb.Name,
+		Description: pb.Description,
+		UserId:      pb.UserId,
+	}
+	if pb.CreatedAt != nil {
+		project.CreatedAt = pb.CreatedAt.AsTime()
+	}
+	if pb.UpdatedAt != nil {
+		project.UpdatedAt = pb.UpdatedAt.AsTime()
+	}
+	return project
+}
+
+type ProjectMember struct {
+	UserId   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role" enums:"owner,editor,viewer"`
+}
+
+// ProjectMemberToPB converts a project member to its protobuf message.
+func ProjectMemberToPB(member ProjectMember) *pbProject.ProjectMember {
+	role, _ := RoleToPB(member.Role)
+	return &pbProject.ProjectMember{
+		UserId:   member.UserId,
+		Username: member.Username,
+		Role:     role,
+	}
+}
+
+// ProjectMemberFromPB converts a protobuf message to a project member.
+func ProjectMemberFromPB(pb *pbProject.ProjectMember) ProjectMember {
+	return ProjectMember{
+		UserId:   pb.UserId,
+		Username: pb.Username,
+		Role:     RoleFromPB(pb.Role),
+	}
 }
 
 type MicroServiceClients struct {
-	UserClient pbUser.UserServiceClient
-	AuthClient pbAuth.AuthServiceClient
-	TaskClient pbTask.TaskServiceClient
+	UserClient    pbUser.UserServiceClient
+	AuthClient    pbAuth.AuthServiceClient
+	TaskClient    pbTask.TaskServiceClient
+	ProjectClient pbProject.ProjectServiceClient
 }
 
 type RegisterRequest struct {
@@ -50,6 +725,34 @@ type RefreshTokenRequest struct {
 
 type RefreshTokenResponse struct {
 	AccessToken string `json:"access_token"`
+	// RefreshToken replaces the refresh token of the request, which is no longer valid
+	RefreshToken string `json:"refresh_token"`
+}
+
+// JWK is a public key that verifies tokens (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty" example:"RSA"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg" example:"RS256"`
+	Use string `json:"use" example:"sig"`
+	// Crv and X are the curve and public key of OKP keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutResponse struct {
+	Message string `json:"message"`
 }
 
 type GetUserProfileRequest struct {
@@ -70,10 +773,66 @@ type DeleteUserResponse struct {
 	Message string `json:"message"`
 }
 
+// UserAccount is a user as admins see it. Roles are the ones granted on top
+// of the user role every user has.
+type UserAccount struct {
+	Id       int64    `json:"id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles"`
+	Disabled bool     `json:"disabled"`
+}
+
+// UserAccountToPB converts a user account to its protobuf message.
+func UserAccountToPB(account UserAccount) *pbUser.User {
+	return &pbUser.User{
+		Id:       account.Id,
+		Username: account.Username,
+		Email:    account.Email,
+		Roles:    account.Roles,
+		Disabled: account.Disabled,
+	}
+}
+
+// UserAccountFromPB converts a protobuf message to a user account.
+func UserAccountFromPB(pb *pbUser.User) UserAccount {
+	account := UserAccount{
+		Id:       pb.Id,
+		Username: pb.Username,
+		Email:    pb.Email,
+		Roles:    []string{},
+		Disabled: pb.Disabled,
+	}
+	account.Roles = append(account.Roles, pb.Roles...)
+	return account
+}
+
+type ListUsersResponse struct {
+	Users         []UserAccount `json:"users"`
+	NextPageToken string        `json:"next_page_token,omitempty"`
+}
+
+type SetUserDisabledResponse struct {
+	Message string `json:"message"`
+}
+
+type ResetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+type ResetPasswordResponse struct {
+	Message string `json:"message"`
+}
+
 type CreateTaskRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	UserId      int64  `json:"user_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Priority    string     `json:"priority,omitempty" enums:"low,medium,high,urgent"`
+	ParentId    int64      `json:"parent_id,omitempty"`
+	ProjectId   int64      `json:"project_id,omitempty"`
+	// Recurrence is daily, weekly, monthly or an RRULE subset; it needs a due date
+	Recurrence string `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=MO"`
 }
 
 type CreateTaskResponse struct {
@@ -81,23 +840,173 @@ type CreateTaskResponse struct {
 }
 
 type GetTasksResponse struct {
-	Tasks []Task `json:"tasks"`
+	Tasks         []Task `json:"tasks"`
+	NextPageToken string `json:"next_page_token,omitempty"`
 }
 
 type UpdateTaskRequest struct {
-	Id          int64  `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Status      bool   `json:"status"`
-	UserId      int64  `json:"user_id"`
+	Id          int64      `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status,omitempty" enums:"todo,in_progress,blocked,done,cancelled"`
+	UserId      int64      `json:"user_id"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Priority    string     `json:"priority,omitempty" enums:"low,medium,high,urgent"`
+	ProjectId   int64      `json:"project_id,omitempty"`
+	// Recurrence is daily, weekly, monthly or an RRULE subset; it needs a due date
+	Recurrence string `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=MO"`
+}
+
+// PatchTaskRequest changes only the fields present in the body; a null
+// due_at clears the due date.
+type PatchTaskRequest struct {
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Status      string     `json:"status,omitempty" enums:"todo,in_progress,blocked,done,cancelled"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Priority    string     `json:"priority,omitempty" enums:"low,medium,high,urgent"`
+	ProjectId   int64      `json:"project_id,omitempty"`
+	// Recurrence is daily, weekly, monthly or an RRULE subset; it needs a due date
+	Recurrence string `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=MO"`
 }
 
 type UpdateTaskResponse struct {
-	Id          int64  `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Status      bool   `json:"status"`
-	UserId      int64  `json:"user_id"`
+	Id          int64      `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status" enums:"todo,in_progress,blocked,done,cancelled"`
+	UserId      int64      `json:"user_id"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Priority    string     `json:"priority" enums:"low,medium,high,urgent"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ParentId    int64      `json:"parent_id,omitempty"`
+	ProjectId   int64      `json:"project_id,omitempty"`
+	AssigneeId  int64      `json:"assignee_id,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=MO"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Version     int64      `json:"version"`
+}
+
+type GetSubtasksResponse struct {
+	Tasks             []Task `json:"tasks"`
+	CompletionPercent int32  `json:"completion_percent"`
+}
+
+type MoveTaskRequest struct {
+	ParentId int64 `json:"parent_id"`
+}
+
+type AssignTaskRequest struct {
+	// Username of the new assignee, empty to unassign the task
+	Username string `json:"username"`
+}
+
+type TagRequest struct {
+	Name string `json:"name"`
+}
+
+type GetTagsResponse struct {
+	Tags []Tag `json:"tags"`
+}
+
+type DeleteTagResponse struct {
+	Message string `json:"message"`
+}
+
+type CommentRequest struct {
+	Body string `json:"body"`
+}
+
+type ListCommentsResponse struct {
+	Comments []Comment `json:"comments"`
+}
+
+type DeleteCommentResponse struct {
+	Message string `json:"message"`
+}
+
+type GetTaskHistoryResponse struct {
+	Events []TaskEvent `json:"events"`
+}
+
+type ListTrashResponse struct {
+	Tasks []Task `json:"tasks"`
+}
+
+type PurgeTaskResponse struct {
+	Message string `json:"message"`
+}
+
+type SearchTasksResponse struct {
+	Results       []SearchResult `json:"results"`
+	NextPageToken string         `json:"next_page_token,omitempty"`
+}
+
+type BatchCreateTasksRequest struct {
+	Tasks []CreateTaskRequest `json:"tasks"`
+}
+
+type BatchUpdateTasksRequest struct {
+	// Tasks are updated on behalf of the caller, their user_id is ignored
+	Tasks []UpdateTaskRequest `json:"tasks"`
+}
+
+type BatchDeleteTasksRequest struct {
+	Ids []int64 `json:"ids"`
+	// Mode tells what happens to subtasks, reparent by default
+	Mode string `json:"mode,omitempty" enums:"reparent,cascade"`
+}
+
+type BatchResult struct {
+	// Index is the position of the item in the request
+	Index int32 `json:"index"`
+	Id    int64 `json:"id,omitempty"`
+	// Status is the HTTP status of the item, 200 when it succeeded
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Task is the task after it was created or updated
+	Task *Task `json:"task,omitempty"`
+}
+
+type BatchTasksResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+type ImportTasksResponse struct {
+	// DryRun is true when the tasks were only checked and nothing was saved
+	DryRun   bool `json:"dry_run"`
+	Imported int  `json:"imported"`
+	Failed   int  `json:"failed"`
+	// Results has one item per task of the file, Index is its position there
+	Results []BatchResult `json:"results"`
+}
+
+type WebhookRequest struct {
+	// ProjectId is ignored when a webhook is updated
+	ProjectId int64  `json:"project_id,omitempty"`
+	Url       string `json:"url" example:"https://ci.example.com/hooks/tasks"`
+	// Secret signs the deliveries; a new webhook gets a random one when it is
+	// empty, an updated webhook keeps its secret
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty" enums:"created,updated,deleted,restored,purged"`
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type DeleteWebhookResponse struct {
+	Message string `json:"message"`
+}
+
+type ListDeadDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+type TransitionTaskRequest struct {
+	Status string `json:"status" enums:"todo,in_progress,blocked,done,cancelled"`
 }
 
 type DeleteTaskRequest struct {
@@ -107,3 +1016,39 @@ type DeleteTaskRequest struct {
 type DeleteTaskResponse struct {
 	Message string `json:"message"`
 }
+
+type CreateProjectRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type CreateProjectResponse struct {
+	Id int64 `json:"id"`
+}
+
+type GetProjectsResponse struct {
+	Projects []Project `json:"projects"`
+}
+
+type UpdateProjectRequest struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type DeleteProjectResponse struct {
+	Message string `json:"message"`
+}
+
+type AddProjectMemberRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role" enums:"owner,editor,viewer"`
+}
+
+type GetProjectMembersResponse struct {
+	Members []ProjectMember `json:"members"`
+}
+
+type RemoveProjectMemberResponse struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+// AddProjectMember adds the member to the project or changes the role of an existing member.
+// Only owners may do it.
+func (r *Repository) AddProjectMember(projectID int64, userID int64, memberID int64, role string) (models.ProjectMember, error) {
+	if err := r.checkRole(projectID, userID, models.RoleOwner); err != nil {
+		return models.ProjectMember{}, err
+	}
+
+	if role != models.RoleOwner {
+		if err := r.checkNotLastOwner(projectID, memberID); err != nil {
+			return models.ProjectMember{}, err
+		}
+	}
+
+	_, err := r.db.Exec("INSERT INTO project_members (project_id, user_id, role) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE role = VALUES(role)",
+		projectID, memberID, role)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to add project member: %v", err)
+		return models.ProjectMember{}, err
+	}
+
+	// The member sees another set of projects and tasks now
+	if err := r.forgetProjects(memberID); err != nil {
+		return models.ProjectMember{}, err
+	}
+	if err := r.invalidateTaskLists(memberID); err != nil {
+		return models.ProjectMember{}, err
+	}
+
+	var member models.ProjectMember
+	err = r.db.QueryRow("SELECT m.user_id, u.username, m.role FROM project_members m JOIN users u ON u.id = m.user_id WHERE m.project_id = ? AND m.user_id = ?",
+		projectID, memberID).Scan(&member.UserId, &member.Username, &member.Role)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get project member: %v", err)
+		return member, err
+	}
+
+	log.InfoLogger.Printf("User %d is %s of project %d", memberID, role, projectID)
+	return member, nil
+}
+
+// RemoveProjectMember removes the member from the project. Owners may remove
+// anyone, other members may only leave the project themselves.
+func (r *Repository) RemoveProjectMember(projectID int64, userID int64, memberID int64) error {
+	if userID != memberID {
+		if err := r.checkRole(projectID, userID, models.RoleOwner); err != nil {
+			return err
+		}
+	} else if _, err := r.memberRole(projectID, userID); err != nil {
+		return err
+	}
+
+	if err := r.checkNotLastOwner(projectID, memberID); err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec("DELETE FROM project_members WHERE project_id = ? AND user_id = ?", projectID, memberID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to remove project member: %v", err)
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrMemberNotFound
+	}
+
+	// The member no longer sees the project and its tasks
+	if err := r.forgetProjects(memberID); err != nil {
+		return err
+	}
+	if err := r.invalidateTaskLists(memberID); err != nil {
+		return err
+	}
+
+	log.InfoLogger.Printf("User %d removed from project %d", memberID, projectID)
+	return nil
+}
+
+// GetProjectMembers returns the members of the project, owners first.
+func (r *Repository) GetProjectMembers(projectID int64, userID int64) ([]models.ProjectMember, error) {
+	var members []models.ProjectMember
+
+	if _, err := r.memberRole(projectID, userID); err != nil {
+		return members, err
+	}
+
+	// role is an ENUM, so it sorts owners, editors, viewers
+	rows, err := r.db.Query("SELECT m.user_id, u.username, m.role FROM project_members m JOIN users u ON u.id = m.user_id WHERE m.project_id = ? ORDER BY m.role, u.username",
+		projectID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get project members: %v", err)
+		return members, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member models.ProjectMember
+		if err := rows.Scan(&member.UserId, &member.Username, &member.Role); err != nil {
+			log.ErrorLogger.Printf("Failed to scan project member: %v", err)
+			return members, err
+		}
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return members, err
+	}
+
+	return members, nil
+}
+
+// memberRole returns the role of the user in the project or ErrProjectNotFound
+// if the user is not a member.
+func (r *Repository) memberRole(projectID int64, userID int64) (string, error) {
+	var role string
+	err := r.db.QueryRow("SELECT role FROM project_members WHERE project_id = ? AND user_id = ?", projectID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		log.ErrorLogger.Printf("Project %d not found for user ID: %d", projectID, userID)
+		return "", ErrProjectNotFound
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get project role: %v", err)
+		return "", err
+	}
+
+	return role, nil
+}
+
+// checkRole returns ErrForbidden unless the user has one of the roles in the project.
+func (r *Repository) checkRole(projectID int64, userID int64, roles ...string) error {
+	role, err := r.memberRole(projectID, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, allowed := range roles {
+		if role == allowed {
+			return nil
+		}
+	}
+
+	log.ErrorLogger.Printf("User %d is %s of project %d", userID, role, projectID)
+	return ErrForbidden
+}
+
+// checkNotLastOwner returns ErrLastOwner if the member is the only owner of the project.
+func (r *Repository) checkNotLastOwner(projectID int64, memberID int64) error {
+	var owners, isOwner int
+	err := r.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(user_id = ?), 0) FROM project_members WHERE project_id = ? AND role = ?",
+		memberID, projectID, models.RoleOwner).Scan(&owners, &isOwner)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to count project owners: %v", err)
+		return err
+	}
+
+	if isOwner == 1 && owners == 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// memberIDs returns the ids of all members of the project.
+func (r *Repository) memberIDs(projectID int64) ([]int64, error) {
+	var ids []int64
+
+	rows, err := r.db.Query("SELECT user_id FROM project_members WHERE project_id = ?", projectID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get project members: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.ErrorLogger.Printf("Failed to scan member id: %v", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return nil, err
+	}
+
+	return ids, nil
+}
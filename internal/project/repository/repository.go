@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrProjectNotFound is returned when a project does not exist or the user is not its member.
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrForbidden is returned when the role of the user in the project does not allow the operation.
+	ErrForbidden = errors.New("not allowed for this project role")
+	// ErrMemberNotFound is returned when the user is not a member of the project.
+	ErrMemberNotFound = errors.New("project member not found")
+	// ErrLastOwner is returned when the only owner of a project would be removed or demoted.
+	ErrLastOwner = errors.New("project must keep an owner")
+)
+
+type Repository struct {
+	db    *sql.DB
+	redis *redis.Client
+}
+
+func NewRepository(db *sql.DB, redis *redis.Client) *Repository {
+	return &Repository{db: db, redis: redis}
+}
+
+// projectColumns lists the columns read by scanProject, in order.
+const projectColumns = "id, name, description, user_id, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProject reads a row selected with projectColumns.
+func scanProject(row rowScanner) (models.Project, error) {
+	var project models.Project
+	err := row.Scan(&project.Id, &project.Name, &project.Description, &project.UserId, &project.CreatedAt, &project.UpdatedAt)
+	return project, err
+}
+
+// CreateProject creates the project and makes its creator the owner.
+func (r *Repository) CreateProject(project models.Project) (int64, error) {
+	project.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	project.UpdatedAt = project.CreatedAt
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Insert the project into the database
+	result, err := tx.Exec("INSERT INTO projects (name, description, user_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		project.Name, project.Description, project.UserId, project.CreatedAt, project.UpdatedAt)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to insert project into db: %v", err)
+		return 0, err
+	}
+
+	projectID, err := result.LastInsertId()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get last insert ID: %v", err)
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO project_members (project_id, user_id, role) VALUES (?, ?, ?)", projectID, project.UserId, models.RoleOwner)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to add project owner: %v", err)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return 0, err
+	}
+
+	// Drop the cached project list of the user
+	if err := r.forgetProjects(project.UserId); err != nil {
+		return 0, err
+	}
+
+	log.InfoLogger.Printf("Project created with ID: %d", projectID)
+	return projectID, nil
+}
+
+// GetProjectByID returns the project if the user is one of its members.
+func (r *Repository) GetProjectByID(projectID int64, userID int64) (models.Project, error) {
+	var project models.Project
+
+	if _, err := r.memberRole(projectID, userID); err != nil {
+		return project, err
+	}
+
+	projectKey := fmt.Sprintf("project:%d", projectID)
+	projectData, err := r.redis.Get(context.Background(), projectKey).Result()
+	if err == redis.Nil {
+		// If project not found in cache, get it from the database
+		log.InfoLogger.Printf("Project not found in cache, fetching from database")
+		project, err = scanProject(r.db.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", projectID))
+		if err == sql.ErrNoRows {
+			log.ErrorLogger.Printf("Project %d not found", projectID)
+			return project, ErrProjectNotFound
+		} else if err != nil {
+			log.ErrorLogger.Printf("Failed to get project from db: %v", err)
+			return project, err
+		}
+
+		// Cache the project in Redis
+		projectJSON, _ := json.Marshal(project)
+		r.redis.Set(context.Background(), projectKey, projectJSON, 0)
+		log.InfoLogger.Printf("Project cached: %s", projectJSON)
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get project from cache: %v", err)
+		return project, err
+	} else {
+		log.InfoLogger.Printf("Project found in cache: %s", projectData)
+		json.Unmarshal([]byte(projectData), &project)
+	}
+
+	return project, nil
+}
+
+// GetProjects returns all projects the user is a member of, ordered by name.
+func (r *Repository) GetProjects(userID int64) ([]models.Project, error) {
+	var projects []models.Project
+
+	projectsKey := fmt.Sprintf("projects:user:%d", userID)
+	projectsData, err := r.redis.Get(context.Background(), projectsKey).Result()
+	if err == redis.Nil {
+		// If projects not found in cache, get them from the database
+		log.InfoLogger.Printf("Projects not found in cache, fetching from database")
+		rows, err := r.db.Query("SELECT p.id, p.name, p.description, p.user_id, p.created_at, p.updated_at FROM projects p "+
+			"JOIN project_members m ON m.project_id = p.id WHERE m.user_id = ? ORDER BY p.name, p.id", userID)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to get projects from db: %v", err)
+			return projects, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			project, err := scanProject(rows)
+			if err != nil {
+				log.ErrorLogger.Printf("Failed to scan project: %v", err)
+				return projects, err
+			}
+			projects = append(projects, project)
+		}
+		if err = rows.Err(); err != nil {
+			log.ErrorLogger.Printf("Rows error: %v", err)
+			return projects, err
+		}
+
+		// Cache the projects in Redis
+		projectsJSON, err := json.Marshal(projects)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to marshal projects: %v", err)
+			return projects, err
+		}
+
+		r.redis.Set(context.Background(), projectsKey, projectsJSON, 0)
+		log.InfoLogger.Printf("Projects cached: %s", projectsKey)
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get projects from cache: %v", err)
+		return projects, err
+	} else {
+		log.InfoLogger.Printf("Projects found in cache: %s", projectsKey)
+		json.Unmarshal([]byte(projectsData), &projects)
+	}
+
+	return projects, nil
+}
+
+// UpdateProject renames the project. Only owners may do it.
+func (r *Repository) UpdateProject(project models.Project) (models.Project, error) {
+	if err := r.checkRole(project.Id, project.UserId, models.RoleOwner); err != nil {
+		return project, err
+	}
+
+	_, err := r.db.Exec("UPDATE projects SET name = ?, description = ?, updated_at = ? WHERE id = ?",
+		project.Name, project.Description, time.Now().UTC().Truncate(time.Second), project.Id)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to update project: %v", err)
+		return project, err
+	}
+
+	// Drop the cached copies and read the project back
+	err = r.redis.Del(context.Background(), fmt.Sprintf("project:%d", project.Id)).Err()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete project cache: %v", err)
+		return project, err
+	}
+	memberIDs, err := r.memberIDs(project.Id)
+	if err != nil {
+		return project, err
+	}
+	if err := r.forgetProjects(memberIDs...); err != nil {
+		return project, err
+	}
+
+	project, err = r.GetProjectByID(project.Id, project.UserId)
+	if err != nil {
+		return project, err
+	}
+
+	log.InfoLogger.Printf("Project updated with ID: %d", project.Id)
+	return project, nil
+}
+
+// DeleteProject deletes the project. Its tasks are kept and no longer belong to a project.
+// Only owners may do it.
+func (r *Repository) DeleteProject(projectID int64, userID int64) error {
+	if err := r.checkRole(projectID, userID, models.RoleOwner); err != nil {
+		return err
+	}
+
+	memberIDs, err := r.memberIDs(projectID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	taskIDs, err := projectTaskIDs(tx, projectID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE tasks SET project_id = NULL WHERE project_id = ?", projectID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to detach project tasks: %v", err)
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM project_members WHERE project_id = ?", projectID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete project members: %v", err)
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM projects WHERE id = ?", projectID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete project: %v", err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return err
+	}
+
+	// Delete the project caches in Redis
+	keys := []string{fmt.Sprintf("project:%d", projectID)}
+	for _, id := range taskIDs {
+		keys = append(keys, fmt.Sprintf("task:%d", id))
+	}
+	if err := r.redis.Del(context.Background(), keys...).Err(); err != nil {
+		log.ErrorLogger.Printf("Failed to delete project cache: %v", err)
+		return err
+	}
+	if err := r.forgetProjects(memberIDs...); err != nil {
+		return err
+	}
+
+	// The tasks changed too, so invalidate the cached task lists of every member
+	if err := r.invalidateTaskLists(memberIDs...); err != nil {
+		return err
+	}
+
+	log.InfoLogger.Printf("Project deleted with ID: %d", projectID)
+	return nil
+}
+
+// forgetProjects drops the cached project lists of the users.
+func (r *Repository) forgetProjects(userIDs ...int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		keys = append(keys, fmt.Sprintf("projects:user:%d", id))
+	}
+
+	if err := r.redis.Del(context.Background(), keys...).Err(); err != nil {
+		log.ErrorLogger.Printf("Failed to delete projects cache: %v", err)
+		return err
+	}
+	return nil
+}
+
+// invalidateTaskLists drops every cached page of the users' tasks. The keys
+// are shared with the task repository, which bumps the same generations.
+func (r *Repository) invalidateTaskLists(userIDs ...int64) error {
+	for _, id := range userIDs {
+		if err := r.redis.Incr(context.Background(), fmt.Sprintf("tasks:user:%d:gen", id)).Err(); err != nil {
+			log.ErrorLogger.Printf("Failed to invalidate task lists: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func projectTaskIDs(tx *sql.Tx, projectID int64) ([]int64, error) {
+	var ids []int64
+
+	rows, err := tx.Query("SELECT id FROM tasks WHERE project_id = ?", projectID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get project tasks: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.ErrorLogger.Printf("Failed to scan task id: %v", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return nil, err
+	}
+
+	return ids, nil
+}
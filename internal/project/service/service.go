@@ -0,0 +1,202 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/damirbeybitov/todo_project/internal/project/repository"
+	projectPB "github.com/damirbeybitov/todo_project/proto/project"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProjectService представляет сервис управления проектами.
+type ProjectService struct {
+	repo *repository.Repository
+	projectPB.UnimplementedProjectServiceServer
+}
+
+// NewProjectService создает новый экземпляр ProjectService.
+func NewProjectService(repo *repository.Repository) projectPB.ProjectServiceServer {
+	return &ProjectService{repo: repo}
+}
+
+// CreateProject реализует метод создания проекта в рамках интерфейса ProjectServiceServer.
+func (s *ProjectService) CreateProject(ctx context.Context, req *projectPB.CreateProjectRequest) (*projectPB.CreateProjectResponse, error) {
+	log.InfoLogger.Printf("Creating project with name: %s", req.Project.Name)
+
+	if req.Project.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if req.Project.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	projectID, err := s.repo.CreateProject(models.ProjectFromPB(req.Project))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to create project: %v", err)
+		return nil, projectError(err)
+	}
+
+	return &projectPB.CreateProjectResponse{Id: projectID}, nil
+}
+
+// GetProject реализует метод получения проекта в рамках интерфейса ProjectServiceServer.
+func (s *ProjectService) GetProject(ctx context.Context, req *projectPB.GetProjectRequest) (*projectPB.GetProjectResponse, error) {
+	log.InfoLogger.Printf("Getting project with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	project, err := s.repo.GetProjectByID(req.Id, req.UserId)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get project: %v", err)
+		return nil, projectError(err)
+	}
+
+	return &projectPB.GetProjectResponse{
+		Project: models.ProjectToPB(project),
+	}, nil
+}
+
+// GetProjects реализует метод получения проектов пользователя в рамках интерфейса ProjectServiceServer.
+func (s *ProjectService) GetProjects(ctx context.Context, req *projectPB.GetProjectsRequest) (*projectPB.GetProjectsResponse, error) {
+	log.InfoLogger.Printf("Getting projects for user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	projects, err := s.repo.GetProjects(req.UserId)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get projects: %v", err)
+		return nil, projectError(err)
+	}
+
+	var pbProjects []*projectPB.Project
+	for _, project := range projects {
+		pbProjects = append(pbProjects, models.ProjectToPB(project))
+	}
+
+	return &projectPB.GetProjectsResponse{
+		Projects: pbProjects,
+	}, nil
+}
+
+// UpdateProject реализует метод обновления проекта в рамках интерфейса ProjectServiceServer.
+func (s *ProjectService) UpdateProject(ctx context.Context, req *projectPB.UpdateProjectRequest) (*projectPB.UpdateProjectResponse, error) {
+	log.InfoLogger.Printf("Updating project with ID: %d", req.Project.Id)
+
+	if req.Project.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if req.Project.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	project, err := s.repo.UpdateProject(models.ProjectFromPB(req.Project))
+	if err != nil {
+		return nil, projectError(err)
+	}
+
+	return &projectPB.UpdateProjectResponse{
+		Project: models.ProjectToPB(project),
+	}, nil
+}
+
+// DeleteProject реализует метод удаления проекта; задачи проекта сохраняются вне проектов.
+func (s *ProjectService) DeleteProject(ctx context.Context, req *projectPB.DeleteProjectRequest) (*projectPB.DeleteProjectResponse, error) {
+	log.InfoLogger.Printf("Deleting project with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	if err := s.repo.DeleteProject(req.Id, req.UserId); err != nil {
+		return nil, projectError(err)
+	}
+
+	return &projectPB.DeleteProjectResponse{Message: fmt.Sprintf("Project with ID - %d Deleted Succesfully! ", req.Id)}, nil
+}
+
+// AddProjectMember реализует метод добавления участника проекта или смены его роли.
+func (s *ProjectService) AddProjectMember(ctx context.Context, req *projectPB.AddProjectMemberRequest) (*projectPB.AddProjectMemberResponse, error) {
+	log.InfoLogger.Printf("Adding user %d to project %d as %s", req.MemberId, req.ProjectId, req.Role)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if req.MemberId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "member id is required")
+	}
+
+	role := models.RoleFromPB(req.Role)
+	if role == "" {
+		return nil, status.Error(codes.InvalidArgument, "role is required")
+	}
+
+	member, err := s.repo.AddProjectMember(req.ProjectId, req.UserId, req.MemberId, role)
+	if err != nil {
+		return nil, projectError(err)
+	}
+
+	return &projectPB.AddProjectMemberResponse{
+		Member: models.ProjectMemberToPB(member),
+	}, nil
+}
+
+// RemoveProjectMember реализует метод удаления участника проекта.
+func (s *ProjectService) RemoveProjectMember(ctx context.Context, req *projectPB.RemoveProjectMemberRequest) (*projectPB.RemoveProjectMemberResponse, error) {
+	log.InfoLogger.Printf("Removing user %d from project %d", req.MemberId, req.ProjectId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	if err := s.repo.RemoveProjectMember(req.ProjectId, req.UserId, req.MemberId); err != nil {
+		return nil, projectError(err)
+	}
+
+	return &projectPB.RemoveProjectMemberResponse{Message: fmt.Sprintf("User with ID - %d Removed From Project Succesfully! ", req.MemberId)}, nil
+}
+
+// GetProjectMembers реализует метод получения участников проекта.
+func (s *ProjectService) GetProjectMembers(ctx context.Context, req *projectPB.GetProjectMembersRequest) (*projectPB.GetProjectMembersResponse, error) {
+	log.InfoLogger.Printf("Getting members of project %d", req.ProjectId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	members, err := s.repo.GetProjectMembers(req.ProjectId, req.UserId)
+	if err != nil {
+		return nil, projectError(err)
+	}
+
+	var pbMembers []*projectPB.ProjectMember
+	for _, member := range members {
+		pbMembers = append(pbMembers, models.ProjectMemberToPB(member))
+	}
+
+	return &projectPB.GetProjectMembersResponse{
+		Members: pbMembers,
+	}, nil
+}
+
+// projectError преобразует ошибку репозитория в статус gRPC.
+func projectError(err error) error {
+	if errors.Is(err, repository.ErrProjectNotFound) || errors.Is(err, repository.ErrMemberNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, repository.ErrForbidden) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	if errors.Is(err, repository.ErrLastOwner) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
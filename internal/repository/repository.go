@@ -11,35 +11,41 @@ import (
 
 type Repository struct {
 	MicroServiceClients models.MicroServiceClients
+	denylist            *token.Denylist
 }
 
-func NewRepository(microServiceClients models.MicroServiceClients) *Repository {
-	return &Repository{MicroServiceClients: microServiceClients}
+func NewRepository(microServiceClients models.MicroServiceClients, denylist *token.Denylist) *Repository {
+	return &Repository{MicroServiceClients: microServiceClients, denylist: denylist}
 }
 
-func (r *Repository) GetUserIdFromRequest(tokenString string) (int64, error) {
-	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-	username, err := token.VerifyToken(tokenString)
+// GetIdentityFromRequest returns the user of a valid access token that was
+// not revoked. Tokens issued before they carried the user id get it from the
+// user service.
+func (r *Repository) GetIdentityFromRequest(tokenString string) (token.Identity, error) {
+	claims, err := token.ParseAccessToken(strings.TrimPrefix(tokenString, "Bearer "))
 	if err != nil {
-		return 0, err
+		return token.Identity{}, err
 	}
 
-	response, err := r.MicroServiceClients.UserClient.GetUserIdWithUsername(context.Background(), &pbUser.GetUserIdWithUsernameRequest{
-		Username: username,
-	})
-	if err != nil {
-		return 0, err
+	if err := r.denylist.Check(claims.StandardClaims, claims.Generation); err != nil {
+		return token.Identity{}, err
 	}
 
-	return response.Id, nil
-}
-
-func (r *Repository) GetUsernameFromRequest(tokenString string) (string, error) {
-	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-	username, err := token.VerifyToken(tokenString)
-	if err != nil {
-		return "", err
+	identity := claims.Identity()
+	if identity.UserId == 0 {
+		response, err := r.MicroServiceClients.UserClient.GetUserIdWithUsername(context.Background(), &pbUser.GetUserIdWithUsernameRequest{
+			Username: identity.Username,
+		})
+		if err != nil {
+			return token.Identity{}, err
+		}
+		identity.UserId = response.Id
 	}
 
-	return username, nil
-}
\ No newline at end of file
+	return identity, nil
+}
+
+// GetJWKS returns the public keys that verify the tokens.
+func (r *Repository) GetJWKS() (models.JWKSet, error) {
+	return token.JWKS()
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/damirbeybitov/todo_project/internal/handlers"
 	"github.com/damirbeybitov/todo_project/internal/log"
+	token "github.com/damirbeybitov/todo_project/internal/token"
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
 
@@ -26,10 +27,14 @@ func (s *Service) LaunchServer() {
 		w.Write([]byte("pong"))
 	})
 
+	router.HandleFunc("/.well-known/jwks.json", s.handler.JWKSHandler).Methods("GET")
+
 	authRouter := router.PathPrefix("/auth").Subrouter()
 	authRouter.HandleFunc("/register", s.handler.RegisterHandler).Methods("POST")
 	authRouter.HandleFunc("/login", s.handler.LoginHandler).Methods("POST")
 	authRouter.HandleFunc("/refresh-token", s.handler.RefreshTokenHandler).Methods("POST")
+	authRouter.HandleFunc("/logout", s.handler.LogoutHandler).Methods("POST")
+	authRouter.HandleFunc("/logout-all", s.handler.LogoutAllHandler).Methods("POST")
 
 	userRouter := router.PathPrefix("/user").Subrouter()
 	userRouter.Use(s.handler.UserIdentity)
@@ -40,9 +45,69 @@ func (s *Service) LaunchServer() {
 	taskRouter.Use(s.handler.UserIdentity)
 	taskRouter.HandleFunc("/create-task", s.handler.CreateTaskHandler).Methods("POST")
 	taskRouter.HandleFunc("/get-tasks", s.handler.GetTasksHandler).Methods("GET")
+	taskRouter.HandleFunc("/get-overdue-tasks", s.handler.GetOverdueTasksHandler).Methods("GET")
+	taskRouter.HandleFunc("/get-assigned-tasks", s.handler.GetAssignedTasksHandler).Methods("GET")
+	taskRouter.HandleFunc("/search", s.handler.SearchTasksHandler).Methods("GET")
+	taskRouter.HandleFunc("/batch/create", s.handler.BatchCreateTasksHandler).Methods("POST")
+	taskRouter.HandleFunc("/batch/update", s.handler.BatchUpdateTasksHandler).Methods("PUT")
+	taskRouter.HandleFunc("/batch/delete", s.handler.BatchDeleteTasksHandler).Methods("POST")
+	taskRouter.HandleFunc("/export", s.handler.ExportTasksHandler).Methods("GET")
+	taskRouter.HandleFunc("/import", s.handler.ImportTasksHandler).Methods("POST")
+	taskRouter.HandleFunc("/watch", s.handler.WatchTasksHandler).Methods("GET")
 	taskRouter.HandleFunc("/get-task/{id}", s.handler.GetTaskHandler).Methods("GET")
 	taskRouter.HandleFunc("/update-task", s.handler.UpdateTaskHandler).Methods("PUT")
+	taskRouter.HandleFunc("/{id}", s.handler.PatchTaskHandler).Methods("PATCH")
 	taskRouter.HandleFunc("/delete-task/{id}", s.handler.DeleteTaskHandler).Methods("DELETE")
+	taskRouter.HandleFunc("/{id}/transition", s.handler.TransitionTaskHandler).Methods("POST")
+	taskRouter.HandleFunc("/{id}/subtasks", s.handler.GetSubtasksHandler).Methods("GET")
+	taskRouter.HandleFunc("/{id}/history", s.handler.GetTaskHistoryHandler).Methods("GET")
+	taskRouter.HandleFunc("/trash", s.handler.ListTrashHandler).Methods("GET")
+	taskRouter.HandleFunc("/{id}/restore", s.handler.RestoreTaskHandler).Methods("POST")
+	taskRouter.HandleFunc("/{id}/purge", s.handler.PurgeTaskHandler).Methods("DELETE")
+	taskRouter.HandleFunc("/{id}/move", s.handler.MoveTaskHandler).Methods("POST")
+	taskRouter.HandleFunc("/{id}/assign", s.handler.AssignTaskHandler).Methods("POST")
+	taskRouter.HandleFunc("/{id}/tags/{tag_id}", s.handler.AttachTagHandler).Methods("POST")
+	taskRouter.HandleFunc("/{id}/tags/{tag_id}", s.handler.DetachTagHandler).Methods("DELETE")
+	taskRouter.HandleFunc("/{id}/comments", s.handler.AddCommentHandler).Methods("POST")
+	taskRouter.HandleFunc("/{id}/comments", s.handler.ListCommentsHandler).Methods("GET")
+	taskRouter.HandleFunc("/{id}/comments/{comment_id}", s.handler.EditCommentHandler).Methods("PUT")
+	taskRouter.HandleFunc("/{id}/comments/{comment_id}", s.handler.DeleteCommentHandler).Methods("DELETE")
+
+	tagRouter := router.PathPrefix("/tag").Subrouter()
+	tagRouter.Use(s.handler.UserIdentity)
+	tagRouter.HandleFunc("/create-tag", s.handler.CreateTagHandler).Methods("POST")
+	tagRouter.HandleFunc("/get-tags", s.handler.GetTagsHandler).Methods("GET")
+	tagRouter.HandleFunc("/update-tag/{id}", s.handler.RenameTagHandler).Methods("PUT")
+	tagRouter.HandleFunc("/delete-tag/{id}", s.handler.DeleteTagHandler).Methods("DELETE")
+
+	projectRouter := router.PathPrefix("/project").Subrouter()
+	projectRouter.Use(s.handler.UserIdentity)
+	projectRouter.HandleFunc("/create-project", s.handler.CreateProjectHandler).Methods("POST")
+	projectRouter.HandleFunc("/get-projects", s.handler.GetProjectsHandler).Methods("GET")
+	projectRouter.HandleFunc("/get-project/{id}", s.handler.GetProjectHandler).Methods("GET")
+	projectRouter.HandleFunc("/update-project", s.handler.UpdateProjectHandler).Methods("PUT")
+	projectRouter.HandleFunc("/delete-project/{id}", s.handler.DeleteProjectHandler).Methods("DELETE")
+	projectRouter.HandleFunc("/{id}/members", s.handler.AddProjectMemberHandler).Methods("POST")
+	projectRouter.HandleFunc("/{id}/members", s.handler.GetProjectMembersHandler).Methods("GET")
+	projectRouter.HandleFunc("/{id}/members/{user_id}", s.handler.RemoveProjectMemberHandler).Methods("DELETE")
+
+	webhookRouter := router.PathPrefix("/webhook").Subrouter()
+	webhookRouter.Use(s.handler.UserIdentity)
+	webhookRouter.HandleFunc("/create-webhook", s.handler.CreateWebhookHandler).Methods("POST")
+	webhookRouter.HandleFunc("/get-webhooks", s.handler.GetWebhooksHandler).Methods("GET")
+	webhookRouter.HandleFunc("/update-webhook/{id}", s.handler.UpdateWebhookHandler).Methods("PUT")
+	webhookRouter.HandleFunc("/delete-webhook/{id}", s.handler.DeleteWebhookHandler).Methods("DELETE")
+	webhookRouter.HandleFunc("/{id}/dead-letters", s.handler.GetDeadLettersHandler).Methods("GET")
+	webhookRouter.HandleFunc("/{id}/deliveries/{delivery_id}/redeliver", s.handler.RedeliverWebhookHandler).Methods("POST")
+
+	// Маршруты администратора доступны только с ролью admin
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(s.handler.UserIdentity, s.handler.RequireRole(token.RoleAdmin))
+	adminRouter.HandleFunc("/users", s.handler.ListUsersHandler).Methods("GET")
+	adminRouter.HandleFunc("/users/{id}/disable", s.handler.DisableUserHandler).Methods("POST")
+	adminRouter.HandleFunc("/users/{id}/enable", s.handler.EnableUserHandler).Methods("POST")
+	adminRouter.HandleFunc("/users/{id}/reset-password", s.handler.ResetPasswordHandler).Methods("POST")
+	adminRouter.HandleFunc("/users/{id}/tasks", s.handler.GetUserTasksHandler).Methods("GET")
 
 	// Добавление маршрута для Swagger
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
@@ -0,0 +1,284 @@
+// Package recurrence parses the recurrence rules of tasks and computes their
+// next occurrences. Rules are a subset of RFC 5545 RRULE:
+//
+//	FREQ=DAILY|WEEKLY|MONTHLY  required
+//	INTERVAL=n                 every n days, weeks or months, 1 by default
+//	BYDAY=MO,WE,FR             weekdays of weekly rules, the anchor's weekday by default
+//	BYMONTHDAY=1,15,-1         days of monthly rules, negative days count from the end
+//	UNTIL=20060102T150405Z     last moment an occurrence may fall on
+//
+// The shorthands daily, weekly and monthly stand for FREQ=DAILY, FREQ=WEEKLY
+// and FREQ=MONTHLY. All times are handled in UTC.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies supported by rules.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+// maxInterval bounds INTERVAL so that the search for the next occurrence stays short.
+const maxInterval = 1000
+
+// ErrInvalidRule is returned for rules outside the supported subset.
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Until      *time.Time
+}
+
+// Parse parses a rule. An optional RRULE: prefix is ignored.
+func Parse(s string) (Rule, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "RRULE:")
+
+	switch s {
+	case Daily, Weekly, Monthly:
+		return Rule{Freq: s, Interval: 1}, nil
+	}
+
+	rule := Rule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return Rule{}, fmt.Errorf("%w: malformed part %q", ErrInvalidRule, part)
+		}
+		if seen[name] {
+			return Rule{}, fmt.Errorf("%w: %s is repeated", ErrInvalidRule, name)
+		}
+		seen[name] = true
+
+		switch name {
+		case "FREQ":
+			if value != Daily && value != Weekly && value != Monthly {
+				return Rule{}, fmt.Errorf("%w: unsupported frequency %q", ErrInvalidRule, value)
+			}
+			rule.Freq = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 || interval > maxInterval {
+				return Rule{}, fmt.Errorf("%w: interval must be between 1 and %d", ErrInvalidRule, maxInterval)
+			}
+			rule.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return Rule{}, fmt.Errorf("%w: unsupported weekday %q", ErrInvalidRule, day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return Rule{}, fmt.Errorf("%w: unsupported month day %q", ErrInvalidRule, day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return Rule{}, err
+			}
+			rule.Until = &until
+		default:
+			return Rule{}, fmt.Errorf("%w: unsupported part %s", ErrInvalidRule, name)
+		}
+	}
+
+	if rule.Freq == "" {
+		return Rule{}, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != Weekly {
+		return Rule{}, fmt.Errorf("%w: BYDAY is only supported with FREQ=WEEKLY", ErrInvalidRule)
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq != Monthly {
+		return Rule{}, fmt.Errorf("%w: BYMONTHDAY is only supported with FREQ=MONTHLY", ErrInvalidRule)
+	}
+
+	sort.Slice(rule.ByDay, func(i, j int) bool { return weekdayIndex(rule.ByDay[i]) < weekdayIndex(rule.ByDay[j]) })
+	sort.Ints(rule.ByMonthDay)
+	return rule, nil
+}
+
+// String returns the canonical form of the rule, the one stored with tasks.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		var days []string
+		for _, weekday := range r.ByDay {
+			for name, d := range weekdays {
+				if d == weekday {
+					days = append(days, name)
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		var days []string
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence of the series started at anchor that falls
+// after the given moment. Occurrences keep the time of day of the anchor.
+// The second result is false when the series has ended.
+func (r Rule) Next(anchor, after time.Time) (time.Time, bool) {
+	anchor = anchor.UTC()
+	after = after.UTC()
+	if after.Before(anchor) {
+		after = anchor
+	}
+
+	var next time.Time
+	var ok bool
+	switch r.Freq {
+	case Daily:
+		next, ok = r.nextDaily(anchor, after), true
+	case Weekly:
+		next, ok = r.nextWeekly(anchor, after)
+	case Monthly:
+		next, ok = r.nextMonthly(anchor, after)
+	}
+
+	if !ok || (r.Until != nil && next.After(*r.Until)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func (r Rule) nextDaily(anchor, after time.Time) time.Time {
+	periods := int(after.Sub(anchor)/(24*time.Hour)) / r.Interval
+	next := anchor.AddDate(0, 0, periods*r.Interval)
+	for !next.After(after) {
+		next = next.AddDate(0, 0, r.Interval)
+	}
+	return next
+}
+
+func (r Rule) nextWeekly(anchor, after time.Time) (time.Time, bool) {
+	days := r.ByDay
+	if len(days) == 0 {
+		days = []time.Weekday{anchor.Weekday()}
+	}
+
+	anchorWeek := startOfWeek(anchor)
+	day := time.Date(after.Year(), after.Month(), after.Day(), anchor.Hour(), anchor.Minute(), anchor.Second(), 0, time.UTC)
+	// Every matching weekday of the next active week is within this many days
+	for i := 0; i <= 7*(r.Interval+1); i++ {
+		candidate := day.AddDate(0, 0, i)
+		if !candidate.After(after) || !containsWeekday(days, candidate.Weekday()) {
+			continue
+		}
+		weeks := int(startOfWeek(candidate).Sub(anchorWeek).Hours()/24) / 7
+		if weeks%r.Interval == 0 {
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r Rule) nextMonthly(anchor, after time.Time) (time.Time, bool) {
+	days := r.ByMonthDay
+	if len(days) == 0 {
+		days = []int{anchor.Day()}
+	}
+
+	months := (after.Year()-anchor.Year())*12 + int(after.Month()-anchor.Month())
+	months -= months % r.Interval
+	// Months without any of the days are skipped, so look a few periods ahead
+	for i := 0; i < 48; i++ {
+		month := time.Date(anchor.Year(), anchor.Month()+time.Month(months), 1, anchor.Hour(), anchor.Minute(), anchor.Second(), 0, time.UTC)
+		length := month.AddDate(0, 1, -1).Day()
+
+		var candidates []time.Time
+		for _, day := range days {
+			if day < 0 {
+				day += length + 1
+			}
+			if day < 1 || day > length {
+				continue
+			}
+			candidates = append(candidates, month.AddDate(0, 0, day-1))
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+
+		for _, candidate := range candidates {
+			if candidate.After(after) {
+				return candidate, true
+			}
+		}
+		months += r.Interval
+	}
+	return time.Time{}, false
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if until, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				until = until.Add(24*time.Hour - time.Second)
+			}
+			return until, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: UNTIL must look like 20060102T150405Z or 20060102", ErrInvalidRule)
+}
+
+// startOfWeek returns the midnight of the Monday of the week of t.
+func startOfWeek(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return midnight.AddDate(0, 0, -weekdayIndex(t.Weekday()))
+}
+
+// weekdayIndex numbers weekdays from Monday, as RRULE weeks start on Monday.
+func weekdayIndex(weekday time.Weekday) int {
+	return (int(weekday) + 6) % 7
+}
+
+func containsWeekday(days []time.Weekday, weekday time.Weekday) bool {
+	for _, day := range days {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
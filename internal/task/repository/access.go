@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+// visibleTasks restricts a query to the tasks the user may read: their own
+// tasks, the tasks assigned to them and the tasks of the projects they are a
+// member of. Tasks in the trash are never visible. It takes the user id three times.
+const visibleTasks = "(deleted_at IS NULL AND (user_id = ? OR assignee_id = ? OR project_id IN (SELECT project_id FROM project_members WHERE user_id = ?)))"
+
+// trashedTasks restricts a query to the tasks in the trash the user may
+// restore or purge: their own tasks and the tasks of the projects they own or
+// edit. It takes the user id twice.
+const trashedTasks = "(deleted_at IS NOT NULL AND (user_id = ? OR project_id IN (SELECT project_id FROM project_members WHERE user_id = ? AND role IN ('owner', 'editor'))))"
+
+// access is the kind of access to a task checked by checkAccess.
+type access int
+
+const (
+	// accessRead allows reading the task.
+	accessRead access = iota
+	// accessStatus allows changing the status of the task.
+	accessStatus
+	// accessWrite allows changing, moving, assigning and deleting the task.
+	accessWrite
+)
+
+// taskRefs holds the users and the project a task is shared with.
+type taskRefs struct {
+	UserId     int64
+	ProjectId  int64
+	AssigneeId int64
+}
+
+// checkAccess returns ErrTaskNotFound unless the user may read the task, and
+// ErrForbidden if the user may read it but not access it as requested. The
+// creator of a task has full access, its assignee may also change its status,
+// and other members of its project get access according to their role.
+// Tasks in the trash are not found. It returns whom the task is shared with.
+func (r *Repository) checkAccess(taskID int64, userID int64, want access) (taskRefs, error) {
+	return r.taskAccess(taskID, userID, want, false)
+}
+
+// checkTrashAccess returns ErrTaskNotFound unless the task is in the trash and
+// the user could read it, and ErrForbidden unless the user may change it.
+func (r *Repository) checkTrashAccess(taskID int64, userID int64) (taskRefs, error) {
+	return r.taskAccess(taskID, userID, accessWrite, true)
+}
+
+func (r *Repository) taskAccess(taskID int64, userID int64, want access, trashed bool) (taskRefs, error) {
+	var refs taskRefs
+	var projectID, assigneeID sql.NullInt64
+	var role sql.NullString
+	err := r.db.QueryRow("SELECT t.user_id, t.project_id, t.assignee_id, m.role FROM tasks t "+
+		"LEFT JOIN project_members m ON m.project_id = t.project_id AND m.user_id = ? WHERE t.id = ? AND (t.deleted_at IS NOT NULL) = ?", userID, taskID, trashed).Scan(&refs.UserId, &projectID, &assigneeID, &role)
+	if err == sql.ErrNoRows {
+		log.ErrorLogger.Printf("Task %d not found for user ID: %d", taskID, userID)
+		return refs, ErrTaskNotFound
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get task access: %v", err)
+		return refs, err
+	}
+	refs.ProjectId = projectID.Int64
+	refs.AssigneeId = assigneeID.Int64
+
+	if refs.UserId != userID && refs.AssigneeId != userID && !role.Valid {
+		log.ErrorLogger.Printf("Task %d not found for user ID: %d", taskID, userID)
+		return refs, ErrTaskNotFound
+	}
+
+	editor := refs.UserId == userID || role.String == models.RoleOwner || role.String == models.RoleEditor
+	if (want == accessWrite && !editor) || (want == accessStatus && !editor && refs.AssigneeId != userID) {
+		log.ErrorLogger.Printf("User %d may not change task %d", userID, taskID)
+		return refs, ErrForbidden
+	}
+
+	return refs, nil
+}
+
+// checkProject returns ErrInvalidProject unless the user is a member of the project,
+// and ErrForbidden if the user may not add tasks to it. A zero projectID means
+// the task is not in a project.
+func (r *Repository) checkProject(projectID int64, userID int64) error {
+	if projectID == 0 {
+		return nil
+	}
+
+	role, err := r.projectRole(projectID, userID)
+	if err != nil {
+		return err
+	}
+
+	if role == models.RoleViewer {
+		log.ErrorLogger.Printf("User %d may not add tasks to project %d", userID, projectID)
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// projectRole returns the role of the user in the project, or
+// ErrInvalidProject when the user is not a member of it.
+func (r *Repository) projectRole(projectID int64, userID int64) (string, error) {
+	var role string
+	err := r.db.QueryRow("SELECT role FROM project_members WHERE project_id = ? AND user_id = ?", projectID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		log.ErrorLogger.Printf("Project %d not found for user ID: %d", projectID, userID)
+		return "", fmt.Errorf("%w: project %d not found", ErrInvalidProject, projectID)
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get project role: %v", err)
+		return "", err
+	}
+	return role, nil
+}
+
+// invalidateTaskAudience drops the cached task lists of everyone the tasks
+// are shared with: their creators, assignees and the members of their projects.
+func (r *Repository) invalidateTaskAudience(tasks ...taskRefs) error {
+	members, err := r.projectMembers(tasks...)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range audience(members, tasks...) {
+		if err := r.invalidateTaskLists(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// projectMembers returns the members of the projects of the tasks by project.
+func (r *Repository) projectMembers(tasks ...taskRefs) (map[int64][]int64, error) {
+	var projectIDs []int64
+	for _, task := range tasks {
+		if task.ProjectId != 0 && !containsID(projectIDs, task.ProjectId) {
+			projectIDs = append(projectIDs, task.ProjectId)
+		}
+	}
+
+	members := make(map[int64][]int64, len(projectIDs))
+	if len(projectIDs) == 0 {
+		return members, nil
+	}
+
+	rows, err := r.db.Query("SELECT project_id, user_id FROM project_members WHERE project_id IN ("+placeholders(len(projectIDs))+")", idArgs(projectIDs)...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get project members: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID, userID int64
+		if err := rows.Scan(&projectID, &userID); err != nil {
+			log.ErrorLogger.Printf("Failed to scan project member: %v", err)
+			return nil, err
+		}
+		members[projectID] = append(members[projectID], userID)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// audience returns the users the tasks are shared with, given the members of
+// their projects.
+func audience(members map[int64][]int64, tasks ...taskRefs) []int64 {
+	var userIDs []int64
+	for _, task := range tasks {
+		ids := append([]int64{task.UserId, task.AssigneeId}, members[task.ProjectId]...)
+		for _, id := range ids {
+			if id != 0 && !containsID(userIDs, id) {
+				userIDs = append(userIDs, id)
+			}
+		}
+	}
+	return userIDs
+}
+
+// refsOf returns whom the task is shared with.
+func refsOf(task models.Task) taskRefs {
+	return taskRefs{UserId: task.UserId, ProjectId: task.ProjectId, AssigneeId: task.AssigneeId}
+}
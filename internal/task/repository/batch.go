@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+// BatchResult is the outcome of one item of a batch: the task as stored after
+// the item was applied, or the error that made the item fail.
+type BatchResult struct {
+	Task models.Task
+	Err  error
+}
+
+// BatchCreateTasks creates the tasks in one transaction. A task that cannot be
+// created fails on its own and does not stop the others.
+func (r *Repository) BatchCreateTasks(tasks []models.Task) ([]BatchResult, error) {
+	results := make([]BatchResult, len(tasks))
+	prepared := make([]models.Task, len(tasks))
+	for i, task := range tasks {
+		prepared[i], results[i].Err = r.prepareTask(task)
+	}
+
+	err := r.runBatch(results, false, func(tx *sql.Tx, i int) error {
+		taskID, err := insertTask(tx, prepared[i])
+		results[i].Task.Id = taskID
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.refreshResults(results, models.EventCreated); err != nil {
+		return results, err
+	}
+
+	log.InfoLogger.Printf("Batch of %d tasks created", len(tasks))
+	return results, nil
+}
+
+// BatchUpdateTasks updates the tasks of the user in one transaction. The
+// status of each task changes only while the task is still in its status from,
+// as UpdateTask does. A task that cannot be updated fails on its own and does
+// not stop the others.
+func (r *Repository) BatchUpdateTasks(userID int64, tasks []models.Task, from []string) ([]BatchResult, error) {
+	results := make([]BatchResult, len(tasks))
+	prepared := make([]models.Task, len(tasks))
+	var previous []taskRefs
+	for i, task := range tasks {
+		task.UserId = userID
+		var shared taskRefs
+		prepared[i], shared, results[i].Err = r.prepareUpdate(task)
+		if results[i].Err == nil {
+			previous = append(previous, shared)
+		}
+	}
+
+	err := r.runBatch(results, false, func(tx *sql.Tx, i int) error {
+		task := prepared[i]
+		results[i].Task.Id = task.Id
+		if err := checkLive(tx, task.Id); err != nil {
+			return err
+		}
+		return recordChange(tx, task.Id, userID, func(tx *sql.Tx) error {
+			if err := checkVersion(tx, task.Id, task.Version); err != nil {
+				return err
+			}
+			return updateTaskRow(tx, task, from[i])
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Members of the previous projects must stop seeing the tasks that moved
+	if err := r.refreshResults(results, models.EventUpdated, previous...); err != nil {
+		return results, err
+	}
+
+	log.InfoLogger.Printf("Batch of %d tasks updated", len(tasks))
+	return results, nil
+}
+
+// BatchDeleteTasks moves the tasks of the user to the trash in one transaction,
+// with their subtasks handled as DeleteTask does. A task that cannot be deleted
+// fails on its own and does not stop the others.
+func (r *Repository) BatchDeleteTasks(userID int64, taskIDs []int64, cascade bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(taskIDs))
+	var refs []taskRefs
+	for i, taskID := range taskIDs {
+		results[i].Task.Id = taskID
+		var shared taskRefs
+		shared, results[i].Err = r.checkAccess(taskID, userID, accessWrite)
+		if results[i].Err == nil {
+			refs = append(refs, shared)
+		}
+	}
+
+	// Tasks moved to the trash and subtasks moved to another parent
+	var trashed, moved []int64
+	err := r.runBatch(results, false, func(tx *sql.Tx, i int) error {
+		// A task may have gone to the trash with a parent deleted earlier in the batch
+		if err := checkLive(tx, taskIDs[i]); err != nil {
+			return err
+		}
+
+		deleted, children, err := trashTask(tx, taskIDs[i], userID, cascade)
+		if err != nil {
+			return err
+		}
+		trashed = append(trashed, deleted...)
+		moved = append(moved, children...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Delete the task caches in Redis
+	if err := r.forgetTasks(append(trashed, moved...)); err != nil {
+		return results, err
+	}
+
+	// Invalidate the cached task lists of everyone who could see the tasks
+	if err := r.invalidateTaskAudience(refs...); err != nil {
+		return results, err
+	}
+
+	if err := r.publishTaskChanges(models.EventDeleted, trashed); err != nil {
+		return results, err
+	}
+	if err := r.publishTaskChanges(models.EventUpdated, moved); err != nil {
+		return results, err
+	}
+
+	log.InfoLogger.Printf("Batch of %d tasks moved to the trash", len(taskIDs))
+	return results, nil
+}
+
+// runBatch applies every item of the batch that has not failed yet in one
+// transaction. Each item runs under its own savepoint, so an item that fails
+// is rolled back alone and its error is kept in its result. A dry run rolls
+// the whole transaction back once every item has been tried.
+func (r *Repository) runBatch(results []BatchResult, dryRun bool, apply func(tx *sql.Tx, i int) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+
+		if _, err := tx.Exec("SAVEPOINT batch_item"); err != nil {
+			log.ErrorLogger.Printf("Failed to create savepoint: %v", err)
+			return err
+		}
+
+		if err := apply(tx, i); err != nil {
+			log.ErrorLogger.Printf("Batch item %d failed: %v", i, err)
+			results[i].Err = err
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT batch_item"); err != nil {
+				log.ErrorLogger.Printf("Failed to roll back to savepoint: %v", err)
+				return err
+			}
+			continue
+		}
+
+		if _, err := tx.Exec("RELEASE SAVEPOINT batch_item"); err != nil {
+			log.ErrorLogger.Printf("Failed to release savepoint: %v", err)
+			return err
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// refreshResults caches the tasks of the items that succeeded, fills them into
+// the results, invalidates the cached task lists once for the whole batch and
+// tells everyone who can see the tasks that they changed with the action.
+func (r *Repository) refreshResults(results []BatchResult, action string, previous ...taskRefs) error {
+	var ids []int64
+	for _, result := range results {
+		if result.Err == nil && !containsID(ids, result.Task.Id) {
+			ids = append(ids, result.Task.Id)
+		}
+	}
+
+	tasks, err := r.refreshChanged(action, ids, previous...)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[int64]models.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.Id] = task
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Task = byID[results[i].Task.Id]
+		}
+	}
+
+	return nil
+}
+
+// checkLive returns ErrTaskNotFound if the task is in the trash.
+func checkLive(tx *sql.Tx, taskID int64) error {
+	live, err := liveIDs(tx, []int64{taskID})
+	if err != nil {
+		return err
+	}
+	if len(live) == 0 {
+		log.ErrorLogger.Printf("Task not found with ID: %d", taskID)
+		return ErrTaskNotFound
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+var (
+	// ErrCommentNotFound is returned when a comment does not exist on the task.
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrNotCommentAuthor is returned when someone other than the author changes a comment.
+	ErrNotCommentAuthor = errors.New("only the author may change the comment")
+)
+
+// AddComment adds a comment of the user to a task the user can see.
+func (r *Repository) AddComment(taskID int64, userID int64, body string) (models.Comment, error) {
+	if _, err := r.checkAccess(taskID, userID, accessRead); err != nil {
+		return models.Comment{}, err
+	}
+
+	result, err := r.db.Exec("INSERT INTO task_comments (task_id, author_id, body) VALUES (?, ?, ?)", taskID, userID, body)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to insert comment into db: %v", err)
+		return models.Comment{}, err
+	}
+
+	commentID, err := result.LastInsertId()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get last insert ID: %v", err)
+		return models.Comment{}, err
+	}
+
+	log.InfoLogger.Printf("Comment created with ID: %d", commentID)
+	return r.getComment(commentID, taskID)
+}
+
+// ListComments returns the comments of a task the user can see, oldest first.
+func (r *Repository) ListComments(taskID int64, userID int64) ([]models.Comment, error) {
+	var comments []models.Comment
+
+	if _, err := r.checkAccess(taskID, userID, accessRead); err != nil {
+		return comments, err
+	}
+
+	rows, err := r.db.Query("SELECT id, task_id, author_id, body, created_at, updated_at FROM task_comments WHERE task_id = ? ORDER BY created_at, id", taskID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get comments from db: %v", err)
+		return comments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var comment models.Comment
+		if err := rows.Scan(&comment.Id, &comment.TaskId, &comment.AuthorId, &comment.Body, &comment.CreatedAt, &comment.UpdatedAt); err != nil {
+			log.ErrorLogger.Printf("Failed to scan comment: %v", err)
+			return comments, err
+		}
+		comments = append(comments, comment)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return comments, err
+	}
+
+	return comments, nil
+}
+
+// EditComment changes the body of a comment written by the user.
+func (r *Repository) EditComment(commentID int64, taskID int64, userID int64, body string) (models.Comment, error) {
+	if err := r.checkAuthor(commentID, taskID, userID); err != nil {
+		return models.Comment{}, err
+	}
+
+	_, err := r.db.Exec("UPDATE task_comments SET body = ? WHERE id = ?", body, commentID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to update comment: %v", err)
+		return models.Comment{}, err
+	}
+
+	log.InfoLogger.Printf("Comment updated with ID: %d", commentID)
+	return r.getComment(commentID, taskID)
+}
+
+// DeleteComment deletes a comment written by the user.
+func (r *Repository) DeleteComment(commentID int64, taskID int64, userID int64) error {
+	if err := r.checkAuthor(commentID, taskID, userID); err != nil {
+		return err
+	}
+
+	if _, err := r.db.Exec("DELETE FROM task_comments WHERE id = ?", commentID); err != nil {
+		log.ErrorLogger.Printf("Failed to delete comment: %v", err)
+		return err
+	}
+
+	log.InfoLogger.Printf("Comment deleted with ID: %d", commentID)
+	return nil
+}
+
+func (r *Repository) getComment(commentID int64, taskID int64) (models.Comment, error) {
+	var comment models.Comment
+	err := r.db.QueryRow("SELECT id, task_id, author_id, body, created_at, updated_at FROM task_comments WHERE id = ? AND task_id = ?", commentID, taskID).
+		Scan(&comment.Id, &comment.TaskId, &comment.AuthorId, &comment.Body, &comment.CreatedAt, &comment.UpdatedAt)
+	if err == sql.ErrNoRows {
+		log.ErrorLogger.Printf("Comment %d not found on task %d", commentID, taskID)
+		return comment, ErrCommentNotFound
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get comment from db: %v", err)
+		return comment, err
+	}
+
+	return comment, nil
+}
+
+// checkAuthor returns ErrTaskNotFound unless the user can see the task,
+// ErrCommentNotFound unless the comment is on it and ErrNotCommentAuthor
+// unless the user wrote the comment.
+func (r *Repository) checkAuthor(commentID int64, taskID int64, userID int64) error {
+	if _, err := r.checkAccess(taskID, userID, accessRead); err != nil {
+		return err
+	}
+
+	comment, err := r.getComment(commentID, taskID)
+	if err != nil {
+		return err
+	}
+	if comment.AuthorId != userID {
+		log.ErrorLogger.Printf("User %d is not the author of comment %d", userID, commentID)
+		return ErrNotCommentAuthor
+	}
+
+	return nil
+}
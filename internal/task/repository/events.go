@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+// GetTaskHistory returns the events of a task the user can see, oldest first.
+func (r *Repository) GetTaskHistory(taskID int64, userID int64) ([]models.TaskEvent, error) {
+	var events []models.TaskEvent
+
+	if _, err := r.checkAccess(taskID, userID, accessRead); err != nil {
+		return events, err
+	}
+
+	rows, err := r.db.Query("SELECT id, task_id, user_id, action, changes, created_at FROM task_events WHERE task_id = ? ORDER BY id", taskID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get task events from db: %v", err)
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.TaskEvent
+		var userID sql.NullInt64
+		var changes []byte
+		if err := rows.Scan(&event.Id, &event.TaskId, &userID, &event.Action, &changes, &event.CreatedAt); err != nil {
+			log.ErrorLogger.Printf("Failed to scan task event: %v", err)
+			return events, err
+		}
+		if err := json.Unmarshal(changes, &event.Changes); err != nil {
+			log.ErrorLogger.Printf("Failed to unmarshal task event changes: %v", err)
+			return events, err
+		}
+		event.UserId = userID.Int64
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return events, err
+	}
+
+	return events, nil
+}
+
+// changeTask runs update in a transaction and records the changes it made to
+// the task as an event of the user. Nothing is recorded when no field changed,
+// so the version of the task stays the same.
+func (r *Repository) changeTask(taskID int64, userID int64, update func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := recordChange(tx, taskID, userID, update); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// recordChange runs update inside the transaction like changeTask does.
+func recordChange(tx *sql.Tx, taskID int64, userID int64, update func(tx *sql.Tx) error) error {
+	before, err := readTask(tx, taskID, true)
+	if err != nil {
+		return err
+	}
+
+	if err := update(tx); err != nil {
+		return err
+	}
+
+	after, err := readTask(tx, taskID, false)
+	if err != nil {
+		return err
+	}
+
+	if changes := diffTasks(before, after); len(changes) > 0 {
+		if err := recordEvent(tx, taskID, userID, models.EventUpdated, changes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readTask reads the task with its tags inside the transaction. With lock the
+// row stays locked until the transaction ends.
+func readTask(tx *sql.Tx, taskID int64, lock bool) (models.Task, error) {
+	query := "SELECT " + taskColumns + " FROM tasks WHERE id = ?"
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	task, err := scanTask(tx.QueryRow(query, taskID))
+	if err == sql.ErrNoRows {
+		log.ErrorLogger.Printf("Task not found with ID: %d", taskID)
+		return task, ErrTaskNotFound
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get task: %v", err)
+		return task, err
+	}
+
+	rows, err := tx.Query("SELECT g.name FROM task_tags tt JOIN tags g ON g.id = tt.tag_id WHERE tt.task_id = ? ORDER BY g.name", taskID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get task tags: %v", err)
+		return task, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.ErrorLogger.Printf("Failed to scan task tag: %v", err)
+			return task, err
+		}
+		task.Tags = append(task.Tags, name)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return task, err
+	}
+
+	return task, nil
+}
+
+// recordEvent appends an event to the history of the task. A zero userID
+// records a change made by the service itself. Every change recorded after
+// the creation of a task bumps its version, and the event is queued for the
+// webhooks that receive it.
+func recordEvent(tx *sql.Tx, taskID int64, userID int64, action string, changes []models.FieldChange) error {
+	if changes == nil {
+		changes = []models.FieldChange{}
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal task event changes: %v", err)
+		return err
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	result, err := tx.Exec("INSERT INTO task_events (task_id, user_id, action, changes, created_at) VALUES (?, ?, ?, ?, ?)",
+		taskID, nullID(userID), action, changesJSON, createdAt)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to record task event: %v", err)
+		return err
+	}
+	eventID, err := result.LastInsertId()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get last insert ID: %v", err)
+		return err
+	}
+
+	if action != models.EventCreated && action != models.EventPurged {
+		if _, err := tx.Exec("UPDATE tasks SET version = version + 1 WHERE id = ?", taskID); err != nil {
+			log.ErrorLogger.Printf("Failed to bump task version: %v", err)
+			return err
+		}
+	}
+
+	// The deliveries are queued with the event, so none is lost or sent for a
+	// change that was rolled back
+	return enqueueWebhooks(tx, models.TaskEvent{
+		Id:        eventID,
+		TaskId:    taskID,
+		UserId:    userID,
+		Action:    action,
+		Changes:   changes,
+		CreatedAt: createdAt,
+	})
+}
+
+// checkVersion returns ErrVersionMismatch unless the task is at the given
+// version, and locks it until the transaction ends. A zero version is not checked.
+func checkVersion(tx *sql.Tx, taskID int64, version int64) error {
+	if version == 0 {
+		return nil
+	}
+
+	var current int64
+	err := tx.QueryRow("SELECT version FROM tasks WHERE id = ? FOR UPDATE", taskID).Scan(&current)
+	if err == sql.ErrNoRows {
+		log.ErrorLogger.Printf("Task not found with ID: %d", taskID)
+		return ErrTaskNotFound
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get task version: %v", err)
+		return err
+	}
+
+	if current != version {
+		log.ErrorLogger.Printf("Task %d is at version %d, not %d", taskID, current, version)
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// diffTasks returns the fields that differ between two versions of a task.
+// Comparing with an empty task lists every field that is set.
+func diffTasks(before, after models.Task) []models.FieldChange {
+	var changes []models.FieldChange
+
+	fields := []struct {
+		name          string
+		before, after string
+	}{
+		{"title", before.Title, after.Title},
+		{"description", before.Description, after.Description},
+		{"status", before.Status, after.Status},
+		{"due_at", formatTime(before.DueAt), formatTime(after.DueAt)},
+		{"priority", before.Priority, after.Priority},
+		{"parent_id", formatID(before.ParentId), formatID(after.ParentId)},
+		{"project_id", formatID(before.ProjectId), formatID(after.ProjectId)},
+		{"assignee_id", formatID(before.AssigneeId), formatID(after.AssigneeId)},
+		{"recurrence", before.Recurrence, after.Recurrence},
+		{"tags", strings.Join(before.Tags, ","), strings.Join(after.Tags, ",")},
+	}
+	for _, field := range fields {
+		if field.before != field.after {
+			changes = append(changes, models.FieldChange{Field: field.name, From: field.before, To: field.after})
+		}
+	}
+
+	return changes
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+	taskPageTTL     = 10 * time.Minute
+)
+
+// sortColumns maps the sort fields accepted by GetTasks to the expressions
+// tasks are ordered by. status and priority are MySQL ENUMs, compared by
+// their index so they sort in workflow and severity order rather than
+// alphabetically. Tasks without a due date sort first, as NULLs do.
+var sortColumns = map[string]string{
+	"":           "id",
+	"id":         "id",
+	"title":      "title",
+	"status":     "status + 0",
+	"due_at":     "COALESCE(due_at, '1000-01-01 00:00:00')",
+	"priority":   "priority + 0",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// taskPage is a single page of GetTasks results as it is cached in Redis.
+type taskPage struct {
+	Tasks         []models.Task `json:"tasks"`
+	NextPageToken string        `json:"next_page_token"`
+}
+
+// buildTasksQuery builds the SQL query for a page of tasks and returns it
+// with the sort order of its page tokens and the page size. The query
+// selects the sort key of every task after its columns, and one row more
+// than the page size so the caller can tell whether a next page exists.
+func buildTasksQuery(userID int64, filter models.TaskFilter) (string, []interface{}, string, int, error) {
+	column, ok := sortColumns[filter.SortBy]
+	if !ok {
+		return "", nil, "", 0, fmt.Errorf("%w: unknown sort field %q", ErrInvalidFilter, filter.SortBy)
+	}
+
+	order, after := "ASC", ">"
+	if filter.SortDesc {
+		order, after = "DESC", "<"
+	}
+	sortBy := filter.SortBy
+	if sortBy == "" {
+		sortBy = "id"
+	}
+	sort := sortBy + " " + order
+
+	cursor, err := decodePageCursor(filter.PageToken, sort)
+	if err != nil {
+		return "", nil, "", 0, err
+	}
+
+	limit := int(filter.PageSize)
+	if limit <= 0 {
+		limit = defaultPageSize
+	} else if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	query := "SELECT " + taskColumns + ", CAST(" + column + " AS CHAR) FROM tasks WHERE " + visibleTasks
+	args := []interface{}{userID, userID, userID}
+
+	if filter.Status != "" {
+		query += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+
+	if filter.ProjectId != 0 {
+		query += " AND project_id = ?"
+		args = append(args, filter.ProjectId)
+	}
+
+	if filter.AssigneeId != 0 {
+		query += " AND assignee_id = ?"
+		args = append(args, filter.AssigneeId)
+	}
+
+	if len(filter.Tags) > 0 {
+		// The task must have every tag, so count the distinct matching names
+		query += " AND id IN (SELECT tt.task_id FROM task_tags tt JOIN tags g ON g.id = tt.tag_id WHERE g.name IN (" +
+			placeholders(len(filter.Tags)) + ") GROUP BY tt.task_id HAVING COUNT(DISTINCT g.name) = ?)"
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+		args = append(args, len(filter.Tags))
+	}
+
+	if filter.Query != "" {
+		like := "%" + escapeLike(filter.Query) + "%"
+		query += " AND (title LIKE ? OR description LIKE ?)"
+		args = append(args, like, like)
+	}
+
+	// The page starts after the last task of the previous one, so tasks
+	// created or deleted in between neither shift nor repeat the pages
+	if cursor != nil {
+		query += fmt.Sprintf(" AND (%s, id) %s (?, ?)", column, after)
+		args = append(args, cursor.Key, cursor.Id)
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ?", column, order, order)
+	args = append(args, limit+1)
+
+	return query, args, sort, limit, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// pageCursor is the position a page token continues from: the sort key and
+// id of the last row of the previous page, in the sort order the token was
+// issued for.
+type pageCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	Id   int64  `json:"id"`
+}
+
+func encodePageCursor(sort string, key string, id int64) string {
+	data, _ := json.Marshal(pageCursor{Sort: sort, Key: key, Id: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePageCursor returns the cursor of a page token, nil for the first
+// page. Tokens of another sort order are rejected.
+func decodePageCursor(token string, sort string) (*pageCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed page token", ErrInvalidFilter)
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Id <= 0 {
+		return nil, fmt.Errorf("%w: malformed page token", ErrInvalidFilter)
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("%w: page token of another sort order", ErrInvalidFilter)
+	}
+
+	return &cursor, nil
+}
+
+// taskPageKey returns the cache key of a page of the user's tasks.
+func (r *Repository) taskPageKey(userID int64, filter models.TaskFilter) (string, error) {
+	hash := sha1.Sum([]byte(fmt.Sprintf("%d|%s|%s|%s|%s|%t|%d|%d|%s", filter.PageSize, filter.PageToken, filter.Status, filter.Query, filter.SortBy, filter.SortDesc, filter.ProjectId, filter.AssigneeId, strings.Join(filter.Tags, ","))))
+	return r.taskListKey(userID, hex.EncodeToString(hash[:]))
+}
+
+// taskListKey returns the cache key of a list of the user's tasks. Keys include
+// the current generation of the user's task lists, so bumping the generation
+// makes every cached list of the user unreachable at once.
+func (r *Repository) taskListKey(userID int64, name string) (string, error) {
+	generation, err := r.redis.Get(context.Background(), fmt.Sprintf("tasks:user:%d:gen", userID)).Int64()
+	if err != nil && err != redis.Nil {
+		log.ErrorLogger.Printf("Failed to get task list generation: %v", err)
+		return "", err
+	}
+
+	return fmt.Sprintf("tasks:user:%d:%d:%s", userID, generation, name), nil
+}
+
+// invalidateTaskLists drops every cached page of the user's tasks.
+func (r *Repository) invalidateTaskLists(userID int64) error {
+	err := r.redis.Incr(context.Background(), fmt.Sprintf("tasks:user:%d:gen", userID)).Err()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to invalidate task lists cache: %v", err)
+		return err
+	}
+
+	log.InfoLogger.Printf("Task lists cache invalidated for user ID: %d", userID)
+	return nil
+}
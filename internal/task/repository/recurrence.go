@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+// occurrenceColumns lists the columns read by scanOccurrence, in order.
+const occurrenceColumns = taskColumns + ", series_id, occurrence_at"
+
+// GetOccurrence returns the task with its place in its series. The task
+// carries no recurrence when it is not the latest occurrence of a series.
+func (r *Repository) GetOccurrence(taskID int64) (models.Occurrence, error) {
+	occurrence, err := scanOccurrence(r.db.QueryRow("SELECT "+occurrenceColumns+" FROM tasks WHERE id = ?", taskID))
+	if err == sql.ErrNoRows {
+		log.ErrorLogger.Printf("Task not found with ID: %d", taskID)
+		return occurrence, ErrTaskNotFound
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get task occurrence: %v", err)
+		return occurrence, err
+	}
+
+	return occurrence, nil
+}
+
+// DueOccurrences returns up to limit recurring tasks whose scheduled moment
+// is not after now, so that their next occurrence has to be created.
+func (r *Repository) DueOccurrences(now time.Time, limit int) ([]models.Occurrence, error) {
+	var occurrences []models.Occurrence
+
+	rows, err := r.db.Query("SELECT "+occurrenceColumns+" FROM tasks WHERE recurrence <> '' AND deleted_at IS NULL AND occurrence_at <= ? ORDER BY occurrence_at, id LIMIT ?", now, limit)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get due occurrences: %v", err)
+		return occurrences, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		occurrence, err := scanOccurrence(rows)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to scan occurrence: %v", err)
+			return occurrences, err
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return occurrences, err
+	}
+
+	return occurrences, nil
+}
+
+// CreateOccurrence creates the occurrence of the series scheduled for at as a
+// copy of source and moves the recurrence rule to it. The series and moment
+// are unique, so an occurrence that already exists is not created again; the
+// returned id is zero then.
+func (r *Repository) CreateOccurrence(source models.Occurrence, at time.Time) (int64, error) {
+	task := source.Task
+	now := time.Now().UTC().Truncate(time.Second)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT IGNORE INTO tasks (title, description, status, user_id, due_at, priority, created_at, updated_at, parent_id, project_id, assignee_id, recurrence, series_id, occurrence_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		task.Title, task.Description, models.StatusTodo, task.UserId, at, task.Priority, now, now, nullID(task.ParentId), nullID(task.ProjectId), nullID(task.AssigneeId), task.Recurrence, source.SeriesId, at)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to create occurrence: %v", err)
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get rows affected: %v", err)
+		return 0, err
+	}
+
+	var taskID int64
+	if rowsAffected == 1 {
+		taskID, err = result.LastInsertId()
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to retrieve last insert ID: %v", err)
+			return 0, err
+		}
+
+		_, err = tx.Exec("INSERT INTO task_tags (task_id, tag_id) SELECT ?, tag_id FROM task_tags WHERE task_id = ?", taskID, task.Id)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to copy task tags: %v", err)
+			return 0, err
+		}
+
+		created, err := readTask(tx, taskID, false)
+		if err != nil {
+			return 0, err
+		}
+		if err := recordEvent(tx, taskID, 0, models.EventCreated, diffTasks(models.Task{}, created)); err != nil {
+			return 0, err
+		}
+	}
+
+	// Only the latest occurrence of a series carries the rule
+	if task.Recurrence != "" {
+		if _, err := tx.Exec("UPDATE tasks SET recurrence = '' WHERE id = ?", task.Id); err != nil {
+			log.ErrorLogger.Printf("Failed to move recurrence: %v", err)
+			return 0, err
+		}
+
+		change := models.FieldChange{Field: "recurrence", From: task.Recurrence}
+		if err := recordEvent(tx, task.Id, 0, models.EventUpdated, []models.FieldChange{change}); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return 0, err
+	}
+
+	if _, err := r.refreshTask(task.Id); err != nil {
+		return taskID, err
+	}
+	if taskID == 0 {
+		log.InfoLogger.Printf("Occurrence of series %d at %s already exists", source.SeriesId, at)
+		return 0, nil
+	}
+	if _, err := r.refreshChanged(models.EventCreated, []int64{taskID}); err != nil {
+		return taskID, err
+	}
+
+	log.InfoLogger.Printf("Occurrence of series %d created with ID: %d", source.SeriesId, taskID)
+	return taskID, nil
+}
+
+// EndSeries takes the recurrence rule off the task once its series has no
+// more occurrences.
+func (r *Repository) EndSeries(taskID int64) error {
+	err := r.changeTask(taskID, 0, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE tasks SET recurrence = '' WHERE id = ?", taskID)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to end task series: %v", err)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.refreshTask(taskID); err != nil {
+		return err
+	}
+
+	log.InfoLogger.Printf("Series of task %d ended", taskID)
+	return nil
+}
+
+// scanOccurrence reads a row selected with occurrenceColumns.
+func scanOccurrence(row rowScanner) (models.Occurrence, error) {
+	var occurrence models.Occurrence
+	var seriesID sql.NullInt64
+	var at sql.NullTime
+
+	task, err := scanTask(withColumns(row, &seriesID, &at))
+	if err != nil {
+		return occurrence, err
+	}
+
+	occurrence.Task = task
+	occurrence.SeriesId = seriesID.Int64
+	occurrence.At = at.Time
+	return occurrence, nil
+}
@@ -4,13 +4,33 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/damirbeybitov/todo_project/internal/log"
 	"github.com/damirbeybitov/todo_project/internal/models"
 	"github.com/redis/go-redis/v9"
 )
 
+var (
+	// ErrTaskNotFound is returned when a task does not exist or belongs to another user.
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrInvalidFilter is returned when GetTasks receives an unknown sort field or a malformed page token.
+	ErrInvalidFilter = errors.New("invalid tasks filter")
+	// ErrStatusChanged is returned when the status of a task changed since it was read.
+	ErrStatusChanged = errors.New("task status changed concurrently")
+	// ErrInvalidParent is returned when a parent task does not exist or would create a cycle.
+	ErrInvalidParent = errors.New("invalid parent task")
+	// ErrInvalidProject is returned when a task refers to a project the user is not a member of.
+	ErrInvalidProject = errors.New("invalid project")
+	// ErrForbidden is returned when the project role of the user does not allow changing the task.
+	ErrForbidden = errors.New("not allowed for this project role")
+	// ErrVersionMismatch is returned when a task changed since the version the caller expects.
+	ErrVersionMismatch = errors.New("task version mismatch")
+)
+
 type Repository struct {
 	db    *sql.DB
 	redis *redis.Client
@@ -20,24 +40,78 @@ func NewRepository(db *sql.DB, redis *redis.Client) *Repository {
 	return &Repository{db: db, redis: redis}
 }
 
+// taskColumns lists the columns read by scanTask, in order.
+const taskColumns = "id, title, description, status, user_id, due_at, priority, created_at, updated_at, parent_id, project_id, assignee_id, recurrence, deleted_at, version"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask reads a row selected with taskColumns.
+func scanTask(row rowScanner) (models.Task, error) {
+	var task models.Task
+	var dueAt, deletedAt sql.NullTime
+	var parentID, projectID, assigneeID sql.NullInt64
+
+	err := row.Scan(&task.Id, &task.Title, &task.Description, &task.Status, &task.UserId, &dueAt, &task.Priority, &task.CreatedAt, &task.UpdatedAt, &parentID, &projectID, &assigneeID, &task.Recurrence, &deletedAt, &task.Version)
+	if err != nil {
+		return task, err
+	}
+
+	if dueAt.Valid {
+		task.DueAt = &dueAt.Time
+	}
+	if deletedAt.Valid {
+		task.DeletedAt = &deletedAt.Time
+	}
+	task.ParentId = parentID.Int64
+	task.ProjectId = projectID.Int64
+	task.AssigneeId = assigneeID.Int64
+
+	return task, nil
+}
+
+// extraColumns lets scanTask read rows that have more columns after taskColumns.
+type extraColumns struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+// withColumns scans the columns after taskColumns into extra.
+func withColumns(row rowScanner, extra ...interface{}) rowScanner {
+	return &extraColumns{row: row, extra: extra}
+}
+
+func (s *extraColumns) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
 func (r *Repository) CreateTask(task models.Task) (int64, error) {
-	// Insert the task into the database
-	result, err := r.db.Exec("INSERT INTO tasks (title, description, status, user_id) VALUES (?, ?, ?, ?)", task.Title, task.Description, task.Status, task.UserId)
+	task, err := r.prepareTask(task)
 	if err != nil {
-		log.ErrorLogger.Printf("Failed to create task: %v", err)
 		return 0, err
 	}
 
-	// Retrieve the last insert ID
-	taskID, err := result.LastInsertId()
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	taskID, err := insertTask(tx, task)
 	if err != nil {
-		log.ErrorLogger.Printf("Failed to retrieve last insert ID: %v", err)
 		return 0, err
 	}
 
 	// Set the task ID
 	task.Id = taskID
 
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return 0, err
+	}
+
 	// Cache the newly created task in Redis
 	taskKey := fmt.Sprintf("task:%d", taskID)
 	taskJSON, err := json.Marshal(task)
@@ -52,45 +126,85 @@ func (r *Repository) CreateTask(task models.Task) (int64, error) {
 		return taskID, err
 	}
 
-	// Update the cached list of tasks for the user
-	tasksKey := fmt.Sprintf("tasks:user:%d", task.UserId)
-	allTasksData, err := r.redis.Get(context.Background(), tasksKey).Result()
-	if err == redis.Nil {
-		// If tasks not found in cache, initialize the list with the new task
-		tasks := []models.Task{task}
-		tasksJSON, err := json.Marshal(tasks)
-		if err != nil {
-			log.ErrorLogger.Printf("Failed to marshal tasks: %v", err)
-			return taskID, err
-		}
-		r.redis.Set(context.Background(), tasksKey, tasksJSON, 0)
-		log.InfoLogger.Printf("Tasks list created and cached for user ID: %d", task.UserId)
-	} else if err != nil {
-		log.ErrorLogger.Printf("Failed to get tasks from cache: %v", err)
+	// Invalidate the cached task lists of everyone who can see the task
+	if err := r.invalidateTaskAudience(refsOf(task)); err != nil {
 		return taskID, err
-	} else {
-		// If tasks found in cache, update the list with the new task
-		var tasks []models.Task
-		err = json.Unmarshal([]byte(allTasksData), &tasks)
-		if err != nil {
-			log.ErrorLogger.Printf("Failed to unmarshal tasks from cache: %v", err)
-			return taskID, err
+	}
+
+	if err := r.publishChanges(models.EventCreated, map[int64]taskRefs{taskID: refsOf(task)}); err != nil {
+		return taskID, err
+	}
+
+	log.InfoLogger.Printf("Task created and cached with ID: %d", taskID)
+	return taskID, nil
+}
+
+// prepareTask fills in the defaults of a new task and makes sure its creator
+// may add it under its parent and to its project.
+func (r *Repository) prepareTask(task models.Task) (models.Task, error) {
+	if task.Status == "" {
+		task.Status = models.StatusTodo
+	}
+	if task.Priority == "" {
+		task.Priority = models.PriorityMedium
+	}
+	task.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	task.UpdatedAt = task.CreatedAt
+	task.Version = 1
+
+	// Subtasks may only be attached to the user's own tasks
+	if task.ParentId != 0 {
+		if err := r.checkParent(task.ParentId, task.UserId); err != nil {
+			return task, err
 		}
-		tasks = append(tasks, task)
-		tasksJSON, err := json.Marshal(tasks)
-		if err != nil {
-			log.ErrorLogger.Printf("Failed to marshal tasks: %v", err)
-			return taskID, err
+	}
+	if err := r.checkProject(task.ProjectId, task.UserId); err != nil {
+		return task, err
+	}
+
+	return task, nil
+}
+
+// insertTask inserts the prepared task inside the transaction, records its
+// creation and returns its id.
+func insertTask(tx *sql.Tx, task models.Task) (int64, error) {
+	// A recurring task starts a series scheduled for its due date
+	var occurrenceAt *time.Time
+	if task.Recurrence != "" {
+		occurrenceAt = task.DueAt
+	}
+
+	// Insert the task into the database
+	result, err := tx.Exec("INSERT INTO tasks (title, description, status, user_id, due_at, priority, created_at, updated_at, parent_id, project_id, recurrence, occurrence_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		task.Title, task.Description, task.Status, task.UserId, task.DueAt, task.Priority, task.CreatedAt, task.UpdatedAt, nullID(task.ParentId), nullID(task.ProjectId), task.Recurrence, occurrenceAt)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to create task: %v", err)
+		return 0, err
+	}
+
+	// Retrieve the last insert ID
+	taskID, err := result.LastInsertId()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to retrieve last insert ID: %v", err)
+		return 0, err
+	}
+
+	if task.Recurrence != "" {
+		if _, err := tx.Exec("UPDATE tasks SET series_id = id WHERE id = ?", taskID); err != nil {
+			log.ErrorLogger.Printf("Failed to start task series: %v", err)
+			return 0, err
 		}
-		r.redis.Set(context.Background(), tasksKey, tasksJSON, 0)
-		log.InfoLogger.Printf("Tasks list updated and cached for user ID: %d", task.UserId)
 	}
 
-	log.InfoLogger.Printf("Task created and cached with ID: %d", taskID)
+	task.Id = taskID
+	if err := recordEvent(tx, taskID, task.UserId, models.EventCreated, diffTasks(models.Task{}, task)); err != nil {
+		return 0, err
+	}
+
 	return taskID, nil
 }
 
-func (r *Repository) GetTaskByID(taskID int64) (models.Task, error) {
+func (r *Repository) GetTaskByID(taskID int64, userID int64) (models.Task, error) {
 	var task models.Task
 
 	taskKey := fmt.Sprintf("task:%d", taskID)
@@ -98,13 +212,21 @@ func (r *Repository) GetTaskByID(taskID int64) (models.Task, error) {
 	if err == redis.Nil {
 		// If task not found in cache, get it from the database
 		log.InfoLogger.Printf("Task not found in cache, fetching from database")
-		err = r.db.QueryRow("SELECT id, title, description, status, user_id FROM tasks WHERE id = ?", taskID).
-			Scan(&task.Id, &task.Title, &task.Description, &task.Status, &task.UserId)
-		if err != nil {
+		task, err = scanTask(r.db.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ? AND deleted_at IS NULL", taskID))
+		if err == sql.ErrNoRows {
+			log.ErrorLogger.Printf("Task %d not found", taskID)
+			return task, ErrTaskNotFound
+		} else if err != nil {
 			log.ErrorLogger.Printf("Failed to get task from db: %v", err)
 			return task, err
 		}
 
+		tasks := []models.Task{task}
+		if err := r.loadTags(tasks); err != nil {
+			return task, err
+		}
+		task = tasks[0]
+
 		// Cache the task in Redis
 		taskJSON, _ := json.Marshal(task)
 		r.redis.Set(context.Background(), taskKey, taskJSON, 0)
@@ -117,172 +239,595 @@ func (r *Repository) GetTaskByID(taskID int64) (models.Task, error) {
 		json.Unmarshal([]byte(taskData), &task)
 	}
 
+	// Tasks of shared projects are visible to every project member
+	if task.UserId != userID {
+		if _, err := r.checkAccess(taskID, userID, accessRead); err != nil {
+			return models.Task{}, err
+		}
+	}
+
 	return task, nil
 }
 
-func (r *Repository) GetTasks(userID int64) ([]models.Task, error) {
-	var tasks []models.Task
+// GetTasks returns a page of the user's tasks matching the filter and the token of the next page.
+func (r *Repository) GetTasks(userID int64, filter models.TaskFilter) ([]models.Task, string, error) {
+	var page taskPage
+
+	query, args, sort, limit, err := buildTasksQuery(userID, filter)
+	if err != nil {
+		log.ErrorLogger.Printf("Invalid tasks filter: %v", err)
+		return nil, "", err
+	}
 
-	tasksKey := fmt.Sprintf("tasks:user:%d", userID)
-	allTasksData, err := r.redis.Get(context.Background(), tasksKey).Result()
+	pageKey, err := r.taskPageKey(userID, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pageData, err := r.redis.Get(context.Background(), pageKey).Result()
 	if err == redis.Nil {
-		// If tasks not found in cache, get them from the database
-		log.InfoLogger.Printf("Tasks not found in cache, fetching from database")
-		rows, err := r.db.Query("SELECT id, title, description, status, user_id FROM tasks WHERE user_id = ?", userID)
+		// If the page is not found in cache, get it from the database
+		log.InfoLogger.Printf("Tasks page not found in cache, fetching from database")
+		rows, err := r.db.Query(query, args...)
 		if err != nil {
 			log.ErrorLogger.Printf("Failed to get tasks from db: %v", err)
-			return tasks, err
+			return nil, "", err
 		}
 		defer rows.Close()
 
+		var sortKeys []string
 		for rows.Next() {
-			var task models.Task
-			if err := rows.Scan(&task.Id, &task.Title, &task.Description, &task.Status, &task.UserId); err != nil {
+			var sortKey string
+			task, err := scanTask(withColumns(rows, &sortKey))
+			if err != nil {
 				log.ErrorLogger.Printf("Failed to scan task: %v", err)
-				return tasks, err
+				return nil, "", err
 			}
-			tasks = append(tasks, task)
+			page.Tasks = append(page.Tasks, task)
+			sortKeys = append(sortKeys, sortKey)
 		}
 		if err = rows.Err(); err != nil {
 			log.ErrorLogger.Printf("Rows error: %v", err)
-			return tasks, err
+			return nil, "", err
+		}
+
+		// One extra row was requested to find out whether there is a next page
+		if len(page.Tasks) > limit {
+			page.Tasks = page.Tasks[:limit]
+			page.NextPageToken = encodePageCursor(sort, sortKeys[limit-1], page.Tasks[limit-1].Id)
+		}
+
+		if err := r.loadTags(page.Tasks); err != nil {
+			return nil, "", err
 		}
 
-		// Cache the tasks in Redis
-		tasksJSON, err := json.Marshal(tasks)
+		// Cache the page in Redis
+		pageJSON, err := json.Marshal(page)
 		if err != nil {
 			log.ErrorLogger.Printf("Failed to marshal tasks: %v", err)
-			return tasks, err
+			return nil, "", err
 		}
 
-		r.redis.Set(context.Background(), tasksKey, tasksJSON, 0)
-		log.InfoLogger.Printf("Tasks cached: %s", tasksJSON)
+		r.redis.Set(context.Background(), pageKey, pageJSON, taskPageTTL)
+		log.InfoLogger.Printf("Tasks page cached: %s", pageKey)
 	} else if err != nil {
 		log.ErrorLogger.Printf("Failed to get tasks from cache: %v", err)
-		return tasks, err
+		return nil, "", err
 	} else {
-		log.InfoLogger.Printf("Tasks found in cache: %s", allTasksData)
-		json.Unmarshal([]byte(allTasksData), &tasks)
+		log.InfoLogger.Printf("Tasks page found in cache: %s", pageKey)
+		json.Unmarshal([]byte(pageData), &page)
 	}
 
-	return tasks, nil
+	return page.Tasks, page.NextPageToken, nil
 }
 
-func (r *Repository) UpdateTask(task models.Task) error {
-	_, err := r.db.Exec("UPDATE tasks SET title = ?, description = ?, status = ? WHERE id = ?", task.Title, task.Description, task.Status, task.Id)
+// UpdateTask updates the task and returns it as stored in the database. A
+// status change is made only while the task is still in status from,
+// otherwise ErrStatusChanged is returned. A task with a non-zero version is
+// updated only while it is at that version, otherwise ErrVersionMismatch is
+// returned.
+func (r *Repository) UpdateTask(task models.Task, from string) (models.Task, error) {
+	// Make sure the user may change the task before touching it
+	task, previous, err := r.prepareUpdate(task)
 	if err != nil {
-		log.ErrorLogger.Printf("Failed to update task: %v", err)
-		return err
+		return task, err
 	}
 
-	// Update the task cache in Redis
-	taskKey := fmt.Sprintf("task:%d", task.Id)
-	taskJSON, err := json.Marshal(task)
+	err = r.changeTask(task.Id, task.UserId, func(tx *sql.Tx) error {
+		if err := checkVersion(tx, task.Id, task.Version); err != nil {
+			return err
+		}
+		return updateTaskRow(tx, task, from)
+	})
 	if err != nil {
-		log.ErrorLogger.Printf("Failed to marshal task for caching: %v", err)
-		return err
+		return task, err
 	}
 
-	err = r.redis.Set(context.Background(), taskKey, taskJSON, 0).Err()
+	// Members of the previous project must stop seeing the task if it moved
+	task, err = r.refreshTask(task.Id, previous)
 	if err != nil {
-		log.ErrorLogger.Printf("Failed to update task cache: %v", err)
+		return task, err
+	}
+
+	log.InfoLogger.Printf("Task updated and cached with ID: %d", task.Id)
+	return task, nil
+}
+
+// PatchTask changes only the named fields of the task and returns it as stored
+// in the database. The fields are named as in the task update mask. A status
+// change is made only while the task is still in status from, otherwise
+// ErrStatusChanged is returned. The version is checked as UpdateTask does.
+// Changing only the status needs the access TransitionTask needs.
+func (r *Repository) PatchTask(task models.Task, fields []string, from string) (models.Task, error) {
+	// Make sure the user may change the task before touching it
+	want := accessWrite
+	if len(fields) == 1 && fields[0] == "status" {
+		want = accessStatus
+	}
+	previous, err := r.checkAccess(task.Id, task.UserId, want)
+	if err != nil {
+		return task, err
+	}
+	if containsString(fields, "project_id") {
+		if err := r.checkProject(task.ProjectId, task.UserId); err != nil {
+			return task, err
+		}
+	}
+
+	// Columns are written in a fixed order, so a new recurrence sees the new due date
+	var sets []string
+	var args []interface{}
+	for _, field := range []string{"title", "description", "status", "due_at", "priority", "project_id", "recurrence"} {
+		if !containsString(fields, field) {
+			continue
+		}
+		switch field {
+		case "title":
+			sets, args = append(sets, "title = ?"), append(args, task.Title)
+		case "description":
+			sets, args = append(sets, "description = ?"), append(args, task.Description)
+		case "status":
+			sets, args = append(sets, "status = ?"), append(args, task.Status)
+		case "due_at":
+			sets, args = append(sets, "due_at = ?"), append(args, task.DueAt)
+		case "priority":
+			sets, args = append(sets, "priority = ?"), append(args, task.Priority)
+		case "project_id":
+			sets, args = append(sets, "project_id = ?"), append(args, nullID(task.ProjectId))
+		case "recurrence":
+			sets = append(sets, "recurrence = ?", "series_id = IF(recurrence = '', series_id, COALESCE(series_id, id))",
+				"occurrence_at = IF(recurrence = '', occurrence_at, COALESCE(occurrence_at, due_at))")
+			args = append(args, task.Recurrence)
+		}
+	}
+	sets, args = append(sets, "updated_at = ?"), append(args, time.Now().UTC().Truncate(time.Second), task.Id)
+
+	query := "UPDATE tasks SET " + strings.Join(sets, ", ") + " WHERE id = ?"
+	checkStatus := containsString(fields, "status") && from != task.Status
+	if checkStatus {
+		query += " AND status = ?"
+		args = append(args, from)
+	}
+
+	err = r.changeTask(task.Id, task.UserId, func(tx *sql.Tx) error {
+		if err := checkVersion(tx, task.Id, task.Version); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(query, args...)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to patch task: %v", err)
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to get rows affected: %v", err)
+			return err
+		}
+		if rowsAffected == 0 && checkStatus {
+			log.ErrorLogger.Printf("Task %d is no longer in status %s", task.Id, from)
+			return ErrStatusChanged
+		}
+		return nil
+	})
+	if err != nil {
+		return task, err
+	}
+
+	// Members of the previous project must stop seeing the task if it moved
+	task, err = r.refreshTask(task.Id, previous)
+	if err != nil {
+		return task, err
+	}
+
+	log.InfoLogger.Printf("Task %d patched: %v", task.Id, fields)
+	return task, nil
+}
+
+// containsString reports whether the value is among the values.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareUpdate fills in the defaults of the updated task and makes sure the
+// user may change it and move it to its project. It returns whom the task is
+// shared with before the update.
+func (r *Repository) prepareUpdate(task models.Task) (models.Task, taskRefs, error) {
+	previous, err := r.checkAccess(task.Id, task.UserId, accessWrite)
+	if err != nil {
+		return task, previous, err
+	}
+
+	if task.Status == "" {
+		task.Status = models.StatusTodo
+	}
+	if task.Priority == "" {
+		task.Priority = models.PriorityMedium
+	}
+	if err := r.checkProject(task.ProjectId, task.UserId); err != nil {
+		return task, previous, err
+	}
+
+	return task, previous, nil
+}
+
+// updateTaskRow writes the fields of the prepared task inside the transaction.
+// A task that becomes recurring starts a series scheduled for its due date;
+// the occurrence of a task already in a series stays where it was. A status
+// change is written only while the task is still in status from, otherwise
+// ErrStatusChanged is returned.
+func updateTaskRow(tx *sql.Tx, task models.Task, from string) error {
+	query := "UPDATE tasks SET title = ?, description = ?, status = ?, due_at = ?, priority = ?, project_id = ?, recurrence = ?, " +
+		"series_id = IF(recurrence = '', series_id, COALESCE(series_id, id)), occurrence_at = IF(recurrence = '', occurrence_at, COALESCE(occurrence_at, due_at)), updated_at = ? WHERE id = ?"
+	args := []interface{}{task.Title, task.Description, task.Status, task.DueAt, task.Priority, nullID(task.ProjectId), task.Recurrence, time.Now().UTC().Truncate(time.Second), task.Id}
+	checkStatus := from != task.Status
+	if checkStatus {
+		query += " AND status = ?"
+		args = append(args, from)
+	}
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to update task: %v", err)
 		return err
 	}
 
-	// Update the list of tasks for the user in Redis
-	tasksKey := fmt.Sprintf("tasks:user:%d", task.UserId)
-	allTasksData, err := r.redis.Get(context.Background(), tasksKey).Result()
-	if err == redis.Nil {
-		// If the list is not in cache, skip updating (as it would be re-cached on next retrieval)
-		log.InfoLogger.Printf("User's task list not in cache, skipping update")
-	} else if err != nil {
-		log.ErrorLogger.Printf("Failed to get user's task list from cache: %v", err)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get rows affected: %v", err)
 		return err
-	} else {
-		// Update the cached list of tasks
-		var tasks []models.Task
-		err = json.Unmarshal([]byte(allTasksData), &tasks)
+	}
+	if rowsAffected == 0 && checkStatus {
+		log.ErrorLogger.Printf("Task %d is no longer in status %s", task.Id, from)
+		return ErrStatusChanged
+	}
+	return nil
+}
+
+// TransitionTask moves the task from one status to another. It returns ErrStatusChanged
+// if the task is no longer in the expected status.
+func (r *Repository) TransitionTask(taskID int64, userID int64, from string, to string) (models.Task, error) {
+	// Make sure the user may change the status before touching it
+	if _, err := r.checkAccess(taskID, userID, accessStatus); err != nil {
+		return models.Task{}, err
+	}
+
+	err := r.changeTask(taskID, userID, func(tx *sql.Tx) error {
+		result, err := tx.Exec("UPDATE tasks SET status = ?, updated_at = ? WHERE id = ? AND status = ?",
+			to, time.Now().UTC().Truncate(time.Second), taskID, from)
 		if err != nil {
-			log.ErrorLogger.Printf("Failed to unmarshal tasks from cache: %v", err)
+			log.ErrorLogger.Printf("Failed to transition task: %v", err)
 			return err
 		}
-		for i, t := range tasks {
-			if t.Id == task.Id {
-				tasks[i] = task
-				break
-			}
-		}
-		tasksJSON, err := json.Marshal(tasks)
+
+		rowsAffected, err := result.RowsAffected()
 		if err != nil {
-			log.ErrorLogger.Printf("Failed to marshal updated tasks: %v", err)
+			log.ErrorLogger.Printf("Failed to get rows affected: %v", err)
 			return err
 		}
-		r.redis.Set(context.Background(), tasksKey, tasksJSON, 0)
-		log.InfoLogger.Printf("User's task list updated in cache")
+		if rowsAffected == 0 && from != to {
+			log.ErrorLogger.Printf("Task %d is no longer in status %s", taskID, from)
+			return ErrStatusChanged
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Task{}, err
 	}
 
-	log.InfoLogger.Printf("Task updated and cached with ID: %d", task.Id)
-	return nil
+	task, err := r.refreshTask(taskID)
+	if err != nil {
+		return task, err
+	}
+
+	log.InfoLogger.Printf("Task %d moved from %s to %s", taskID, from, to)
+	return task, nil
+}
+
+// AssignTask makes the assignee responsible for the task. A zero assigneeID unassigns it.
+func (r *Repository) AssignTask(taskID int64, userID int64, assigneeID int64) (models.Task, error) {
+	// Make sure the user may change the task before touching it
+	previous, err := r.checkAccess(taskID, userID, accessWrite)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	err = r.changeTask(taskID, userID, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE tasks SET assignee_id = ?, updated_at = ? WHERE id = ?",
+			nullID(assigneeID), time.Now().UTC().Truncate(time.Second), taskID)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to assign task: %v", err)
+		}
+		return err
+	})
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	// The previous assignee must stop seeing the task in their lists
+	task, err := r.refreshTask(taskID, previous)
+	if err != nil {
+		return task, err
+	}
+
+	log.InfoLogger.Printf("Task %d assigned to %d", taskID, assigneeID)
+	return task, nil
+}
+
+// refreshTask reads the task from the database, caches it in Redis,
+// invalidates the cached task lists of everyone who can see it now or could
+// see it before and tells them the task was updated.
+func (r *Repository) refreshTask(taskID int64, previous ...taskRefs) (models.Task, error) {
+	tasks, err := r.refreshTasks([]int64{taskID}, previous...)
+	if err != nil {
+		return models.Task{}, err
+	}
+	if len(tasks) == 0 {
+		log.ErrorLogger.Printf("Failed to get updated task with ID: %d", taskID)
+		return models.Task{}, ErrTaskNotFound
+	}
+
+	return tasks[0], nil
+}
+
+// refreshTasks does what refreshTask does for several tasks at once, so the
+// cached task lists of every user are invalidated only once. It returns the
+// tasks ordered by id.
+func (r *Repository) refreshTasks(taskIDs []int64, previous ...taskRefs) ([]models.Task, error) {
+	return r.refreshChanged(models.EventUpdated, taskIDs, previous...)
+}
+
+// refreshChanged does what refreshTasks does, telling everyone who can see the
+// tasks that they changed with the action: created or updated.
+func (r *Repository) refreshChanged(action string, taskIDs []int64, previous ...taskRefs) ([]models.Task, error) {
+	var tasks []models.Task
+	if len(taskIDs) == 0 {
+		return tasks, r.invalidateTaskAudience(previous...)
+	}
+
+	// Read the tasks back to get the columns maintained by the database
+	rows, err := r.db.Query("SELECT "+taskColumns+" FROM tasks WHERE id IN ("+placeholders(len(taskIDs))+") ORDER BY id", idArgs(taskIDs)...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get updated tasks: %v", err)
+		return tasks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to scan task: %v", err)
+			return tasks, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return tasks, err
+	}
+
+	if err := r.loadTags(tasks); err != nil {
+		return tasks, err
+	}
+
+	// Update the task caches in Redis
+	refs := append([]taskRefs{}, previous...)
+	changed := make(map[int64]taskRefs, len(tasks))
+	_, err = r.redis.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, task := range tasks {
+			taskJSON, err := json.Marshal(task)
+			if err != nil {
+				log.ErrorLogger.Printf("Failed to marshal task for caching: %v", err)
+				return err
+			}
+			pipe.Set(context.Background(), fmt.Sprintf("task:%d", task.Id), taskJSON, 0)
+			refs = append(refs, refsOf(task))
+			changed[task.Id] = refsOf(task)
+		}
+		return nil
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to update task cache: %v", err)
+		return tasks, err
+	}
+
+	// Invalidate the cached task lists of everyone who can see the tasks
+	if err := r.invalidateTaskAudience(refs...); err != nil {
+		return tasks, err
+	}
+
+	if err := r.publishChanges(action, changed, previous...); err != nil {
+		return tasks, err
+	}
+
+	return tasks, nil
+}
+
+// DeleteTask moves the task to the trash. With cascade its subtasks are moved
+// to the trash too, otherwise they are moved to the parent of the deleted task.
+// Tasks in the trash keep their tags and comments until they are purged.
+func (r *Repository) DeleteTask(taskID int64, userID int64, cascade bool) error {
+	return r.DeleteTaskIfVersion(taskID, userID, cascade, 0)
 }
 
-func (r *Repository) DeleteTask(taskID int64) error {
-	// Get the task to retrieve userID
-	var userID int64
-	err := r.db.QueryRow("SELECT user_id FROM tasks WHERE id = ?", taskID).Scan(&userID)
+// DeleteTaskIfVersion deletes the task like DeleteTask while it is at the
+// given version, otherwise it returns ErrVersionMismatch. A zero version is
+// not checked.
+func (r *Repository) DeleteTaskIfVersion(taskID int64, userID int64, cascade bool, version int64) error {
+	// Make sure the user may change the task before deleting it
+	refs, err := r.checkAccess(taskID, userID, accessWrite)
 	if err != nil {
-		log.ErrorLogger.Printf("Failed to get task user_id: %v", err)
 		return err
 	}
 
-	// Delete the task from the database
-	_, err = r.db.Exec("DELETE FROM tasks WHERE id = ?", taskID)
+	tx, err := r.db.Begin()
 	if err != nil {
-		log.ErrorLogger.Printf("Failed to delete task: %v", err)
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
 		return err
 	}
+	defer tx.Rollback()
 
-	// Delete the task cache in Redis
-	taskKey := fmt.Sprintf("task:%d", taskID)
-	err = r.redis.Del(context.Background(), taskKey).Err()
+	if err := checkVersion(tx, taskID, version); err != nil {
+		return err
+	}
+
+	deleted, moved, err := trashTask(tx, taskID, userID, cascade)
 	if err != nil {
-		log.ErrorLogger.Printf("Failed to delete task cache: %v", err)
 		return err
 	}
 
-	// Update the list of tasks for the user in Redis
-	tasksKey := fmt.Sprintf("tasks:user:%d", userID)
-	allTasksData, err := r.redis.Get(context.Background(), tasksKey).Result()
-	if err == redis.Nil {
-		// If the list is not in cache, skip updating (as it would be re-cached on next retrieval)
-		log.InfoLogger.Printf("User's task list not in cache, skipping update")
-	} else if err != nil {
-		log.ErrorLogger.Printf("Failed to get user's task list from cache: %v", err)
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return err
+	}
+
+	// Delete the task caches in Redis
+	if err := r.forgetTasks(append(deleted, moved...)); err != nil {
+		return err
+	}
+
+	// Invalidate the cached task lists of everyone who could see the task
+	if err := r.invalidateTaskAudience(refs); err != nil {
 		return err
+	}
+
+	if err := r.publishTaskChanges(models.EventDeleted, deleted); err != nil {
+		return err
+	}
+	if err := r.publishTaskChanges(models.EventUpdated, moved); err != nil {
+		return err
+	}
+
+	log.InfoLogger.Printf("Task moved to the trash and cache updated with ID: %d", taskID)
+	return nil
+}
+
+// trashTask moves the task to the trash inside the transaction as DeleteTask
+// describes. It returns the ids of the tasks moved to the trash, the task
+// first, and of the subtasks moved to its parent.
+func trashTask(tx *sql.Tx, taskID int64, userID int64, cascade bool) ([]int64, []int64, error) {
+	var parentID sql.NullInt64
+	err := tx.QueryRow("SELECT parent_id FROM tasks WHERE id = ?", taskID).Scan(&parentID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get task parent_id: %v", err)
+		return nil, nil, err
+	}
+
+	// Tasks whose cached copies become stale
+	deleted := []int64{taskID}
+	var moved []int64
+
+	if cascade {
+		descendants, err := descendantIDs(tx, taskID)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Subtasks deleted earlier stay in the trash on their own
+		descendants, err = liveIDs(tx, descendants)
+		if err != nil {
+			return nil, nil, err
+		}
+		deleted = append(deleted, descendants...)
 	} else {
-		// Update the cached list of tasks
-		var tasks []models.Task
-		err = json.Unmarshal([]byte(allTasksData), &tasks)
+		moved, err = childIDs(tx, taskID)
 		if err != nil {
-			log.ErrorLogger.Printf("Failed to unmarshal tasks from cache: %v", err)
-			return err
+			return nil, nil, err
 		}
-		for i, t := range tasks {
-			if t.Id == taskID {
-				tasks = append(tasks[:i], tasks[i+1:]...)
-				break
+
+		_, err = tx.Exec("UPDATE tasks SET parent_id = ? WHERE parent_id = ?", parentID, taskID)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to reparent subtasks: %v", err)
+			return nil, nil, err
+		}
+
+		for _, id := range moved {
+			change := models.FieldChange{Field: "parent_id", From: formatID(taskID), To: formatID(parentID.Int64)}
+			if err := recordEvent(tx, id, userID, models.EventUpdated, []models.FieldChange{change}); err != nil {
+				return nil, nil, err
 			}
 		}
-		tasksJSON, err := json.Marshal(tasks)
+	}
+
+	// The history keeps the last state of every deleted task
+	for _, id := range deleted {
+		task, err := readTask(tx, id, false)
 		if err != nil {
-			log.ErrorLogger.Printf("Failed to marshal updated tasks: %v", err)
-			return err
+			return nil, nil, err
+		}
+		if err := recordEvent(tx, id, userID, models.EventDeleted, diffTasks(task, models.Task{})); err != nil {
+			return nil, nil, err
 		}
-		r.redis.Set(context.Background(), tasksKey, tasksJSON, 0)
-		log.InfoLogger.Printf("User's task list updated in cache after deletion")
 	}
 
-	log.InfoLogger.Printf("Task deleted and cache updated with ID: %d", taskID)
-	return nil
+	// Tasks deleted together share the moment, so they are restored together
+	args := append([]interface{}{time.Now().UTC().Truncate(time.Second)}, idArgs(deleted)...)
+	_, err = tx.Exec("UPDATE tasks SET deleted_at = ? WHERE id IN ("+placeholders(len(deleted))+")", args...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to move task to the trash: %v", err)
+		return nil, nil, err
+	}
+
+	return deleted, moved, nil
+}
+
+// GetOverdueTasks returns the open tasks visible to the user due before the given time, earliest first.
+// Done and cancelled tasks are never overdue. The result depends on the current time,
+// so it is always read from the database.
+func (r *Repository) GetOverdueTasks(userID int64, dueBefore time.Time) ([]models.Task, error) {
+	var tasks []models.Task
+
+	rows, err := r.db.Query("SELECT "+taskColumns+" FROM tasks WHERE "+visibleTasks+" AND status NOT IN (?, ?) AND due_at IS NOT NULL AND due_at <= ? ORDER BY due_at, id",
+		userID, userID, userID, models.StatusDone, models.StatusCancelled, dueBefore)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get overdue tasks from db: %v", err)
+		return tasks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to scan task: %v", err)
+			return tasks, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return tasks, err
+	}
+
+	if err := r.loadTags(tasks); err != nil {
+		return tasks, err
+	}
+
+	return tasks, nil
 }
 
 func (r *Repository) GetUserIdWithUsername(username string) (int64, error) {
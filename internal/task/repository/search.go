@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+const (
+	// maxSearchTerms bounds the number of words of a search query that are used.
+	maxSearchTerms = 10
+	// snippetLength is the approximate length of a highlighted snippet in bytes.
+	snippetLength = 160
+	// snippetLead is how many words before the first match a snippet starts.
+	snippetLead = 5
+	// maxCommentHighlights bounds the number of comment snippets of a result.
+	maxCommentHighlights = 2
+	// searchSort is the sort order of the page tokens of search results.
+	searchSort = "score DESC"
+)
+
+// wordPattern matches the words of a text the way the FULLTEXT parser splits them.
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// searchMatch matches a FULLTEXT index against the boolean query.
+const searchMatch = "MATCH(%s) AGAINST(? IN BOOLEAN MODE)"
+
+// searchScore ranks a task: title matches weigh the most, then tags, then the
+// description and comments. It takes the boolean query four times.
+var searchScore = "(3 * " + fmt.Sprintf(searchMatch, "title") +
+	" + " + fmt.Sprintf(searchMatch, "description") +
+	" + COALESCE((SELECT SUM(" + fmt.Sprintf(searchMatch, "c.body") + ") FROM task_comments c WHERE c.task_id = tasks.id), 0)" +
+	" + 2 * COALESCE((SELECT SUM(" + fmt.Sprintf(searchMatch, "g.name") + ") FROM task_tags tt JOIN tags g ON g.id = tt.tag_id WHERE tt.task_id = tasks.id), 0))"
+
+// searchFilter keeps the tasks that match in any of the indexed fields. It
+// takes the boolean query four times.
+var searchFilter = "(" + fmt.Sprintf(searchMatch, "title") +
+	" OR " + fmt.Sprintf(searchMatch, "description") +
+	" OR id IN (SELECT task_id FROM task_comments WHERE " + fmt.Sprintf(searchMatch, "body") + ")" +
+	" OR id IN (SELECT tt.task_id FROM task_tags tt JOIN tags g ON g.id = tt.tag_id WHERE " + fmt.Sprintf(searchMatch, "g.name") + "))"
+
+// SearchTasks returns a page of the tasks visible to the user that match the
+// query in their title, description, comments or tags, best matches first,
+// and the token of the next page. Every word of the query also matches the
+// words it is a prefix of.
+func (r *Repository) SearchTasks(userID int64, query string, pageSize int32, pageToken string) ([]models.SearchResult, string, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, "", fmt.Errorf("%w: search query has no words", ErrInvalidFilter)
+	}
+	booleanQuery := booleanSearchQuery(terms)
+
+	cursor, err := decodePageCursor(pageToken, searchSort)
+	if err != nil {
+		return nil, "", err
+	}
+	limit := int(pageSize)
+	if limit <= 0 {
+		limit = defaultPageSize
+	} else if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	// The scores are computed in a derived table, so the page can start after
+	// the score and id of the last result of the previous one
+	args := []interface{}{booleanQuery, booleanQuery, booleanQuery, booleanQuery, userID, userID, userID, booleanQuery, booleanQuery, booleanQuery, booleanQuery}
+	after := ""
+	if cursor != nil {
+		score, err := strconv.ParseFloat(cursor.Key, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: malformed page token", ErrInvalidFilter)
+		}
+		after = " WHERE (score, id) < (?, ?)"
+		args = append(args, score, cursor.Id)
+	}
+	args = append(args, limit+1)
+
+	rows, err := r.db.Query("SELECT "+taskColumns+", score FROM (SELECT "+taskColumns+", "+searchScore+" AS score FROM tasks WHERE "+visibleTasks+" AND "+searchFilter+
+		") AS found"+after+" ORDER BY score DESC, id DESC LIMIT ?", args...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to search tasks: %v", err)
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() {
+		var result models.SearchResult
+		task, err := scanTask(withColumns(rows, &result.Score))
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to scan task: %v", err)
+			return nil, "", err
+		}
+		result.Task = task
+		results = append(results, result)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return nil, "", err
+	}
+
+	// One extra row was requested to find out whether there is a next page
+	var nextPageToken string
+	if len(results) > limit {
+		results = results[:limit]
+		last := results[limit-1]
+		nextPageToken = encodePageCursor(searchSort, strconv.FormatFloat(last.Score, 'g', -1, 64), last.Task.Id)
+	}
+
+	if err := r.highlight(results, terms, booleanQuery); err != nil {
+		return nil, "", err
+	}
+
+	return results, nextPageToken, nil
+}
+
+// highlight loads the tags of the found tasks and fills in the snippets of
+// the fields that match the terms.
+func (r *Repository) highlight(results []models.SearchResult, terms []string, booleanQuery string) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	tasks := make([]models.Task, len(results))
+	ids := make([]int64, len(results))
+	for i, result := range results {
+		tasks[i] = result.Task
+		ids[i] = result.Task.Id
+	}
+	if err := r.loadTags(tasks); err != nil {
+		return err
+	}
+
+	args := append(idArgs(ids), booleanQuery)
+	rows, err := r.db.Query("SELECT task_id, body FROM task_comments WHERE task_id IN ("+placeholders(len(ids))+") AND "+fmt.Sprintf(searchMatch, "body")+" ORDER BY id", args...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get matching comments: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	comments := make(map[int64][]string)
+	for rows.Next() {
+		var taskID int64
+		var body string
+		if err := rows.Scan(&taskID, &body); err != nil {
+			log.ErrorLogger.Printf("Failed to scan comment: %v", err)
+			return err
+		}
+		comments[taskID] = append(comments[taskID], body)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return err
+	}
+
+	for i := range results {
+		task := tasks[i]
+		results[i].Task = task
+		results[i].Highlights = []models.SearchHighlight{}
+
+		add := func(field, text string) bool {
+			snippet, ok := highlightSnippet(text, terms)
+			if ok {
+				results[i].Highlights = append(results[i].Highlights, models.SearchHighlight{Field: field, Snippet: snippet})
+			}
+			return ok
+		}
+
+		add("title", task.Title)
+		add("description", task.Description)
+		for _, tag := range task.Tags {
+			add("tag", tag)
+		}
+		added := 0
+		for _, body := range comments[task.Id] {
+			if added < maxCommentHighlights && add("comment", body) {
+				added++
+			}
+		}
+	}
+
+	return nil
+}
+
+// searchTerms splits the query into distinct lowercase words.
+func searchTerms(query string) []string {
+	var terms []string
+	for _, word := range wordPattern.FindAllString(strings.ToLower(query), -1) {
+		if !containsString(terms, word) {
+			terms = append(terms, word)
+		}
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// booleanSearchQuery turns the words into a FULLTEXT boolean query in which
+// any word may match, as a prefix. The words contain no operators.
+func booleanSearchQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term + "*"
+	}
+	return strings.Join(parts, " ")
+}
+
+// highlightSnippet returns a piece of the text around its first word that
+// starts with one of the terms, HTML-escaped, with every such word wrapped
+// in <mark>. The second result is false when no word matches.
+func highlightSnippet(text string, terms []string) (string, bool) {
+	words := wordPattern.FindAllStringIndex(text, -1)
+
+	first := -1
+	for i, word := range words {
+		if matchesTerm(text[word[0]:word[1]], terms) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	// Start a few words before the first match and stop near snippetLength
+	startWord := first - snippetLead
+	if startWord < 0 {
+		startWord = 0
+	}
+	start := words[startWord][0]
+	if startWord == 0 {
+		start = 0
+	}
+	endWord := first
+	for endWord+1 < len(words) && words[endWord+1][1]-start <= snippetLength {
+		endWord++
+	}
+	end := words[endWord][1]
+	if endWord == len(words)-1 {
+		end = len(text)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, word := range words[startWord : endWord+1] {
+		if !matchesTerm(text[word[0]:word[1]], terms) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:word[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[word[0]:word[1]]))
+		b.WriteString("</mark>")
+		pos = word[1]
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+
+	return b.String(), true
+}
+
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
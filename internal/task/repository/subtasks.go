@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// GetSubtasks returns the direct subtasks of the user's task.
+func (r *Repository) GetSubtasks(parentID int64, userID int64) ([]models.Task, error) {
+	var tasks []models.Task
+
+	if _, err := r.checkAccess(parentID, userID, accessRead); err != nil {
+		return tasks, err
+	}
+
+	childrenKey, err := r.taskListKey(userID, fmt.Sprintf("children:%d", parentID))
+	if err != nil {
+		return tasks, err
+	}
+
+	childrenData, err := r.redis.Get(context.Background(), childrenKey).Result()
+	if err == redis.Nil {
+		// If subtasks not found in cache, get them from the database
+		log.InfoLogger.Printf("Subtasks not found in cache, fetching from database")
+		rows, err := r.db.Query("SELECT "+taskColumns+" FROM tasks WHERE parent_id = ? AND "+visibleTasks+" ORDER BY id", parentID, userID, userID, userID)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to get subtasks from db: %v", err)
+			return tasks, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			task, err := scanTask(rows)
+			if err != nil {
+				log.ErrorLogger.Printf("Failed to scan task: %v", err)
+				return tasks, err
+			}
+			tasks = append(tasks, task)
+		}
+		if err = rows.Err(); err != nil {
+			log.ErrorLogger.Printf("Rows error: %v", err)
+			return tasks, err
+		}
+
+		if err := r.loadTags(tasks); err != nil {
+			return tasks, err
+		}
+
+		// Cache the subtasks in Redis
+		tasksJSON, err := json.Marshal(tasks)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to marshal subtasks: %v", err)
+			return tasks, err
+		}
+
+		r.redis.Set(context.Background(), childrenKey, tasksJSON, taskPageTTL)
+		log.InfoLogger.Printf("Subtasks cached: %s", childrenKey)
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get subtasks from cache: %v", err)
+		return tasks, err
+	} else {
+		log.InfoLogger.Printf("Subtasks found in cache: %s", childrenKey)
+		json.Unmarshal([]byte(childrenData), &tasks)
+	}
+
+	return tasks, nil
+}
+
+// MoveTask attaches the task to another parent. A zero parentID makes it a top-level task.
+func (r *Repository) MoveTask(taskID int64, userID int64, parentID int64) (models.Task, error) {
+	// Make sure the user may change the task before touching it
+	if _, err := r.checkAccess(taskID, userID, accessWrite); err != nil {
+		return models.Task{}, err
+	}
+
+	if parentID != 0 {
+		if err := r.checkParent(parentID, userID); err != nil {
+			return models.Task{}, err
+		}
+
+		// A task cannot be moved under itself or under one of its subtasks
+		descendants, err := descendantIDs(r.db, taskID)
+		if err != nil {
+			return models.Task{}, err
+		}
+		if parentID == taskID || containsID(descendants, parentID) {
+			log.ErrorLogger.Printf("Moving task %d under %d would create a cycle", taskID, parentID)
+			return models.Task{}, fmt.Errorf("%w: task %d cannot be moved under its own subtask", ErrInvalidParent, taskID)
+		}
+	}
+
+	err := r.changeTask(taskID, userID, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE tasks SET parent_id = ?, updated_at = ? WHERE id = ?",
+			nullID(parentID), time.Now().UTC().Truncate(time.Second), taskID)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to move task: %v", err)
+		}
+		return err
+	})
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	task, err := r.refreshTask(taskID)
+	if err != nil {
+		return task, err
+	}
+
+	log.InfoLogger.Printf("Task %d moved under %d", taskID, parentID)
+	return task, nil
+}
+
+// checkParent returns ErrInvalidParent unless the user may change the parent task.
+func (r *Repository) checkParent(parentID int64, userID int64) error {
+	_, err := r.checkAccess(parentID, userID, accessWrite)
+	if err == ErrTaskNotFound {
+		return fmt.Errorf("%w: parent task %d not found", ErrInvalidParent, parentID)
+	}
+	return err
+}
+
+// forgetTasks drops the cached copies of the tasks.
+func (r *Repository) forgetTasks(taskIDs []int64) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(taskIDs))
+	for _, id := range taskIDs {
+		keys = append(keys, fmt.Sprintf("task:%d", id))
+	}
+
+	if err := r.redis.Del(context.Background(), keys...).Err(); err != nil {
+		log.ErrorLogger.Printf("Failed to delete task cache: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// childIDs returns the ids of the direct subtasks of the task.
+func childIDs(q querier, taskID int64) ([]int64, error) {
+	return queryIDs(q, "SELECT id FROM tasks WHERE parent_id = ?", taskID)
+}
+
+// descendantIDs returns the ids of all subtasks of the task, level by level.
+func descendantIDs(q querier, taskID int64) ([]int64, error) {
+	var descendants []int64
+
+	level := []int64{taskID}
+	for len(level) > 0 {
+		children, err := queryIDs(q, "SELECT id FROM tasks WHERE parent_id IN ("+placeholders(len(level))+")", idArgs(level)...)
+		if err != nil {
+			return nil, err
+		}
+		descendants = append(descendants, children...)
+		level = children
+	}
+
+	return descendants, nil
+}
+
+func queryIDs(q querier, query string, args ...interface{}) ([]int64, error) {
+	var ids []int64
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get task ids: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.ErrorLogger.Printf("Failed to scan task id: %v", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func idArgs(ids []int64) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// nullID stores a zero id as NULL.
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	// ErrTagNotFound is returned when a tag does not exist or belongs to another user.
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrTagExists is returned when the user already has a tag with the same name.
+	ErrTagExists = errors.New("tag already exists")
+)
+
+// mysqlDuplicateEntry is the MySQL error number of unique key violations.
+const mysqlDuplicateEntry = 1062
+
+// CreateTag creates a tag of the user.
+func (r *Repository) CreateTag(userID int64, name string) (models.Tag, error) {
+	result, err := r.db.Exec("INSERT INTO tags (user_id, name) VALUES (?, ?)", userID, name)
+	if isDuplicate(err) {
+		return models.Tag{}, fmt.Errorf("%w: %q", ErrTagExists, name)
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to insert tag into db: %v", err)
+		return models.Tag{}, err
+	}
+
+	tagID, err := result.LastInsertId()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get last insert ID: %v", err)
+		return models.Tag{}, err
+	}
+
+	log.InfoLogger.Printf("Tag created with ID: %d", tagID)
+	return models.Tag{Id: tagID, Name: name, UserId: userID}, nil
+}
+
+// GetTags returns the tags of the user ordered by name.
+func (r *Repository) GetTags(userID int64) ([]models.Tag, error) {
+	var tags []models.Tag
+
+	rows, err := r.db.Query("SELECT id, name, user_id FROM tags WHERE user_id = ? ORDER BY name", userID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get tags from db: %v", err)
+		return tags, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.Id, &tag.Name, &tag.UserId); err != nil {
+			log.ErrorLogger.Printf("Failed to scan tag: %v", err)
+			return tags, err
+		}
+		tags = append(tags, tag)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return tags, err
+	}
+
+	return tags, nil
+}
+
+// RenameTag renames the user's tag and refreshes the tasks that carry it.
+func (r *Repository) RenameTag(tagID int64, userID int64, name string) (models.Tag, error) {
+	if err := r.checkTag(tagID, userID); err != nil {
+		return models.Tag{}, err
+	}
+
+	_, err := r.db.Exec("UPDATE tags SET name = ? WHERE id = ?", name, tagID)
+	if isDuplicate(err) {
+		return models.Tag{}, fmt.Errorf("%w: %q", ErrTagExists, name)
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to rename tag: %v", err)
+		return models.Tag{}, err
+	}
+
+	taskIDs, err := queryIDs(r.db, "SELECT task_id FROM task_tags WHERE tag_id = ?", tagID)
+	if err != nil {
+		return models.Tag{}, err
+	}
+	if err := r.tasksChanged(taskIDs); err != nil {
+		return models.Tag{}, err
+	}
+
+	log.InfoLogger.Printf("Tag %d renamed to %s", tagID, name)
+	return models.Tag{Id: tagID, Name: name, UserId: userID}, nil
+}
+
+// DeleteTag deletes the user's tag and detaches it from every task.
+func (r *Repository) DeleteTag(tagID int64, userID int64) error {
+	if err := r.checkTag(tagID, userID); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	taskIDs, err := queryIDs(tx, "SELECT task_id FROM task_tags WHERE tag_id = ?", tagID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM task_tags WHERE tag_id = ?", tagID); err != nil {
+		log.ErrorLogger.Printf("Failed to detach tag: %v", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", tagID); err != nil {
+		log.ErrorLogger.Printf("Failed to delete tag: %v", err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return err
+	}
+
+	if err := r.tasksChanged(taskIDs); err != nil {
+		return err
+	}
+
+	log.InfoLogger.Printf("Tag deleted with ID: %d", tagID)
+	return nil
+}
+
+// AttachTag puts the user's tag on a task the user may change.
+func (r *Repository) AttachTag(taskID int64, tagID int64, userID int64) (models.Task, error) {
+	if _, err := r.checkAccess(taskID, userID, accessWrite); err != nil {
+		return models.Task{}, err
+	}
+	if err := r.checkTag(tagID, userID); err != nil {
+		return models.Task{}, err
+	}
+
+	err := r.changeTask(taskID, userID, func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT IGNORE INTO task_tags (task_id, tag_id) VALUES (?, ?)", taskID, tagID)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to attach tag: %v", err)
+		}
+		return err
+	})
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	return r.refreshTask(taskID)
+}
+
+// DetachTag takes the user's tag off a task the user may change.
+func (r *Repository) DetachTag(taskID int64, tagID int64, userID int64) (models.Task, error) {
+	if _, err := r.checkAccess(taskID, userID, accessWrite); err != nil {
+		return models.Task{}, err
+	}
+	if err := r.checkTag(tagID, userID); err != nil {
+		return models.Task{}, err
+	}
+
+	err := r.changeTask(taskID, userID, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM task_tags WHERE task_id = ? AND tag_id = ?", taskID, tagID)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to detach tag: %v", err)
+		}
+		return err
+	})
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	return r.refreshTask(taskID)
+}
+
+// loadTags fills in the tag names of the tasks.
+func (r *Repository) loadTags(tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(tasks))
+	ids := make([]int64, 0, len(tasks))
+	for i, task := range tasks {
+		index[task.Id] = i
+		ids = append(ids, task.Id)
+	}
+
+	rows, err := r.db.Query("SELECT tt.task_id, g.name FROM task_tags tt JOIN tags g ON g.id = tt.tag_id WHERE tt.task_id IN ("+placeholders(len(ids))+") ORDER BY g.name", idArgs(ids)...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get task tags: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskID int64
+		var name string
+		if err := rows.Scan(&taskID, &name); err != nil {
+			log.ErrorLogger.Printf("Failed to scan task tag: %v", err)
+			return err
+		}
+		i := index[taskID]
+		tasks[i].Tags = append(tasks[i].Tags, name)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// checkTag returns ErrTagNotFound unless the tag belongs to the user.
+func (r *Repository) checkTag(tagID int64, userID int64) error {
+	var ownerID int64
+	err := r.db.QueryRow("SELECT user_id FROM tags WHERE id = ?", tagID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		log.ErrorLogger.Printf("Tag %d not found for user ID: %d", tagID, userID)
+		return ErrTagNotFound
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get tag user_id: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// tasksChanged drops the cached copies of the tasks and the cached task lists
+// of everyone they are shared with, and tells them the tasks changed.
+func (r *Repository) tasksChanged(taskIDs []int64) error {
+	tasks, err := r.taskRefsByID(taskIDs)
+	if err != nil || len(tasks) == 0 {
+		return err
+	}
+
+	refs := make([]taskRefs, 0, len(tasks))
+	for _, ref := range tasks {
+		refs = append(refs, ref)
+	}
+
+	if err := r.forgetTasks(taskIDs); err != nil {
+		return err
+	}
+	if err := r.invalidateTaskAudience(refs...); err != nil {
+		return err
+	}
+	return r.publishChanges(models.EventUpdated, tasks)
+}
+
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+// exportChunkSize is the number of tasks read from the database at a time
+// while exporting.
+const exportChunkSize = 200
+
+// ExportTasks passes the tasks of the user that are not in the trash to send
+// one by one, oldest first, with their tags. The tasks are read in chunks, so
+// the export does not hold all of them in memory. An error returned by send
+// stops the export.
+func (r *Repository) ExportTasks(userID int64, send func(models.Task) error) error {
+	var lastID int64
+	for {
+		tasks, err := r.exportChunk(userID, lastID)
+		if err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			break
+		}
+
+		if err := r.loadTags(tasks); err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			if err := send(task); err != nil {
+				log.ErrorLogger.Printf("Failed to send exported task: %v", err)
+				return err
+			}
+		}
+
+		if len(tasks) < exportChunkSize {
+			break
+		}
+		lastID = tasks[len(tasks)-1].Id
+	}
+
+	log.InfoLogger.Printf("Tasks exported for user ID: %d", userID)
+	return nil
+}
+
+// exportChunk returns the next chunk of the user's tasks after lastID.
+func (r *Repository) exportChunk(userID int64, lastID int64) ([]models.Task, error) {
+	rows, err := r.db.Query("SELECT "+taskColumns+" FROM tasks WHERE user_id = ? AND deleted_at IS NULL AND id > ? ORDER BY id LIMIT ?", userID, lastID, exportChunkSize)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get tasks to export: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to scan task: %v", err)
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// ImportTasks creates the tasks for the user in one transaction, with their
+// tags, creating the tags the user does not have yet. A task that cannot be
+// created fails on its own and does not stop the others. A dry run reports
+// the same results but saves nothing; its tasks have no ids.
+func (r *Repository) ImportTasks(userID int64, tasks []models.Task, dryRun bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(tasks))
+	prepared := make([]models.Task, len(tasks))
+	for i, task := range tasks {
+		// Imported tasks keep their status but are never subtasks
+		task.UserId = userID
+		task.ParentId = 0
+		prepared[i], results[i].Err = r.prepareTask(task)
+	}
+
+	err := r.runBatch(results, dryRun, func(tx *sql.Tx, i int) error {
+		taskID, err := insertTask(tx, prepared[i])
+		if err != nil {
+			return err
+		}
+		results[i].Task.Id = taskID
+		return tagTask(tx, taskID, userID, prepared[i].Tags)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Task = prepared[i]
+			}
+		}
+		return results, nil
+	}
+
+	if err := r.refreshResults(results, models.EventCreated); err != nil {
+		return results, err
+	}
+
+	log.InfoLogger.Printf("Batch of %d tasks imported for user ID: %d", len(tasks), userID)
+	return results, nil
+}
+
+// tagTask puts the user's tags with the names on the task, creating the tags
+// that do not exist yet.
+func tagTask(tx *sql.Tx, taskID int64, userID int64, names []string) error {
+	for _, name := range names {
+		// LAST_INSERT_ID(id) makes an existing tag report its id as inserted
+		result, err := tx.Exec("INSERT INTO tags (user_id, name) VALUES (?, ?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)", userID, name)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to insert tag into db: %v", err)
+			return err
+		}
+		tagID, err := result.LastInsertId()
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to get last insert ID: %v", err)
+			return err
+		}
+
+		if _, err := tx.Exec("INSERT IGNORE INTO task_tags (task_id, tag_id) VALUES (?, ?)", taskID, tagID); err != nil {
+			log.ErrorLogger.Printf("Failed to attach tag: %v", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+// ListTrash returns the tasks in the trash the user may restore, most recently deleted first.
+func (r *Repository) ListTrash(userID int64) ([]models.Task, error) {
+	var tasks []models.Task
+
+	rows, err := r.db.Query("SELECT "+taskColumns+" FROM tasks WHERE "+trashedTasks+" ORDER BY deleted_at DESC, id", userID, userID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get trash from db: %v", err)
+		return tasks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to scan task: %v", err)
+			return tasks, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return tasks, err
+	}
+
+	if err := r.loadTags(tasks); err != nil {
+		return tasks, err
+	}
+
+	return tasks, nil
+}
+
+// RestoreTask takes the task out of the trash together with the subtasks
+// deleted with it. A task whose parent is no longer available becomes a
+// top-level task.
+func (r *Repository) RestoreTask(taskID int64, userID int64) (models.Task, error) {
+	if _, err := r.checkTrashAccess(taskID, userID); err != nil {
+		return models.Task{}, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return models.Task{}, err
+	}
+	defer tx.Rollback()
+
+	root, err := readTask(tx, taskID, true)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	restored, err := trashBatch(tx, root)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	var changes []models.FieldChange
+	if root.ParentId != 0 {
+		var parentTrashed bool
+		err := tx.QueryRow("SELECT deleted_at IS NOT NULL FROM tasks WHERE id = ?", root.ParentId).Scan(&parentTrashed)
+		if err != nil && err != sql.ErrNoRows {
+			log.ErrorLogger.Printf("Failed to get parent task: %v", err)
+			return models.Task{}, err
+		}
+
+		if err == sql.ErrNoRows || parentTrashed {
+			if _, err := tx.Exec("UPDATE tasks SET parent_id = NULL WHERE id = ?", taskID); err != nil {
+				log.ErrorLogger.Printf("Failed to detach restored task: %v", err)
+				return models.Task{}, err
+			}
+			changes = append(changes, models.FieldChange{Field: "parent_id", From: formatID(root.ParentId)})
+		}
+	}
+
+	_, err = tx.Exec("UPDATE tasks SET deleted_at = NULL WHERE id IN ("+placeholders(len(restored))+")", idArgs(restored)...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to restore tasks: %v", err)
+		return models.Task{}, err
+	}
+
+	for _, id := range restored {
+		var taskChanges []models.FieldChange
+		if id == taskID {
+			taskChanges = changes
+		}
+		if err := recordEvent(tx, id, userID, models.EventRestored, taskChanges); err != nil {
+			return models.Task{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return models.Task{}, err
+	}
+
+	// Cache the restored tasks and show them in the task lists again; to
+	// watchers they reappear as created
+	tasks, err := r.refreshChanged(models.EventCreated, restored)
+	if err != nil {
+		return models.Task{}, err
+	}
+	var task models.Task
+	for _, restoredTask := range tasks {
+		if restoredTask.Id == taskID {
+			task = restoredTask
+		}
+	}
+
+	log.InfoLogger.Printf("Task restored from the trash with ID: %d", taskID)
+	return task, nil
+}
+
+// PurgeTask deletes the task in the trash for good together with the
+// subtasks deleted with it, their tags and comments. Their history is kept.
+func (r *Repository) PurgeTask(taskID int64, userID int64) error {
+	if _, err := r.checkTrashAccess(taskID, userID); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	root, err := readTask(tx, taskID, true)
+	if err != nil {
+		return err
+	}
+
+	purged, err := trashBatch(tx, root)
+	if err != nil {
+		return err
+	}
+
+	if err := purgeTasks(tx, purged, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return err
+	}
+
+	if err := r.forgetTasks(purged); err != nil {
+		return err
+	}
+
+	log.InfoLogger.Printf("Task purged with ID: %d", taskID)
+	return nil
+}
+
+// PurgeExpired deletes for good up to limit tasks that were moved to the
+// trash before the given moment and returns how many it deleted.
+func (r *Repository) PurgeExpired(before time.Time, limit int) (int, error) {
+	purged, err := queryIDs(r.db, "SELECT id FROM tasks WHERE deleted_at IS NOT NULL AND deleted_at < ? ORDER BY deleted_at, id LIMIT ?", before, limit)
+	if err != nil || len(purged) == 0 {
+		return 0, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to start transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := purgeTasks(tx, purged, 0); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return 0, err
+	}
+
+	if err := r.forgetTasks(purged); err != nil {
+		return len(purged), err
+	}
+
+	log.InfoLogger.Printf("Purged %d expired tasks from the trash", len(purged))
+	return len(purged), nil
+}
+
+// trashBatch returns the ids of the task in the trash and of its subtasks
+// that were deleted at the same moment, the task first.
+func trashBatch(tx *sql.Tx, root models.Task) ([]int64, error) {
+	batch := []int64{root.Id}
+
+	descendants, err := descendantIDs(tx, root.Id)
+	if err != nil || len(descendants) == 0 {
+		return batch, err
+	}
+
+	args := append(idArgs(descendants), *root.DeletedAt)
+	deletedWith, err := queryIDs(tx, "SELECT id FROM tasks WHERE id IN ("+placeholders(len(descendants))+") AND deleted_at = ?", args...)
+	if err != nil {
+		return batch, err
+	}
+
+	return append(batch, deletedWith...), nil
+}
+
+// purgeTasks deletes the tasks, their tags and comments and records that
+// they were purged. A zero userID records a purge made by the service.
+func purgeTasks(tx *sql.Tx, taskIDs []int64, userID int64) error {
+	for _, id := range taskIDs {
+		if err := recordEvent(tx, id, userID, models.EventPurged, nil); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec("DELETE FROM task_tags WHERE task_id IN ("+placeholders(len(taskIDs))+")", idArgs(taskIDs)...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to detach task tags: %v", err)
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM task_comments WHERE task_id IN ("+placeholders(len(taskIDs))+")", idArgs(taskIDs)...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete task comments: %v", err)
+		return err
+	}
+
+	// Delete the tasks from the database
+	_, err = tx.Exec("DELETE FROM tasks WHERE id IN ("+placeholders(len(taskIDs))+")", idArgs(taskIDs)...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete task: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// liveIDs returns the ids of the tasks that are not in the trash.
+func liveIDs(q querier, taskIDs []int64) ([]int64, error) {
+	if len(taskIDs) == 0 {
+		return nil, nil
+	}
+	return queryIDs(q, "SELECT id FROM tasks WHERE id IN ("+placeholders(len(taskIDs))+") AND deleted_at IS NULL", idArgs(taskIDs)...)
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrWatchClosed is returned by TaskWatch.Next once the subscription is closed.
+var ErrWatchClosed = errors.New("task watch closed")
+
+// taskChangesChannel is the Redis channel of the changes of the tasks a user
+// can see, by user id.
+const taskChangesChannel = "task-changes:%d"
+
+// TaskWatch is a subscription to the changes of the tasks a user can see.
+// Changes carry only the action and the task id; whether the watcher may
+// still see the task is up to the reader.
+type TaskWatch struct {
+	pubsub   *redis.PubSub
+	messages <-chan *redis.Message
+}
+
+// WatchTasks subscribes to the changes of the tasks the user can see. It
+// returns once the subscription is active, so no change made after it returns
+// is missed. The watch must be closed.
+func (r *Repository) WatchTasks(ctx context.Context, userID int64) (*TaskWatch, error) {
+	pubsub := r.redis.Subscribe(ctx, fmt.Sprintf(taskChangesChannel, userID))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.ErrorLogger.Printf("Failed to subscribe to task changes: %v", err)
+		pubsub.Close()
+		return nil, err
+	}
+
+	log.InfoLogger.Printf("Watching tasks for user ID: %d", userID)
+	return &TaskWatch{pubsub: pubsub, messages: pubsub.Channel()}, nil
+}
+
+// Next waits for the next change or for the context to be done.
+func (w *TaskWatch) Next(ctx context.Context) (models.TaskChange, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return models.TaskChange{}, ctx.Err()
+		case message, ok := <-w.messages:
+			if !ok {
+				return models.TaskChange{}, ErrWatchClosed
+			}
+
+			var change models.TaskChange
+			if err := json.Unmarshal([]byte(message.Payload), &change); err != nil {
+				log.ErrorLogger.Printf("Failed to unmarshal task change: %v", err)
+				continue
+			}
+			return change, nil
+		}
+	}
+}
+
+// Close ends the subscription.
+func (w *TaskWatch) Close() error {
+	return w.pubsub.Close()
+}
+
+// publishChanges tells everyone who can see the tasks, or could see them as
+// previous, that the tasks changed. The tasks are keyed by id.
+func (r *Repository) publishChanges(action string, tasks map[int64]taskRefs, previous ...taskRefs) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	refs := append([]taskRefs{}, previous...)
+	for _, task := range tasks {
+		refs = append(refs, task)
+	}
+	members, err := r.projectMembers(refs...)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.redis.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for taskID, task := range tasks {
+			payload, err := json.Marshal(models.TaskChange{Action: action, TaskId: taskID})
+			if err != nil {
+				log.ErrorLogger.Printf("Failed to marshal task change: %v", err)
+				return err
+			}
+			for _, userID := range audience(members, append([]taskRefs{task}, previous...)...) {
+				pipe.Publish(context.Background(), fmt.Sprintf(taskChangesChannel, userID), payload)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to publish task changes: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// publishTaskChanges publishes the changes of the tasks with the ids, reading
+// whom they are shared with from the database. Tasks in the trash are read too.
+func (r *Repository) publishTaskChanges(action string, taskIDs []int64) error {
+	tasks, err := r.taskRefsByID(taskIDs)
+	if err != nil {
+		return err
+	}
+	return r.publishChanges(action, tasks)
+}
+
+// taskRefsByID returns whom the tasks with the ids are shared with, by id.
+func (r *Repository) taskRefsByID(taskIDs []int64) (map[int64]taskRefs, error) {
+	tasks := make(map[int64]taskRefs, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return tasks, nil
+	}
+
+	rows, err := r.db.Query("SELECT id, user_id, project_id, assignee_id FROM tasks WHERE id IN ("+placeholders(len(taskIDs))+")", idArgs(taskIDs)...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get changed tasks: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskID int64
+		var ref taskRefs
+		var projectID, assigneeID sql.NullInt64
+		if err := rows.Scan(&taskID, &ref.UserId, &projectID, &assigneeID); err != nil {
+			log.ErrorLogger.Printf("Failed to scan changed task: %v", err)
+			return nil, err
+		}
+		ref.ProjectId = projectID.Int64
+		ref.AssigneeId = assigneeID.Int64
+		tasks[taskID] = ref
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return nil, err
+	}
+
+	return tasks, nil
+}
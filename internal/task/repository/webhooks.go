@@ -0,0 +1,388 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+var (
+	// ErrWebhookNotFound is returned when the user has no webhook with the id.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotFound is returned when the webhook has no dead delivery with the id.
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+const webhookColumns = "id, user_id, project_id, url, secret, events, created_at"
+
+const deliveryColumns = "id, webhook_id, event_id, action, payload, status, attempts, last_error, next_attempt_at, created_at"
+
+// PendingDelivery is a delivery claimed for sending, with where to send it.
+type PendingDelivery struct {
+	models.WebhookDelivery
+	Url    string
+	Secret string
+}
+
+// CreateWebhook saves a webhook of the user. Only the owner of a project may
+// subscribe to its tasks.
+func (r *Repository) CreateWebhook(webhook models.Webhook) (models.Webhook, error) {
+	if err := r.checkProjectOwner(webhook.ProjectId, webhook.UserId); err != nil {
+		return models.Webhook{}, err
+	}
+
+	result, err := r.db.Exec("INSERT INTO webhooks (user_id, project_id, url, secret, events) VALUES (?, ?, ?, ?, ?)",
+		webhook.UserId, nullID(webhook.ProjectId), webhook.Url, webhook.Secret, strings.Join(webhook.Events, ","))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to insert webhook into db: %v", err)
+		return models.Webhook{}, err
+	}
+
+	webhookID, err := result.LastInsertId()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get last insert ID: %v", err)
+		return models.Webhook{}, err
+	}
+
+	log.InfoLogger.Printf("Webhook created with ID: %d", webhookID)
+	return r.getWebhook(webhookID, webhook.UserId)
+}
+
+// ListWebhooks returns the webhooks of the user, oldest first.
+func (r *Repository) ListWebhooks(userID int64) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+
+	rows, err := r.db.Query("SELECT "+webhookColumns+" FROM webhooks WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get webhooks from db: %v", err)
+		return webhooks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to scan webhook: %v", err)
+			return webhooks, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return webhooks, err
+	}
+
+	return webhooks, nil
+}
+
+// UpdateWebhook changes the URL, events and, unless it is empty, the secret of
+// a webhook of the user. The project of a webhook does not change.
+func (r *Repository) UpdateWebhook(webhook models.Webhook) (models.Webhook, error) {
+	if _, err := r.getWebhook(webhook.Id, webhook.UserId); err != nil {
+		return models.Webhook{}, err
+	}
+
+	_, err := r.db.Exec("UPDATE webhooks SET url = ?, events = ?, secret = IF(? = '', secret, ?) WHERE id = ?",
+		webhook.Url, strings.Join(webhook.Events, ","), webhook.Secret, webhook.Secret, webhook.Id)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to update webhook: %v", err)
+		return models.Webhook{}, err
+	}
+
+	log.InfoLogger.Printf("Webhook updated with ID: %d", webhook.Id)
+	return r.getWebhook(webhook.Id, webhook.UserId)
+}
+
+// DeleteWebhook deletes a webhook of the user with its deliveries.
+func (r *Repository) DeleteWebhook(webhookID int64, userID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to begin transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id = ? AND user_id = ?", webhookID, userID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to delete webhook: %v", err)
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		log.ErrorLogger.Printf("Failed to get affected rows: %v", err)
+		return err
+	} else if affected == 0 {
+		log.ErrorLogger.Printf("Webhook %d not found for user ID: %d", webhookID, userID)
+		return ErrWebhookNotFound
+	}
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", webhookID); err != nil {
+		log.ErrorLogger.Printf("Failed to delete webhook deliveries: %v", err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return err
+	}
+
+	log.InfoLogger.Printf("Webhook deleted with ID: %d", webhookID)
+	return nil
+}
+
+// ListDeadDeliveries returns the deliveries of a webhook of the user that
+// failed every attempt, newest first.
+func (r *Repository) ListDeadDeliveries(webhookID int64, userID int64) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	if _, err := r.getWebhook(webhookID, userID); err != nil {
+		return deliveries, err
+	}
+
+	rows, err := r.db.Query("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = ? AND status = ? ORDER BY id DESC",
+		webhookID, models.DeliveryDead)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get webhook deliveries from db: %v", err)
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to scan webhook delivery: %v", err)
+			return deliveries, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// RedeliverWebhook queues a dead delivery of a webhook of the user again, with
+// all of its attempts.
+func (r *Repository) RedeliverWebhook(webhookID int64, deliveryID int64, userID int64) (models.WebhookDelivery, error) {
+	if _, err := r.getWebhook(webhookID, userID); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	result, err := r.db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ? AND webhook_id = ? AND status = ?",
+		models.DeliveryPending, time.Now().UTC().Truncate(time.Second), deliveryID, webhookID, models.DeliveryDead)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to requeue webhook delivery: %v", err)
+		return models.WebhookDelivery{}, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		log.ErrorLogger.Printf("Failed to get affected rows: %v", err)
+		return models.WebhookDelivery{}, err
+	} else if affected == 0 {
+		log.ErrorLogger.Printf("Dead delivery %d not found for webhook %d", deliveryID, webhookID)
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+
+	delivery, err := scanDelivery(r.db.QueryRow("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = ?", deliveryID))
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get webhook delivery: %v", err)
+		return models.WebhookDelivery{}, err
+	}
+
+	log.InfoLogger.Printf("Webhook delivery %d queued again", deliveryID)
+	return delivery, nil
+}
+
+// ClaimDeliveries returns up to limit pending deliveries due at now and counts
+// an attempt for each. The claimed deliveries are not due again until the
+// lease passes, so a sender that stops before reporting the outcome only
+// delays them. Deliveries claimed by another instance are skipped.
+func (r *Repository) ClaimDeliveries(now time.Time, lease time.Duration, limit int) ([]PendingDelivery, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids, err := queryIDs(tx, "SELECT id FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ? FOR UPDATE SKIP LOCKED",
+		models.DeliveryPending, now, limit)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	args := append([]interface{}{now.Add(lease)}, idArgs(ids)...)
+	_, err = tx.Exec("UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ? WHERE id IN ("+placeholders(len(ids))+")", args...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to claim webhook deliveries: %v", err)
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT d.id, d.webhook_id, d.event_id, d.action, d.payload, d.status, d.attempts, d.last_error, d.next_attempt_at, d.created_at, w.url, w.secret
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id WHERE d.id IN (`+placeholders(len(ids))+") ORDER BY d.id", idArgs(ids)...)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get claimed webhook deliveries: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []PendingDelivery
+	for rows.Next() {
+		var delivery PendingDelivery
+		var payload []byte
+		err := rows.Scan(&delivery.Id, &delivery.WebhookId, &delivery.EventId, &delivery.Action, &payload, &delivery.Status,
+			&delivery.Attempts, &delivery.LastError, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.Url, &delivery.Secret)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to scan webhook delivery: %v", err)
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Rows error: %v", err)
+		return nil, err
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorLogger.Printf("Failed to commit transaction: %v", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// MarkDelivered records that the delivery was accepted by its receiver.
+func (r *Repository) MarkDelivered(deliveryID int64, now time.Time) error {
+	_, err := r.db.Exec("UPDATE webhook_deliveries SET status = ?, last_error = '', delivered_at = ? WHERE id = ?",
+		models.DeliveryDelivered, now, deliveryID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to mark webhook delivery as delivered: %v", err)
+		return err
+	}
+	return nil
+}
+
+// MarkFailed records why the delivery failed. The delivery is retried at
+// retryAt, or never again when it is dead.
+func (r *Repository) MarkFailed(deliveryID int64, lastError string, retryAt time.Time, dead bool) error {
+	status := models.DeliveryPending
+	if dead {
+		status = models.DeliveryDead
+	}
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+
+	_, err := r.db.Exec("UPDATE webhook_deliveries SET status = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		status, lastError, retryAt, deliveryID)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to mark webhook delivery as failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// enqueueWebhooks queues a delivery of the event to every webhook that
+// receives it: the webhooks of the creator and the assignee of the task
+// without a project, and the webhooks of its project. The payload holds the
+// task as it is inside the transaction.
+func enqueueWebhooks(tx *sql.Tx, event models.TaskEvent) error {
+	webhookIDs, err := queryIDs(tx, `SELECT w.id FROM webhooks w JOIN tasks t ON t.id = ?
+		WHERE ((w.project_id IS NULL AND w.user_id IN (t.user_id, t.assignee_id)) OR w.project_id = t.project_id)
+		AND (w.events = '' OR FIND_IN_SET(?, w.events) > 0)`, event.TaskId, event.Action)
+	if err != nil || len(webhookIDs) == 0 {
+		return err
+	}
+
+	task, err := readTask(tx, event.TaskId, false)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(models.WebhookPayload{
+		Event:     "task." + event.Action,
+		EventId:   event.Id,
+		TaskId:    event.TaskId,
+		UserId:    event.UserId,
+		Changes:   event.Changes,
+		Task:      task,
+		CreatedAt: event.CreatedAt,
+	})
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to marshal webhook payload: %v", err)
+		return err
+	}
+
+	for _, webhookID := range webhookIDs {
+		_, err := tx.Exec("INSERT INTO webhook_deliveries (webhook_id, event_id, action, payload, next_attempt_at) VALUES (?, ?, ?, ?, ?)",
+			webhookID, event.Id, event.Action, payload, event.CreatedAt)
+		if err != nil {
+			log.ErrorLogger.Printf("Failed to queue webhook delivery: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) getWebhook(webhookID int64, userID int64) (models.Webhook, error) {
+	webhook, err := scanWebhook(r.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ? AND user_id = ?", webhookID, userID))
+	if err == sql.ErrNoRows {
+		log.ErrorLogger.Printf("Webhook %d not found for user ID: %d", webhookID, userID)
+		return webhook, ErrWebhookNotFound
+	} else if err != nil {
+		log.ErrorLogger.Printf("Failed to get webhook from db: %v", err)
+		return webhook, err
+	}
+
+	return webhook, nil
+}
+
+// checkProjectOwner returns ErrInvalidProject unless the user is a member of
+// the project and ErrForbidden unless the user owns it. No project is fine.
+func (r *Repository) checkProjectOwner(projectID int64, userID int64) error {
+	if projectID == 0 {
+		return nil
+	}
+
+	role, err := r.projectRole(projectID, userID)
+	if err != nil {
+		return err
+	}
+
+	if role != models.RoleOwner {
+		log.ErrorLogger.Printf("User %d does not own project %d", userID, projectID)
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	var projectID sql.NullInt64
+	var events string
+	err := row.Scan(&webhook.Id, &webhook.UserId, &projectID, &webhook.Url, &webhook.Secret, &events, &webhook.CreatedAt)
+	webhook.ProjectId = projectID.Int64
+	webhook.Events = []string{}
+	if events != "" {
+		webhook.Events = strings.Split(events, ",")
+	}
+	return webhook, err
+}
+
+func scanDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var payload []byte
+	err := row.Scan(&delivery.Id, &delivery.WebhookId, &delivery.EventId, &delivery.Action, &payload, &delivery.Status,
+		&delivery.Attempts, &delivery.LastError, &delivery.NextAttemptAt, &delivery.CreatedAt)
+	delivery.Payload = payload
+	return delivery, err
+}
@@ -0,0 +1,174 @@
+package task
+
+import (
+	"context"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxBatchSize ограничивает число задач в одной пакетной операции.
+const maxBatchSize = 100
+
+// BatchCreateTasks реализует метод пакетного создания задач в одной транзакции.
+func (s *TaskService) BatchCreateTasks(ctx context.Context, req *taskPB.BatchCreateTasksRequest) (*taskPB.BatchCreateTasksResponse, error) {
+	log.InfoLogger.Printf("Creating batch of %d tasks for user ID: %d", len(req.Tasks), req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if err := checkBatchSize(len(req.Tasks)); err != nil {
+		return nil, err
+	}
+
+	// Задачи с ошибкой проверки не попадают в репозиторий
+	results := make([]*taskPB.BatchResult, len(req.Tasks))
+	var tasks []models.Task
+	var indexes []int
+	for i, pbTask := range req.Tasks {
+		task := models.TaskFromPB(pbTask)
+		task.UserId = req.UserId
+		task.Status = models.StatusTodo
+
+		rule, err := recurrenceRule(task)
+		if err != nil {
+			results[i] = batchResult(i, 0, nil, err)
+			continue
+		}
+		task.Recurrence = rule
+
+		tasks = append(tasks, task)
+		indexes = append(indexes, i)
+	}
+
+	created, err := s.repo.BatchCreateTasks(tasks)
+	if err != nil {
+		return nil, taskError(err)
+	}
+	for j, result := range created {
+		results[indexes[j]] = batchResult(indexes[j], result.Task.Id, &result.Task, result.Err)
+	}
+
+	return &taskPB.BatchCreateTasksResponse{Results: results}, nil
+}
+
+// BatchUpdateTasks реализует метод пакетного обновления задач в одной транзакции.
+func (s *TaskService) BatchUpdateTasks(ctx context.Context, req *taskPB.BatchUpdateTasksRequest) (*taskPB.BatchUpdateTasksResponse, error) {
+	log.InfoLogger.Printf("Updating batch of %d tasks for user ID: %d", len(req.Tasks), req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if err := checkBatchSize(len(req.Tasks)); err != nil {
+		return nil, err
+	}
+
+	// Задачи с ошибкой проверки не попадают в репозиторий
+	results := make([]*taskPB.BatchResult, len(req.Tasks))
+	var tasks []models.Task
+	var indexes []int
+	var previousStatus []string
+	for i, pbTask := range req.Tasks {
+		task := models.TaskFromPB(pbTask)
+		task.UserId = req.UserId
+
+		current, err := s.repo.GetTaskByID(task.Id, task.UserId)
+		if err != nil {
+			results[i] = batchResult(i, task.Id, nil, err)
+			continue
+		}
+
+		// Без статуса в запросе задача сохраняет текущий статус
+		if task.Status == "" {
+			task.Status = current.Status
+		}
+		if !s.workflow.CanTransition(current.Status, task.Status) {
+			results[i] = batchResult(i, task.Id, nil, transitionError(current.Status, task.Status))
+			continue
+		}
+
+		task.Recurrence, err = recurrenceRule(task)
+		if err != nil {
+			results[i] = batchResult(i, task.Id, nil, err)
+			continue
+		}
+
+		tasks = append(tasks, task)
+		indexes = append(indexes, i)
+		previousStatus = append(previousStatus, current.Status)
+	}
+
+	// Статус задачи меняется, только если её не успели перевести в другой
+	updated, err := s.repo.BatchUpdateTasks(req.UserId, tasks, previousStatus)
+	if err != nil {
+		return nil, taskError(err)
+	}
+	for j, result := range updated {
+		results[indexes[j]] = batchResult(indexes[j], tasks[j].Id, &result.Task, result.Err)
+
+		// Выполненная повторяющаяся задача сразу получает следующее повторение
+		if result.Err == nil && previousStatus[j] != models.StatusDone {
+			s.completeOccurrence(result.Task)
+		}
+	}
+
+	return &taskPB.BatchUpdateTasksResponse{Results: results}, nil
+}
+
+// BatchDeleteTasks реализует метод пакетного удаления задач в корзину в одной транзакции.
+func (s *TaskService) BatchDeleteTasks(ctx context.Context, req *taskPB.BatchDeleteTasksRequest) (*taskPB.BatchDeleteTasksResponse, error) {
+	log.InfoLogger.Printf("Deleting batch of %d tasks for user ID: %d", len(req.Ids), req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if err := checkBatchSize(len(req.Ids)); err != nil {
+		return nil, err
+	}
+
+	deleted, err := s.repo.BatchDeleteTasks(req.UserId, req.Ids, req.Mode == taskPB.DeleteMode_DELETE_MODE_CASCADE)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	results := make([]*taskPB.BatchResult, len(deleted))
+	for i, result := range deleted {
+		results[i] = batchResult(i, req.Ids[i], nil, result.Err)
+	}
+
+	return &taskPB.BatchDeleteTasksResponse{Results: results}, nil
+}
+
+// checkBatchSize проверяет, что пакет не пуст и не больше maxBatchSize.
+func checkBatchSize(size int) error {
+	if size == 0 {
+		return status.Error(codes.InvalidArgument, "batch is empty")
+	}
+	if size > maxBatchSize {
+		return status.Errorf(codes.InvalidArgument, "batch must have at most %d tasks", maxBatchSize)
+	}
+	return nil
+}
+
+// batchResult преобразует результат элемента пакета в сообщение protobuf.
+// Ошибки репозитория переводятся в статусы gRPC так же, как для одиночных методов.
+func batchResult(index int, id int64, task *models.Task, err error) *taskPB.BatchResult {
+	result := &taskPB.BatchResult{Index: int32(index), Id: id}
+	if err != nil {
+		if _, ok := status.FromError(err); !ok {
+			err = taskError(err)
+		}
+		st := status.Convert(err)
+		result.Code = int32(st.Code())
+		result.Error = st.Message()
+		return result
+	}
+
+	if task != nil {
+		result.Task = models.TaskToPB(*task)
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxCommentLength ограничивает длину текста комментария.
+const maxCommentLength = 10000
+
+// AddComment реализует метод добавления комментария к задаче.
+func (s *TaskService) AddComment(ctx context.Context, req *taskPB.AddCommentRequest) (*taskPB.AddCommentResponse, error) {
+	log.InfoLogger.Printf("Adding comment to task %d by user ID: %d", req.TaskId, req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	body, err := commentBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := s.repo.AddComment(req.TaskId, req.UserId, body)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.AddCommentResponse{Comment: models.CommentToPB(comment)}, nil
+}
+
+// ListComments реализует метод получения комментариев задачи.
+func (s *TaskService) ListComments(ctx context.Context, req *taskPB.ListCommentsRequest) (*taskPB.ListCommentsResponse, error) {
+	log.InfoLogger.Printf("Getting comments of task %d for user ID: %d", req.TaskId, req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	comments, err := s.repo.ListComments(req.TaskId, req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	var pbComments []*taskPB.Comment
+	for _, comment := range comments {
+		pbComments = append(pbComments, models.CommentToPB(comment))
+	}
+
+	return &taskPB.ListCommentsResponse{Comments: pbComments}, nil
+}
+
+// EditComment реализует метод изменения комментария; менять его может только автор.
+func (s *TaskService) EditComment(ctx context.Context, req *taskPB.EditCommentRequest) (*taskPB.EditCommentResponse, error) {
+	log.InfoLogger.Printf("Editing comment with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	body, err := commentBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := s.repo.EditComment(req.Id, req.TaskId, req.UserId, body)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.EditCommentResponse{Comment: models.CommentToPB(comment)}, nil
+}
+
+// DeleteComment реализует метод удаления комментария; удалить его может только автор.
+func (s *TaskService) DeleteComment(ctx context.Context, req *taskPB.DeleteCommentRequest) (*taskPB.DeleteCommentResponse, error) {
+	log.InfoLogger.Printf("Deleting comment with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	if err := s.repo.DeleteComment(req.Id, req.TaskId, req.UserId); err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.DeleteCommentResponse{Message: fmt.Sprintf("Comment with ID - %d Deleted Succesfully! ", req.Id)}, nil
+}
+
+// commentBody проверяет текст комментария и убирает пробелы по краям.
+func commentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", status.Error(codes.InvalidArgument, "body is required")
+	}
+	if len(body) > maxCommentLength {
+		return "", status.Errorf(codes.InvalidArgument, "comment must be at most %d characters", maxCommentLength)
+	}
+	return body, nil
+}
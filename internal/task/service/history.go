@@ -0,0 +1,32 @@
+package task
+
+import (
+	"context"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetTaskHistory реализует метод получения истории изменений задачи.
+func (s *TaskService) GetTaskHistory(ctx context.Context, req *taskPB.GetTaskHistoryRequest) (*taskPB.GetTaskHistoryResponse, error) {
+	log.InfoLogger.Printf("Getting history of task with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	events, err := s.repo.GetTaskHistory(req.Id, req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	var pbEvents []*taskPB.TaskEvent
+	for _, event := range events {
+		pbEvents = append(pbEvents, models.TaskEventToPB(event))
+	}
+
+	return &taskPB.GetTaskHistoryResponse{Events: pbEvents}, nil
+}
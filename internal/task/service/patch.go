@@ -0,0 +1,97 @@
+package task
+
+import (
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// patchTask изменяет только поля задачи, перечисленные в маске; остальные
+// поля сохраняют значения из базы данных, даже если их изменили параллельно.
+func (s *TaskService) patchTask(current models.Task, patch models.Task, paths []string) (*taskPB.UpdateTaskResponse, error) {
+	task := current
+	task.UserId = patch.UserId
+	// Версия из запроса проверяется репозиторием, 0 — без проверки
+	task.Version = patch.Version
+
+	var fields []string
+	for _, path := range paths {
+		switch path {
+		case "title":
+			if patch.Title == "" {
+				return nil, status.Error(codes.InvalidArgument, "title must not be empty")
+			}
+			task.Title = patch.Title
+		case "description":
+			task.Description = patch.Description
+		case "status":
+			if patch.Status == "" {
+				return nil, status.Error(codes.InvalidArgument, "status is required")
+			}
+			task.Status = patch.Status
+		case "due_at":
+			task.DueAt = patch.DueAt
+		case "priority":
+			task.Priority = patch.Priority
+			if task.Priority == "" {
+				task.Priority = models.PriorityMedium
+			}
+		case "project_id":
+			task.ProjectId = patch.ProjectId
+		case "recurrence":
+			task.Recurrence = patch.Recurrence
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "field %q cannot be updated", path)
+		}
+		fields = append(fields, path)
+	}
+
+	if !s.workflow.CanTransition(current.Status, task.Status) {
+		return nil, transitionError(current.Status, task.Status)
+	}
+
+	// Правило повторения проверяется и при смене срока: повторяющейся задаче нужен срок
+	rule, err := recurrenceRule(task)
+	if err != nil {
+		return nil, err
+	}
+	task.Recurrence = rule
+
+	task, err = s.repo.PatchTask(task, fields, current.Status)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	// Выполненная повторяющаяся задача сразу получает следующее повторение
+	if current.Status != models.StatusDone {
+		s.completeOccurrence(task)
+	}
+
+	log.InfoLogger.Printf("Task patched: %v", task)
+	return &taskPB.UpdateTaskResponse{
+		Task: models.TaskToPB(task),
+	}, nil
+}
+
+// sameFields сообщает, совпадают ли у задач все поля, кроме статуса, которые
+// меняет обновление задачи целиком.
+func sameFields(current models.Task, task models.Task) bool {
+	return current.Title == task.Title &&
+		current.Description == task.Description &&
+		sameTime(current.DueAt, task.DueAt) &&
+		current.Priority == task.Priority &&
+		current.ProjectId == task.ProjectId &&
+		current.Recurrence == task.Recurrence
+}
+
+// sameTime сообщает, совпадают ли два необязательных момента времени.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,134 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/damirbeybitov/todo_project/internal/task/recurrence"
+	"github.com/damirbeybitov/todo_project/internal/task/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultSchedulerInterval используется, если период проверки не задан в конфигурации.
+	DefaultSchedulerInterval = time.Minute
+	// schedulerBatch ограничивает число повторений, создаваемых за один проход.
+	schedulerBatch = 100
+)
+
+// Scheduler создает следующие повторения задач, время которых наступило.
+// Повторение создается не более одного раза, поэтому несколько экземпляров
+// сервиса и его перезапуски не создают дубликатов.
+type Scheduler struct {
+	repo     *repository.Repository
+	interval time.Duration
+}
+
+// NewScheduler создает планировщик с заданным периодом проверки.
+func NewScheduler(repo *repository.Repository, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultSchedulerInterval
+	}
+	return &Scheduler{repo: repo, interval: interval}
+}
+
+// Run проверяет задачи сразу и затем с заданным периодом, пока не отменен контекст.
+func (s *Scheduler) Run(ctx context.Context) {
+	log.InfoLogger.Printf("Recurring task scheduler is running every %s", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunOnce(time.Now().UTC()); err != nil {
+			log.ErrorLogger.Printf("Failed to create task occurrences: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce создает следующие повторения задач, время которых наступило к моменту now.
+func (s *Scheduler) RunOnce(now time.Time) error {
+	for {
+		occurrences, err := s.repo.DueOccurrences(now, schedulerBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, occurrence := range occurrences {
+			if err := nextOccurrence(s.repo, occurrence, now); err != nil {
+				return err
+			}
+		}
+
+		// Каждое обработанное повторение теряет правило, поэтому следующая
+		// выборка возвращает еще не обработанные задачи
+		if len(occurrences) < schedulerBatch {
+			return nil
+		}
+	}
+}
+
+// completeOccurrence создает следующее повторение выполненной задачи.
+// Ошибка только записывается в лог: планировщик создаст повторение позже.
+func (s *TaskService) completeOccurrence(task models.Task) {
+	if task.Status != models.StatusDone || task.Recurrence == "" {
+		return
+	}
+
+	occurrence, err := s.repo.GetOccurrence(task.Id)
+	if err == nil && occurrence.Task.Recurrence != "" {
+		err = nextOccurrence(s.repo, occurrence, time.Now().UTC())
+	}
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to create next occurrence of task %d: %v", task.Id, err)
+	}
+}
+
+// nextOccurrence создает первое повторение серии после текущего, которое
+// еще не наступило, или завершает серию, если повторений больше нет.
+func nextOccurrence(repo *repository.Repository, occurrence models.Occurrence, now time.Time) error {
+	rule, err := recurrence.Parse(occurrence.Task.Recurrence)
+	if err != nil {
+		log.ErrorLogger.Printf("Task %d has an invalid recurrence rule: %v", occurrence.Task.Id, err)
+		return repo.EndSeries(occurrence.Task.Id)
+	}
+
+	after := occurrence.At
+	if now.After(after) {
+		after = now
+	}
+
+	next, ok := rule.Next(occurrence.At, after)
+	if !ok {
+		return repo.EndSeries(occurrence.Task.Id)
+	}
+
+	_, err = repo.CreateOccurrence(occurrence, next)
+	return err
+}
+
+// recurrenceRule проверяет правило повторения задачи и приводит его к
+// каноническому виду. Повторяющейся задаче нужен срок.
+func recurrenceRule(task models.Task) (string, error) {
+	if task.Recurrence == "" {
+		return "", nil
+	}
+	if task.DueAt == nil {
+		return "", status.Error(codes.InvalidArgument, "recurring tasks need a due date")
+	}
+
+	rule, err := recurrence.Parse(task.Recurrence)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	return rule.String(), nil
+}
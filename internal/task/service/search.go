@@ -0,0 +1,45 @@
+package task
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxSearchQueryLength ограничивает длину поискового запроса в символах.
+const maxSearchQueryLength = 256
+
+// SearchTasks реализует метод полнотекстового поиска задач.
+func (s *TaskService) SearchTasks(ctx context.Context, req *taskPB.SearchTasksRequest) (*taskPB.SearchTasksResponse, error) {
+	log.InfoLogger.Printf("Searching tasks for user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return nil, status.Error(codes.InvalidArgument, "search query is required")
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		return nil, status.Errorf(codes.InvalidArgument, "search query must be at most %d characters", maxSearchQueryLength)
+	}
+
+	results, nextPageToken, err := s.repo.SearchTasks(req.UserId, query, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	var pbResults []*taskPB.SearchResult
+	for _, result := range results {
+		pbResults = append(pbResults, models.SearchResultToPB(result))
+	}
+
+	return &taskPB.SearchTasksResponse{Results: pbResults, NextPageToken: nextPageToken}, nil
+}
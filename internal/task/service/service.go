@@ -2,23 +2,29 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/damirbeybitov/todo_project/internal/log"
 	"github.com/damirbeybitov/todo_project/internal/models"
 	"github.com/damirbeybitov/todo_project/internal/task/repository"
 	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // TaskService представляет сервис управления задачами.
 type TaskService struct {
-	repo *repository.Repository
+	repo           *repository.Repository
+	workflow       Workflow
+	webhookTargets WebhookTargets
 	taskPB.UnimplementedTaskServiceServer
 }
 
 // NewTaskService создает новый экземпляр TaskService.
-func NewTaskService(repo *repository.Repository) taskPB.TaskServiceServer {
-	return &TaskService{repo: repo}
+func NewTaskService(repo *repository.Repository, workflow Workflow, webhookTargets WebhookTargets) taskPB.TaskServiceServer {
+	return &TaskService{repo: repo, workflow: workflow, webhookTargets: webhookTargets}
 }
 
 // CreateTask реализует метод создания задачи в рамках интерфейса TaskServiceServer.
@@ -26,17 +32,19 @@ func (s *TaskService) CreateTask(ctx context.Context, req *taskPB.CreateTaskRequ
 	log.InfoLogger.Printf("Creating task with title: %s", req.Task.Title)
 
 	// Реализация создания задачи
-	task := models.Task{
-		Title:       req.Task.Title,
-		Description: req.Task.Description,
-		Status:      false,
-		UserId:      req.Task.UserId,
+	task := models.TaskFromPB(req.Task)
+	task.Status = models.StatusTodo
+
+	rule, err := recurrenceRule(task)
+	if err != nil {
+		return nil, err
 	}
+	task.Recurrence = rule
 
 	taskID, err := s.repo.CreateTask(task)
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to create task: %v", err)
-		return nil, err
+		return nil, taskError(err)
 	}
 
 	return &taskPB.CreateTaskResponse{Id: taskID}, nil
@@ -46,23 +54,21 @@ func (s *TaskService) CreateTask(ctx context.Context, req *taskPB.CreateTaskRequ
 func (s *TaskService) GetTask(ctx context.Context, req *taskPB.GetTaskRequest) (*taskPB.GetTaskResponse, error) {
 	log.InfoLogger.Printf("Getting task with ID: %d", req.Id)
 
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
 	// Реализация получения задачи
-	task, err := s.repo.GetTaskByID(req.Id)
+	task, err := s.repo.GetTaskByID(req.Id, req.UserId)
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to get task: %v", err)
-		return nil, err
+		return nil, taskError(err)
 	}
 
 	log.InfoLogger.Printf("Task found: %v", task)
 	// В данном примере просто возвращается фиктивная задача.
 	return &taskPB.GetTaskResponse{
-		Task: &taskPB.Task{
-			Id:          task.Id,
-			Title:       task.Title,
-			Description: task.Description,
-			Status:      task.Status,
-			UserId:      task.UserId,
-		},
+		Task: models.TaskToPB(task),
 	}, nil
 }
 
@@ -70,30 +76,40 @@ func (s *TaskService) GetTask(ctx context.Context, req *taskPB.GetTaskRequest) (
 func (s *TaskService) GetTasks(ctx context.Context, req *taskPB.GetTasksRequest) (*taskPB.GetTasksResponse, error) {
 	log.InfoLogger.Printf("Getting tasks for user ID: %s", req.Username)
 
-	id, err := s.repo.GetUserIdWithUsername(req.Username)
-	if err != nil {
-		return nil, err
+	// Шлюз передает идентификатор из токена, иначе он определяется по имени
+	id := req.UserId
+	if id == 0 {
+		var err error
+		if id, err = s.repo.GetUserIdWithUsername(req.Username); err != nil {
+			return nil, err
+		}
 	}
 
-	tasks, err := s.repo.GetTasks(id)
+	filter := models.TaskFilter{
+		PageSize:  req.PageSize,
+		PageToken: req.PageToken,
+		Status:    models.StatusFromPB(req.Status),
+		Query:     req.Query,
+		SortBy:    req.SortBy,
+		SortDesc:  req.SortDesc,
+		ProjectId: req.ProjectId,
+		Tags:      normalizeTags(req.Tags),
+	}
+
+	tasks, nextPageToken, err := s.repo.GetTasks(id, filter)
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to get tasks: %v", err)
-		return nil, err
+		return nil, taskError(err)
 	}
 
 	var pbTasks []*taskPB.Task
 	for _, task := range tasks {
-		pbTasks = append(pbTasks, &taskPB.Task{
-			Id:          task.Id,
-			Title:       task.Title,
-			Description: task.Description,
-			Status:      task.Status,
-			UserId:      task.UserId,
-		})
+		pbTasks = append(pbTasks, models.TaskToPB(task))
 	}
 
 	return &taskPB.GetTasksResponse{
-		Tasks: pbTasks,
+		Tasks:         pbTasks,
+		NextPageToken: nextPageToken,
 	}, nil
 }
 
@@ -101,30 +117,58 @@ func (s *TaskService) GetTasks(ctx context.Context, req *taskPB.GetTasksRequest)
 func (s *TaskService) UpdateTask(ctx context.Context, req *taskPB.UpdateTaskRequest) (*taskPB.UpdateTaskResponse, error) {
 	log.InfoLogger.Printf("Updating task with ID: %d", req.Task.Id)
 
+	if req.Task.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
 	// Реализация обновления задачи
-	task := models.Task{
-		Id:          req.Task.Id,
-		Title:       req.Task.Title,
-		Description: req.Task.Description,
-		Status:      req.Task.Status,
-		UserId:      req.Task.UserId,
+	task := models.TaskFromPB(req.Task)
+
+	current, err := s.repo.GetTaskByID(task.Id, task.UserId)
+	if err != nil {
+		return nil, taskError(err)
 	}
 
-	err := s.repo.UpdateTask(task)
+	// С маской изменяются только перечисленные в ней поля
+	if paths := req.GetUpdateMask().GetPaths(); len(paths) > 0 {
+		return s.patchTask(current, task, paths)
+	}
+
+	// Без статуса в запросе задача сохраняет текущий статус
+	if task.Status == "" {
+		task.Status = current.Status
+	}
+	if !s.workflow.CanTransition(current.Status, task.Status) {
+		return nil, transitionError(current.Status, task.Status)
+	}
+
+	task.Recurrence, err = recurrenceRule(task)
 	if err != nil {
 		return nil, err
 	}
+	if task.Priority == "" {
+		task.Priority = models.PriorityMedium
+	}
+
+	// Исполнителю достаточно права менять статус, если кроме статуса ничего не изменилось
+	if task.Status != current.Status && sameFields(current, task) {
+		return s.patchTask(current, task, []string{"status"})
+	}
+
+	// Статус меняется, только если задачу не успели перевести в другой
+	task, err = s.repo.UpdateTask(task, current.Status)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	// Выполненная повторяющаяся задача сразу получает следующее повторение
+	if current.Status != models.StatusDone {
+		s.completeOccurrence(task)
+	}
 
 	log.InfoLogger.Printf("Task updated: %v", task)
-	// В данном примере просто возвращается сообщение об успешном обновлении.
 	return &taskPB.UpdateTaskResponse{
-		Task: &taskPB.Task{
-			Id:          req.Task.Id,
-			Title:       req.Task.Title,
-			Description: req.Task.Description,
-			Status:      req.Task.Status,
-			UserId:      req.Task.UserId,
-		},
+		Task: models.TaskToPB(task),
 	}, nil
 }
 
@@ -132,13 +176,226 @@ func (s *TaskService) UpdateTask(ctx context.Context, req *taskPB.UpdateTaskRequ
 func (s *TaskService) DeleteTask(ctx context.Context, req *taskPB.DeleteTaskRequest) (*taskPB.DeleteTaskResponse, error) {
 	log.InfoLogger.Printf("Deleting task with ID: %d", req.Id)
 
-	// Реализация удаления задачи
-	err := s.repo.DeleteTask(req.Id)
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	// Реализация удаления задачи: задача попадает в корзину, по умолчанию подзадачи переходят к родителю удалённой задачи
+	err := s.repo.DeleteTaskIfVersion(req.Id, req.UserId, req.Mode == taskPB.DeleteMode_DELETE_MODE_CASCADE, req.Version)
 	if err != nil {
-		return nil, err
+		return nil, taskError(err)
 	}
 
 	log.InfoLogger.Printf("Task deleted with ID: %d", req.Id)
 	// В данном примере просто возвращается сообщение об успешном удалении.
 	return &taskPB.DeleteTaskResponse{Message: fmt.Sprintf("Task with ID - %d Deleted Succesfully! ", req.Id)}, nil
 }
+
+// TransitionTask реализует метод смены статуса задачи с проверкой допустимых переходов.
+func (s *TaskService) TransitionTask(ctx context.Context, req *taskPB.TransitionTaskRequest) (*taskPB.TransitionTaskResponse, error) {
+	log.InfoLogger.Printf("Transitioning task with ID: %d to %s", req.Id, req.Status)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	to := models.StatusFromPB(req.Status)
+	if to == "" {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+
+	current, err := s.repo.GetTaskByID(req.Id, req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	if !s.workflow.CanTransition(current.Status, to) {
+		return nil, transitionError(current.Status, to)
+	}
+
+	task, err := s.repo.TransitionTask(req.Id, req.UserId, current.Status, to)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	if current.Status != models.StatusDone {
+		s.completeOccurrence(task)
+	}
+
+	return &taskPB.TransitionTaskResponse{
+		Task: models.TaskToPB(task),
+	}, nil
+}
+
+// AssignTask реализует метод назначения исполнителя задачи.
+func (s *TaskService) AssignTask(ctx context.Context, req *taskPB.AssignTaskRequest) (*taskPB.AssignTaskResponse, error) {
+	log.InfoLogger.Printf("Assigning task with ID: %d to %d", req.Id, req.AssigneeId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if req.AssigneeId < 0 {
+		return nil, status.Error(codes.InvalidArgument, "assignee id must not be negative")
+	}
+
+	task, err := s.repo.AssignTask(req.Id, req.UserId, req.AssigneeId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.AssignTaskResponse{
+		Task: models.TaskToPB(task),
+	}, nil
+}
+
+// GetAssignedTasks реализует метод получения задач, назначенных пользователю.
+func (s *TaskService) GetAssignedTasks(ctx context.Context, req *taskPB.GetAssignedTasksRequest) (*taskPB.GetAssignedTasksResponse, error) {
+	log.InfoLogger.Printf("Getting tasks assigned to user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	filter := models.TaskFilter{
+		PageSize:   req.PageSize,
+		PageToken:  req.PageToken,
+		Status:     models.StatusFromPB(req.Status),
+		AssigneeId: req.UserId,
+	}
+
+	tasks, nextPageToken, err := s.repo.GetTasks(req.UserId, filter)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get assigned tasks: %v", err)
+		return nil, taskError(err)
+	}
+
+	var pbTasks []*taskPB.Task
+	for _, task := range tasks {
+		pbTasks = append(pbTasks, models.TaskToPB(task))
+	}
+
+	return &taskPB.GetAssignedTasksResponse{
+		Tasks:         pbTasks,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// GetOverdueTasks реализует метод получения просроченных задач и задач со сроком в ближайшее время.
+func (s *TaskService) GetOverdueTasks(ctx context.Context, req *taskPB.GetOverdueTasksRequest) (*taskPB.GetOverdueTasksResponse, error) {
+	log.InfoLogger.Printf("Getting overdue tasks for user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if req.DueWithinSeconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "due_within_seconds must not be negative")
+	}
+
+	dueBefore := time.Now().UTC().Add(time.Duration(req.DueWithinSeconds) * time.Second)
+	tasks, err := s.repo.GetOverdueTasks(req.UserId, dueBefore)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get overdue tasks: %v", err)
+		return nil, taskError(err)
+	}
+
+	var pbTasks []*taskPB.Task
+	for _, task := range tasks {
+		pbTasks = append(pbTasks, models.TaskToPB(task))
+	}
+
+	return &taskPB.GetOverdueTasksResponse{
+		Tasks: pbTasks,
+	}, nil
+}
+
+// GetSubtasks реализует метод получения подзадач с процентом их выполнения.
+func (s *TaskService) GetSubtasks(ctx context.Context, req *taskPB.GetSubtasksRequest) (*taskPB.GetSubtasksResponse, error) {
+	log.InfoLogger.Printf("Getting subtasks of task with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	tasks, err := s.repo.GetSubtasks(req.Id, req.UserId)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get subtasks: %v", err)
+		return nil, taskError(err)
+	}
+
+	var pbTasks []*taskPB.Task
+	for _, task := range tasks {
+		pbTasks = append(pbTasks, models.TaskToPB(task))
+	}
+
+	return &taskPB.GetSubtasksResponse{
+		Tasks:             pbTasks,
+		CompletionPercent: completionPercent(tasks),
+	}, nil
+}
+
+// MoveTask реализует метод переноса задачи под другую родительскую задачу.
+func (s *TaskService) MoveTask(ctx context.Context, req *taskPB.MoveTaskRequest) (*taskPB.MoveTaskResponse, error) {
+	log.InfoLogger.Printf("Moving task with ID: %d under %d", req.Id, req.ParentId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	task, err := s.repo.MoveTask(req.Id, req.UserId, req.ParentId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.MoveTaskResponse{
+		Task: models.TaskToPB(task),
+	}, nil
+}
+
+// completionPercent возвращает долю выполненных подзадач; отменённые подзадачи не учитываются.
+func completionPercent(tasks []models.Task) int32 {
+	var total, done int32
+	for _, task := range tasks {
+		switch task.Status {
+		case models.StatusCancelled:
+			continue
+		case models.StatusDone:
+			done++
+		}
+		total++
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return done * 100 / total
+}
+
+// taskError преобразует ошибку репозитория в статус gRPC.
+func taskError(err error) error {
+	if errors.Is(err, repository.ErrTaskNotFound) || errors.Is(err, repository.ErrTagNotFound) || errors.Is(err, repository.ErrCommentNotFound) ||
+		errors.Is(err, repository.ErrWebhookNotFound) || errors.Is(err, repository.ErrDeliveryNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, repository.ErrTagExists) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	if errors.Is(err, repository.ErrInvalidFilter) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, repository.ErrInvalidParent) || errors.Is(err, repository.ErrInvalidProject) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, repository.ErrForbidden) || errors.Is(err, repository.ErrNotCommentAuthor) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	if errors.Is(err, repository.ErrStatusChanged) || errors.Is(err, repository.ErrVersionMismatch) {
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// transitionError возвращает ошибку недопустимого перехода между статусами.
+func transitionError(from, to string) error {
+	log.ErrorLogger.Printf("Illegal task transition from %s to %s", from, to)
+	return status.Errorf(codes.FailedPrecondition, "task cannot move from %s to %s", from, to)
+}
@@ -0,0 +1,156 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxTagLength ограничивает длину названия метки.
+const maxTagLength = 64
+
+// CreateTag реализует метод создания метки пользователя.
+func (s *TaskService) CreateTag(ctx context.Context, req *taskPB.CreateTagRequest) (*taskPB.CreateTagResponse, error) {
+	log.InfoLogger.Printf("Creating tag %s for user ID: %d", req.Name, req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	name, err := tagName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := s.repo.CreateTag(req.UserId, name)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.CreateTagResponse{Tag: models.TagToPB(tag)}, nil
+}
+
+// GetTags реализует метод получения меток пользователя.
+func (s *TaskService) GetTags(ctx context.Context, req *taskPB.GetTagsRequest) (*taskPB.GetTagsResponse, error) {
+	log.InfoLogger.Printf("Getting tags for user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	tags, err := s.repo.GetTags(req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	var pbTags []*taskPB.Tag
+	for _, tag := range tags {
+		pbTags = append(pbTags, models.TagToPB(tag))
+	}
+
+	return &taskPB.GetTagsResponse{Tags: pbTags}, nil
+}
+
+// RenameTag реализует метод переименования метки.
+func (s *TaskService) RenameTag(ctx context.Context, req *taskPB.RenameTagRequest) (*taskPB.RenameTagResponse, error) {
+	log.InfoLogger.Printf("Renaming tag with ID: %d to %s", req.Id, req.Name)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	name, err := tagName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := s.repo.RenameTag(req.Id, req.UserId, name)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.RenameTagResponse{Tag: models.TagToPB(tag)}, nil
+}
+
+// DeleteTag реализует метод удаления метки; метка снимается со всех задач.
+func (s *TaskService) DeleteTag(ctx context.Context, req *taskPB.DeleteTagRequest) (*taskPB.DeleteTagResponse, error) {
+	log.InfoLogger.Printf("Deleting tag with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	if err := s.repo.DeleteTag(req.Id, req.UserId); err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.DeleteTagResponse{Message: fmt.Sprintf("Tag with ID - %d Deleted Succesfully! ", req.Id)}, nil
+}
+
+// AttachTag реализует метод добавления метки к задаче.
+func (s *TaskService) AttachTag(ctx context.Context, req *taskPB.TaskTagRequest) (*taskPB.TaskTagResponse, error) {
+	log.InfoLogger.Printf("Attaching tag %d to task %d", req.TagId, req.TaskId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	task, err := s.repo.AttachTag(req.TaskId, req.TagId, req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.TaskTagResponse{Task: models.TaskToPB(task)}, nil
+}
+
+// DetachTag реализует метод снятия метки с задачи.
+func (s *TaskService) DetachTag(ctx context.Context, req *taskPB.TaskTagRequest) (*taskPB.TaskTagResponse, error) {
+	log.InfoLogger.Printf("Detaching tag %d from task %d", req.TagId, req.TaskId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	task, err := s.repo.DetachTag(req.TaskId, req.TagId, req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.TaskTagResponse{Task: models.TaskToPB(task)}, nil
+}
+
+// tagName проверяет название метки и убирает пробелы по краям.
+func tagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, "name is required")
+	}
+	if len(name) > maxTagLength || strings.Contains(name, ",") {
+		return "", status.Errorf(codes.InvalidArgument, "tag name must be at most %d characters without commas", maxTagLength)
+	}
+	return name, nil
+}
+
+// normalizeTags убирает пустые и повторяющиеся метки фильтра и сортирует их,
+// чтобы одинаковые фильтры попадали в один кэш.
+func normalizeTags(tags []string) []string {
+	var result []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,104 @@
+package task
+
+import (
+	"context"
+	"strings"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxImportSize ограничивает число задач в одном запросе загрузки.
+const maxImportSize = 1000
+
+// ExportTasks реализует метод потоковой выгрузки задач пользователя.
+func (s *TaskService) ExportTasks(req *taskPB.ExportTasksRequest, stream taskPB.TaskService_ExportTasksServer) error {
+	log.InfoLogger.Printf("Exporting tasks for user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	err := s.repo.ExportTasks(req.UserId, func(task models.Task) error {
+		return stream.Send(models.TaskToPB(task))
+	})
+	if err != nil {
+		// Клиент, прервавший выгрузку, уже получил свой статус
+		if stream.Context().Err() != nil {
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+		return taskError(err)
+	}
+
+	return nil
+}
+
+// ImportTasks реализует метод загрузки задач в одной транзакции.
+// Задачи сохраняют свой статус; при пробном запуске ничего не сохраняется.
+func (s *TaskService) ImportTasks(ctx context.Context, req *taskPB.ImportTasksRequest) (*taskPB.ImportTasksResponse, error) {
+	log.InfoLogger.Printf("Importing %d tasks for user ID: %d (dry run: %t)", len(req.Tasks), req.UserId, req.DryRun)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if len(req.Tasks) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "nothing to import")
+	}
+	if len(req.Tasks) > maxImportSize {
+		return nil, status.Errorf(codes.InvalidArgument, "import must have at most %d tasks", maxImportSize)
+	}
+
+	// Задачи с ошибкой проверки не попадают в репозиторий
+	results := make([]*taskPB.BatchResult, len(req.Tasks))
+	var tasks []models.Task
+	var indexes []int
+	for i, pbTask := range req.Tasks {
+		task, err := importedTask(models.TaskFromPB(pbTask))
+		if err != nil {
+			results[i] = batchResult(i, 0, nil, err)
+			continue
+		}
+
+		tasks = append(tasks, task)
+		indexes = append(indexes, i)
+	}
+
+	if len(tasks) > 0 {
+		imported, err := s.repo.ImportTasks(req.UserId, tasks, req.DryRun)
+		if err != nil {
+			return nil, taskError(err)
+		}
+		for j, result := range imported {
+			results[indexes[j]] = batchResult(indexes[j], result.Task.Id, &result.Task, result.Err)
+		}
+	}
+
+	return &taskPB.ImportTasksResponse{Results: results}, nil
+}
+
+// importedTask проверяет загружаемую задачу и приводит к каноническому виду
+// ее правило повторения и метки.
+func importedTask(task models.Task) (models.Task, error) {
+	task.Title = strings.TrimSpace(task.Title)
+	if task.Title == "" {
+		return task, status.Error(codes.InvalidArgument, "title is required")
+	}
+
+	rule, err := recurrenceRule(task)
+	if err != nil {
+		return task, err
+	}
+	task.Recurrence = rule
+
+	task.Tags = normalizeTags(task.Tags)
+	for _, tag := range task.Tags {
+		if _, err := tagName(tag); err != nil {
+			return task, err
+		}
+	}
+
+	return task, nil
+}
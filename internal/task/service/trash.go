@@ -0,0 +1,123 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/damirbeybitov/todo_project/internal/task/repository"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultTrashRetention используется, если срок хранения корзины не задан в конфигурации.
+	DefaultTrashRetention = 30 * 24 * time.Hour
+	// trashCleanupInterval задает период очистки корзины.
+	trashCleanupInterval = time.Hour
+	// trashCleanupBatch ограничивает число задач, удаляемых за одну транзакцию.
+	trashCleanupBatch = 100
+)
+
+// ListTrash реализует метод получения задач в корзине.
+func (s *TaskService) ListTrash(ctx context.Context, req *taskPB.ListTrashRequest) (*taskPB.ListTrashResponse, error) {
+	log.InfoLogger.Printf("Getting trash for user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	tasks, err := s.repo.ListTrash(req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	var pbTasks []*taskPB.Task
+	for _, task := range tasks {
+		pbTasks = append(pbTasks, models.TaskToPB(task))
+	}
+
+	return &taskPB.ListTrashResponse{Tasks: pbTasks}, nil
+}
+
+// RestoreTask реализует метод восстановления задачи из корзины вместе с подзадачами, удаленными с ней.
+func (s *TaskService) RestoreTask(ctx context.Context, req *taskPB.RestoreTaskRequest) (*taskPB.RestoreTaskResponse, error) {
+	log.InfoLogger.Printf("Restoring task with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	task, err := s.repo.RestoreTask(req.Id, req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.RestoreTaskResponse{Task: models.TaskToPB(task)}, nil
+}
+
+// PurgeTask реализует метод окончательного удаления задачи из корзины.
+func (s *TaskService) PurgeTask(ctx context.Context, req *taskPB.PurgeTaskRequest) (*taskPB.PurgeTaskResponse, error) {
+	log.InfoLogger.Printf("Purging task with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	if err := s.repo.PurgeTask(req.Id, req.UserId); err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.PurgeTaskResponse{Message: fmt.Sprintf("Task with ID - %d Purged Succesfully! ", req.Id)}, nil
+}
+
+// TrashCleaner окончательно удаляет задачи, которые пролежали в корзине дольше срока хранения.
+type TrashCleaner struct {
+	repo      *repository.Repository
+	retention time.Duration
+}
+
+// NewTrashCleaner создает очистку корзины с заданным сроком хранения.
+func NewTrashCleaner(repo *repository.Repository, retention time.Duration) *TrashCleaner {
+	if retention <= 0 {
+		retention = DefaultTrashRetention
+	}
+	return &TrashCleaner{repo: repo, retention: retention}
+}
+
+// Run очищает корзину сразу и затем раз в час, пока не отменен контекст.
+func (c *TrashCleaner) Run(ctx context.Context) {
+	log.InfoLogger.Printf("Trash cleaner is running, tasks are kept for %s", c.retention)
+
+	ticker := time.NewTicker(trashCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.RunOnce(time.Now().UTC()); err != nil {
+			log.ErrorLogger.Printf("Failed to clean the trash: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce удаляет задачи, перемещенные в корзину раньше, чем now минус срок хранения.
+func (c *TrashCleaner) RunOnce(now time.Time) error {
+	before := now.Add(-c.retention)
+	for {
+		purged, err := c.repo.PurgeExpired(before, trashCleanupBatch)
+		if err != nil {
+			return err
+		}
+		if purged < trashCleanupBatch {
+			return nil
+		}
+	}
+}
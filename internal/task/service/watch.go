@@ -0,0 +1,63 @@
+package task
+
+import (
+	"errors"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/damirbeybitov/todo_project/internal/task/repository"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// WatchTasks реализует метод потоковой ленты изменений задач пользователя.
+// Поток продолжается, пока клиент его не закроет.
+func (s *TaskService) WatchTasks(req *taskPB.WatchTasksRequest, stream taskPB.TaskService_WatchTasksServer) error {
+	log.InfoLogger.Printf("Watching tasks for user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	ctx := stream.Context()
+	watch, err := s.repo.WatchTasks(ctx, req.UserId)
+	if err != nil {
+		return taskError(err)
+	}
+	defer watch.Close()
+
+	// Заголовки сообщают клиенту, что подписка готова
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		change, err := watch.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return taskError(err)
+		}
+
+		// Задача читается с проверкой доступа: недоступная задача для
+		// пользователя удалена
+		if change.Action != models.EventDeleted {
+			task, err := s.repo.GetTaskByID(change.TaskId, req.UserId)
+			if errors.Is(err, repository.ErrTaskNotFound) {
+				change.Action = models.EventDeleted
+			} else if err != nil {
+				log.ErrorLogger.Printf("Failed to get changed task %d: %v", change.TaskId, err)
+				continue
+			} else {
+				change.Task = &task
+			}
+		}
+
+		if err := stream.Send(models.TaskChangeToPB(change)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/damirbeybitov/todo_project/internal/task/repository"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxWebhookURLLength ограничивает длину адреса подписки.
+	maxWebhookURLLength = 2048
+	// maxWebhookSecretLength ограничивает длину секрета подписки.
+	maxWebhookSecretLength = 255
+
+	// DefaultWebhookDispatchInterval используется, если период отправки не задан в конфигурации.
+	DefaultWebhookDispatchInterval = 5 * time.Second
+	// webhookDispatchBatch ограничивает число доставок, отправляемых за один проход.
+	webhookDispatchBatch = 50
+	// webhookTimeout ограничивает время ожидания ответа получателя.
+	webhookTimeout = 10 * time.Second
+	// webhookLease задает, через сколько захваченная доставка снова станет
+	// доступной, если отправитель не сообщил результат.
+	webhookLease = time.Minute
+	// webhookRetryDelay задает задержку перед первой повторной попыткой;
+	// каждая следующая ждет вдвое дольше.
+	webhookRetryDelay = 30 * time.Second
+	// webhookMaxAttempts задает число попыток, после которых доставка
+	// попадает в список недоставленных.
+	webhookMaxAttempts = 8
+)
+
+// Заголовки запроса доставки.
+const (
+	WebhookIdHeader        = "X-Webhook-Id"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// CreateWebhook реализует метод создания подписки. Если секрет не задан,
+// создается случайный; секрет возвращается только в ответе на этот запрос.
+func (s *TaskService) CreateWebhook(ctx context.Context, req *taskPB.CreateWebhookRequest) (*taskPB.CreateWebhookResponse, error) {
+	log.InfoLogger.Printf("Creating webhook for user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if req.Webhook == nil {
+		return nil, status.Error(codes.InvalidArgument, "webhook is required")
+	}
+
+	webhook, err := s.webhookFromRequest(req.Webhook)
+	if err != nil {
+		return nil, err
+	}
+	webhook.UserId = req.UserId
+	if webhook.Secret == "" {
+		if webhook.Secret, err = newWebhookSecret(); err != nil {
+			log.ErrorLogger.Printf("Failed to generate webhook secret: %v", err)
+			return nil, status.Error(codes.Internal, "failed to generate webhook secret")
+		}
+	}
+
+	created, err := s.repo.CreateWebhook(webhook)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.CreateWebhookResponse{Webhook: models.WebhookToPB(created)}, nil
+}
+
+// ListWebhooks реализует метод получения подписок пользователя без их секретов.
+func (s *TaskService) ListWebhooks(ctx context.Context, req *taskPB.ListWebhooksRequest) (*taskPB.ListWebhooksResponse, error) {
+	log.InfoLogger.Printf("Getting webhooks for user ID: %d", req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	webhooks, err := s.repo.ListWebhooks(req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	var pbWebhooks []*taskPB.Webhook
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+		pbWebhooks = append(pbWebhooks, models.WebhookToPB(webhook))
+	}
+
+	return &taskPB.ListWebhooksResponse{Webhooks: pbWebhooks}, nil
+}
+
+// UpdateWebhook реализует метод изменения подписки. Проект подписки не меняется,
+// пустой секрет остается прежним.
+func (s *TaskService) UpdateWebhook(ctx context.Context, req *taskPB.UpdateWebhookRequest) (*taskPB.UpdateWebhookResponse, error) {
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+	if req.Webhook == nil {
+		return nil, status.Error(codes.InvalidArgument, "webhook is required")
+	}
+	log.InfoLogger.Printf("Updating webhook with ID: %d", req.Webhook.Id)
+
+	webhook, err := s.webhookFromRequest(req.Webhook)
+	if err != nil {
+		return nil, err
+	}
+	webhook.UserId = req.UserId
+
+	updated, err := s.repo.UpdateWebhook(webhook)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	updated.Secret = ""
+	return &taskPB.UpdateWebhookResponse{Webhook: models.WebhookToPB(updated)}, nil
+}
+
+// DeleteWebhook реализует метод удаления подписки вместе с ее доставками.
+func (s *TaskService) DeleteWebhook(ctx context.Context, req *taskPB.DeleteWebhookRequest) (*taskPB.DeleteWebhookResponse, error) {
+	log.InfoLogger.Printf("Deleting webhook with ID: %d", req.Id)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	if err := s.repo.DeleteWebhook(req.Id, req.UserId); err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.DeleteWebhookResponse{Message: fmt.Sprintf("Webhook with ID - %d Deleted Succesfully! ", req.Id)}, nil
+}
+
+// ListDeadDeliveries реализует метод получения доставок подписки, все попытки которых не удались.
+func (s *TaskService) ListDeadDeliveries(ctx context.Context, req *taskPB.ListDeadDeliveriesRequest) (*taskPB.ListDeadDeliveriesResponse, error) {
+	log.InfoLogger.Printf("Getting dead deliveries of webhook %d for user ID: %d", req.WebhookId, req.UserId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	deliveries, err := s.repo.ListDeadDeliveries(req.WebhookId, req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	var pbDeliveries []*taskPB.WebhookDelivery
+	for _, delivery := range deliveries {
+		pbDeliveries = append(pbDeliveries, models.WebhookDeliveryToPB(delivery))
+	}
+
+	return &taskPB.ListDeadDeliveriesResponse{Deliveries: pbDeliveries}, nil
+}
+
+// RedeliverWebhook реализует метод повторной доставки недоставленного события.
+func (s *TaskService) RedeliverWebhook(ctx context.Context, req *taskPB.RedeliverWebhookRequest) (*taskPB.RedeliverWebhookResponse, error) {
+	log.InfoLogger.Printf("Redelivering delivery %d of webhook %d", req.DeliveryId, req.WebhookId)
+
+	if req.UserId == 0 {
+		return nil, status.Error(codes.PermissionDenied, "user id is required")
+	}
+
+	delivery, err := s.repo.RedeliverWebhook(req.WebhookId, req.DeliveryId, req.UserId)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return &taskPB.RedeliverWebhookResponse{Delivery: models.WebhookDeliveryToPB(delivery)}, nil
+}
+
+// webhookFromRequest проверяет адрес, события и секрет подписки. Повторяющиеся
+// события учитываются один раз.
+func (s *TaskService) webhookFromRequest(pb *taskPB.Webhook) (models.Webhook, error) {
+	webhook := models.WebhookFromPB(pb)
+
+	if len(webhook.Url) > maxWebhookURLLength {
+		return webhook, status.Errorf(codes.InvalidArgument, "url must be at most %d characters", maxWebhookURLLength)
+	}
+	target, err := url.Parse(webhook.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return webhook, status.Error(codes.InvalidArgument, "url must be an absolute http or https URL")
+	}
+	if !s.webhookTargets.allowsHost(target.Hostname()) {
+		return webhook, status.Error(codes.InvalidArgument, "url must not point to a local or private network")
+	}
+	if len(webhook.Secret) > maxWebhookSecretLength {
+		return webhook, status.Errorf(codes.InvalidArgument, "secret must be at most %d characters", maxWebhookSecretLength)
+	}
+
+	events := []string{}
+	seen := make(map[string]bool)
+	for i, event := range webhook.Events {
+		// Неизвестное значение из запроса не имеет имени, поэтому в ошибке указывается само значение
+		if !isWebhookEvent(event) {
+			return webhook, status.Errorf(codes.InvalidArgument, "unknown webhook event %s", pb.Events[i])
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	webhook.Events = events
+
+	return webhook, nil
+}
+
+// isWebhookEvent сообщает, может ли подписка получать событие с таким именем.
+func isWebhookEvent(event string) bool {
+	switch event {
+	case models.EventCreated, models.EventUpdated, models.EventDeleted, models.EventRestored, models.EventPurged:
+		return true
+	}
+	return false
+}
+
+// WebhookTargets перечисляет узлы, на которые разрешено отправлять доставки,
+// даже если они находятся в локальной или закрытой сети. Остальные адреса в
+// таких сетях отклоняются, чтобы подписка не открывала доступ к внутренним
+// сервисам.
+type WebhookTargets map[string]bool
+
+// NewWebhookTargets создает список разрешенных узлов из конфигурации. Узел
+// задается именем или IP-адресом так, как он записан в адресе подписки.
+func NewWebhookTargets(hosts []string) WebhookTargets {
+	targets := make(WebhookTargets)
+	for _, host := range hosts {
+		targets[strings.ToLower(strings.Trim(host, "[]"))] = true
+	}
+	return targets
+}
+
+// allowsHost проверяет узел из адреса подписки. Имена, кроме localhost,
+// проверяются при отправке, когда известен их адрес.
+func (t WebhookTargets) allowsHost(host string) bool {
+	host = strings.ToLower(host)
+	if t[host] {
+		return true
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return !isInternalIP(ip)
+	}
+	return true
+}
+
+// dialContext соединяется с получателем. Адрес, полученный для узла не из
+// списка, проверяется непосредственно перед соединением, поэтому имя,
+// указывающее на внутреннюю сеть, не позволяет обойти проверку.
+func (t WebhookTargets) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if host, _, err := net.SplitHostPort(address); err != nil || !t[strings.ToLower(host)] {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return fmt.Errorf("webhook target %s is in a local or private network", host)
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// isInternalIP сообщает, принадлежит ли адрес локальной, закрытой или служебной сети.
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// newWebhookSecret создает случайный секрет подписки.
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// SignWebhook возвращает подпись тела доставки: HMAC-SHA256 секретом от
+// строки "<timestamp>.<body>" в виде "sha256=<hex>". Получатель проверяет
+// подпись и отклоняет доставки со старой меткой времени.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher отправляет доставки подписок. Неудачная доставка
+// повторяется с экспоненциальной задержкой, после последней попытки она
+// попадает в список недоставленных. Несколько экземпляров сервиса не
+// отправляют одну доставку одновременно. Доставки во внутренние сети, кроме
+// разрешенных узлов, не отправляются.
+type WebhookDispatcher struct {
+	repo     *repository.Repository
+	client   *http.Client
+	interval time.Duration
+}
+
+// NewWebhookDispatcher создает отправителя с заданным периодом проверки очереди.
+func NewWebhookDispatcher(repo *repository.Repository, interval time.Duration, targets WebhookTargets) *WebhookDispatcher {
+	if interval <= 0 {
+		interval = DefaultWebhookDispatchInterval
+	}
+	// Прокси не используется: иначе проверялся бы адрес прокси, а не получателя
+	transport := &http.Transport{DialContext: targets.dialContext, TLSHandshakeTimeout: webhookTimeout}
+	return &WebhookDispatcher{repo: repo, client: &http.Client{Timeout: webhookTimeout, Transport: transport}, interval: interval}
+}
+
+// Run отправляет доставки сразу и затем с заданным периодом, пока не отменен контекст.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	log.InfoLogger.Printf("Webhook dispatcher is running every %s", d.interval)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.RunOnce(ctx, time.Now().UTC()); err != nil {
+			log.ErrorLogger.Printf("Failed to dispatch webhooks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce отправляет доставки, время которых наступило к моменту now.
+func (d *WebhookDispatcher) RunOnce(ctx context.Context, now time.Time) error {
+	for {
+		deliveries, err := d.repo.ClaimDeliveries(now, webhookLease, webhookDispatchBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			if err := d.deliver(ctx, delivery); err != nil {
+				log.ErrorLogger.Printf("Webhook delivery %d failed: %v", delivery.Id, err)
+				dead := delivery.Attempts >= webhookMaxAttempts
+				if err := d.repo.MarkFailed(delivery.Id, err.Error(), now.Add(webhookBackoff(delivery.Attempts)), dead); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := d.repo.MarkDelivered(delivery.Id, time.Now().UTC()); err != nil {
+				return err
+			}
+		}
+
+		if len(deliveries) < webhookDispatchBatch {
+			return nil
+		}
+	}
+}
+
+// deliver отправляет доставку; успешным считается любой ответ 2xx.
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery repository.PendingDelivery) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "todo_project-webhooks")
+	request.Header.Set(WebhookIdHeader, strconv.FormatInt(delivery.WebhookId, 10))
+	request.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	request.Header.Set(WebhookEventHeader, "task."+delivery.Action)
+	request.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(WebhookSignatureHeader, SignWebhook(delivery.Secret, timestamp, delivery.Payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// Тело ответа дочитывается, чтобы соединение использовалось повторно
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with %s", response.Status)
+	}
+	return nil
+}
+
+// webhookBackoff возвращает задержку перед следующей попыткой после attempts попыток.
+func webhookBackoff(attempts int32) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return webhookRetryDelay << (attempts - 1)
+}
@@ -0,0 +1,59 @@
+package task
+
+import (
+	"fmt"
+
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+// Workflow описывает допустимые переходы между статусами задачи.
+type Workflow map[string][]string
+
+// DefaultWorkflow используется, если переходы не заданы в конфигурации.
+var DefaultWorkflow = Workflow{
+	models.StatusTodo:       {models.StatusInProgress, models.StatusBlocked, models.StatusDone, models.StatusCancelled},
+	models.StatusInProgress: {models.StatusTodo, models.StatusBlocked, models.StatusDone, models.StatusCancelled},
+	models.StatusBlocked:    {models.StatusTodo, models.StatusInProgress, models.StatusCancelled},
+	models.StatusDone:       {models.StatusTodo},
+	models.StatusCancelled:  {models.StatusTodo},
+}
+
+// NewWorkflow проверяет таблицу переходов из конфигурации.
+// Пустая таблица заменяется на DefaultWorkflow.
+func NewWorkflow(transitions map[string][]string) (Workflow, error) {
+	if len(transitions) == 0 {
+		return DefaultWorkflow, nil
+	}
+
+	for from, targets := range transitions {
+		if !isKnownStatus(from) {
+			return nil, fmt.Errorf("unknown task status %q in transitions", from)
+		}
+		for _, to := range targets {
+			if !isKnownStatus(to) {
+				return nil, fmt.Errorf("unknown task status %q in transitions of %q", to, from)
+			}
+		}
+	}
+
+	return Workflow(transitions), nil
+}
+
+// CanTransition сообщает, можно ли перевести задачу из статуса from в статус to.
+// Сохранение текущего статуса всегда разрешено.
+func (w Workflow) CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, target := range w[from] {
+		if target == to {
+			return true
+		}
+	}
+	return false
+}
+
+func isKnownStatus(status string) bool {
+	_, ok := models.StatusToPB(status)
+	return ok && status != ""
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTokenRevoked is returned for tokens that were revoked before they expired.
+var ErrTokenRevoked = errors.New("token revoked")
+
+const (
+	// deniedTokenKey marks a revoked token by its id until the token expires.
+	deniedTokenKey = "denied-token:%s"
+	// tokenGenerationKey holds the token generation of a user, raised every
+	// time all tokens of the user are revoked. It never expires: a reset
+	// generation would let the tokens of older generations pass again.
+	tokenGenerationKey = "token-generation:%s"
+)
+
+// Denylist keeps the tokens revoked before they expire. The services that
+// revoke tokens and the gateway that checks them share it through Redis.
+type Denylist struct {
+	redis *redis.Client
+}
+
+func NewDenylist(redis *redis.Client) *Denylist {
+	return &Denylist{redis: redis}
+}
+
+// DenyToken revokes the token with the claims until it expires.
+func (d *Denylist) DenyToken(claims jwt.StandardClaims) error {
+	ttl := time.Until(time.Unix(claims.ExpiresAt, 0))
+	if claims.Id == "" || ttl <= 0 {
+		return nil
+	}
+
+	if err := d.redis.Set(context.Background(), fmt.Sprintf(deniedTokenKey, claims.Id), claims.Subject, ttl).Err(); err != nil {
+		log.ErrorLogger.Printf("Failed to deny token: %v", err)
+		return err
+	}
+
+	log.InfoLogger.Printf("Token revoked for user: %s", claims.Subject)
+	return nil
+}
+
+// Generation returns the current token generation of the user, to be put in
+// the tokens issued to the user.
+func (d *Denylist) Generation(username string) (int64, error) {
+	generation, err := d.redis.Get(context.Background(), fmt.Sprintf(tokenGenerationKey, username)).Int64()
+	if err != nil && err != redis.Nil {
+		log.ErrorLogger.Printf("Failed to get token generation: %v", err)
+		return 0, err
+	}
+	return generation, nil
+}
+
+// DenyUserTokens revokes every token of the user issued up to now by raising
+// its generation. Tokens issued right after are of the new generation and
+// stay valid.
+func (d *Denylist) DenyUserTokens(username string) error {
+	err := d.redis.Incr(context.Background(), fmt.Sprintf(tokenGenerationKey, username)).Err()
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to deny user tokens: %v", err)
+		return err
+	}
+
+	log.InfoLogger.Printf("All tokens revoked for user: %s", username)
+	return nil
+}
+
+// Check returns ErrTokenRevoked when the token with the claims and token
+// generation was revoked.
+func (d *Denylist) Check(claims jwt.StandardClaims, generation int64) error {
+	ctx := context.Background()
+	pipe := d.redis.Pipeline()
+	denied := pipe.Exists(ctx, fmt.Sprintf(deniedTokenKey, claims.Id))
+	current := pipe.Get(ctx, fmt.Sprintf(tokenGenerationKey, claims.Subject))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		log.ErrorLogger.Printf("Failed to check token revocation: %v", err)
+		return err
+	}
+
+	if claims.Id != "" && denied.Val() > 0 {
+		log.ErrorLogger.Printf("Revoked token used by user: %s", claims.Subject)
+		return ErrTokenRevoked
+	}
+	if latest, err := strconv.ParseInt(current.Val(), 10, 64); err == nil && generation < latest {
+		log.ErrorLogger.Printf("Token of a revoked generation used by user: %s", claims.Subject)
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrNoKeys is returned when tokens are signed or verified before SetKeys.
+var ErrNoKeys = errors.New("token keys are not configured")
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// signingKeyEnv overrides the id of the signing key of the configuration,
+// so a key can be rotated in without editing it.
+const signingKeyEnv = "TOKEN_SIGNING_KEY"
+
+// keys are the keys of the process, set once at startup.
+var keys atomic.Pointer[KeySet]
+
+// Key is a key that verifies tokens and, with its private part, signs them.
+type Key struct {
+	Id        string
+	Algorithm string
+	method    jwt.SigningMethod
+	// signKey is nil for keys that only verify tokens
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet is the signing key and every key that still verifies tokens, by id.
+// Tokens carry the id of their key in the kid header, so keys can be added
+// and retired without invalidating the tokens of the other keys.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// LoadKeys reads the keys of the configuration. Secrets and PEM keys are
+// given inline, as "env:NAME" or as "file:PATH".
+func LoadKeys(config models.TokenKeysConfig) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key, len(config.Keys))}
+	for _, keyConfig := range config.Keys {
+		if keyConfig.Id == "" {
+			return nil, errors.New("token key without id")
+		}
+		if _, ok := set.keys[keyConfig.Id]; ok {
+			return nil, fmt.Errorf("duplicate token key %q", keyConfig.Id)
+		}
+
+		key, err := loadKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("token key %q: %w", keyConfig.Id, err)
+		}
+		set.keys[key.Id] = key
+	}
+
+	signingKey := config.SigningKey
+	if id := os.Getenv(signingKeyEnv); id != "" {
+		signingKey = id
+	}
+	if signingKey != "" {
+		set.signing = set.keys[signingKey]
+		if set.signing == nil {
+			return nil, fmt.Errorf("unknown signing key %q", signingKey)
+		}
+		if set.signing.signKey == nil {
+			return nil, fmt.Errorf("signing key %q has no private key", signingKey)
+		}
+	}
+
+	return set, nil
+}
+
+// SetKeys makes the keys sign and verify the tokens of the process.
+func SetKeys(set *KeySet) {
+	keys.Store(set)
+}
+
+// JWKS returns the public keys that verify tokens as a JSON Web Key Set.
+// Secret keys are left out.
+func JWKS() (models.JWKSet, error) {
+	set := keys.Load()
+	if set == nil {
+		return models.JWKSet{}, ErrNoKeys
+	}
+
+	jwks := models.JWKSet{Keys: []models.JWK{}}
+	for _, key := range set.keys {
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, models.JWK{
+				Kty: "RSA",
+				Kid: key.Id,
+				Alg: key.Algorithm,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, models.JWK{
+				Kty: "OKP",
+				Kid: key.Id,
+				Alg: key.Algorithm,
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks, nil
+}
+
+// signToken signs the claims with the signing key and names it in the header.
+func signToken(claims jwt.Claims) (string, error) {
+	set := keys.Load()
+	if set == nil || set.signing == nil {
+		log.ErrorLogger.Printf("Failed to sign token: %v", ErrNoKeys)
+		return "", ErrNoKeys
+	}
+
+	token := jwt.NewWithClaims(set.signing.method, claims)
+	token.Header["kid"] = set.signing.Id
+	return token.SignedString(set.signing.signKey)
+}
+
+// verificationKey returns the key of the kid header of a token. Tokens
+// without kid, signed before keys had ids, are verified with the signing key.
+// The algorithm of the token must be the one of its key.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	set := keys.Load()
+	if set == nil {
+		return nil, ErrNoKeys
+	}
+
+	key := set.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = set.keys[kid]
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown key %v", token.Header["kid"])
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+func loadKey(config models.TokenKeyConfig) (*Key, error) {
+	key := &Key{Id: config.Id, Algorithm: config.Algorithm}
+	switch config.Algorithm {
+	case AlgorithmHS256:
+		secret, err := keyMaterial(config.Secret)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("secret is required")
+		}
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodHS256, secret, secret
+
+	case AlgorithmRS256, AlgorithmEdDSA:
+		key.method = jwt.SigningMethodRS256
+		if config.Algorithm == AlgorithmEdDSA {
+			key.method = signingMethodEdDSA
+		}
+
+		private, err := keyMaterial(config.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(private) > 0 {
+			signer, err := parsePrivateKey(config.Algorithm, private)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = signer, signer.Public()
+		}
+
+		public, err := keyMaterial(config.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(public) > 0 && key.verifyKey == nil {
+			if key.verifyKey, err = parsePublicKey(config.Algorithm, public); err != nil {
+				return nil, err
+			}
+		}
+		if key.verifyKey == nil {
+			return nil, errors.New("private or public key is required")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", config.Algorithm)
+	}
+	return key, nil
+}
+
+// keyMaterial reads a secret or a PEM key given inline, as "env:NAME" or as
+// "file:PATH".
+func keyMaterial(source string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(source, "env:"):
+		return []byte(os.Getenv(strings.TrimPrefix(source, "env:"))), nil
+	case strings.HasPrefix(source, "file:"):
+		return os.ReadFile(strings.TrimPrefix(source, "file:"))
+	default:
+		return []byte(source), nil
+	}
+}
+
+// parsePrivateKey parses a PKCS#1 or PKCS#8 RSA key, or a PKCS#8 Ed25519 key.
+func parsePrivateKey(algorithm string, data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	var parsed interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if algorithm == AlgorithmRS256 {
+			return private, nil
+		}
+	case ed25519.PrivateKey:
+		if algorithm == AlgorithmEdDSA {
+			return private, nil
+		}
+	}
+	return nil, fmt.Errorf("private key is not a %s key", algorithm)
+}
+
+// parsePublicKey parses a PKIX RSA or Ed25519 key.
+func parsePublicKey(algorithm string, data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch public := parsed.(type) {
+	case *rsa.PublicKey:
+		if algorithm == AlgorithmRS256 {
+			return public, nil
+		}
+	case ed25519.PublicKey:
+		if algorithm == AlgorithmEdDSA {
+			return public, nil
+		}
+	}
+	return nil, fmt.Errorf("public key is not a %s key", algorithm)
+}
+
+// signingMethodEdDSA signs tokens with Ed25519 (RFC 8037), which jwt-go does
+// not provide.
+var signingMethodEdDSA = &eddsaMethod{}
+
+type eddsaMethod struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(AlgorithmEdDSA, func() jwt.SigningMethod { return signingMethodEdDSA })
+}
+
+func (m *eddsaMethod) Alg() string {
+	return AlgorithmEdDSA
+}
+
+func (m *eddsaMethod) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
+
+func (m *eddsaMethod) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
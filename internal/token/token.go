@@ -1,7 +1,12 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/damirbeybitov/todo_project/internal/log"
@@ -11,50 +16,218 @@ import (
 const (
 	accessTokenTime 	= time.Minute * 15
 	refreshTokenTime 	= time.Hour * 24
-	signingKey			= "yIAYiuIoibngJG78G785F76"
+	// refreshTokenType marks refresh tokens, so they are not taken for access tokens
+	refreshTokenType	= "refresh"
 )
 
-func GenerateRefreshToken(username string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(refreshTokenTime).Unix(),
-		Subject:   username,
-	})
+// ErrInvalidToken is returned for tokens that are malformed, expired, badly
+// signed or of the wrong type.
+var ErrInvalidToken = errors.New("invalid JWT token")
+
+// Roles of users. Every user has the user role; the others are granted.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Scopes of access tokens: the parts of the API a token may be used for.
+const (
+	ScopeProfile  = "profile"
+	ScopeTasks    = "tasks"
+	ScopeProjects = "projects"
+	ScopeWebhooks = "webhooks"
+	ScopeAdmin    = "admin"
+)
 
-	return token.SignedString([]byte(signingKey))
+// roleScopes are the scopes granted to the users of a role.
+var roleScopes = map[string][]string{
+	RoleUser:  {ScopeProfile, ScopeTasks, ScopeProjects, ScopeWebhooks},
+	RoleAdmin: {ScopeAdmin},
 }
 
-func GenerateAccessToken(username string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(accessTokenTime).Unix(),
-		Subject:   username,
-	})
+// ScopesForRoles returns the scopes granted by the roles, sorted.
+func ScopesForRoles(roles []string) []string {
+	granted := make(map[string]bool)
+	for _, role := range roles {
+		for _, scope := range roleScopes[role] {
+			granted[scope] = true
+		}
+	}
+
+	scopes := make([]string, 0, len(granted))
+	for scope := range granted {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// Identity is the user an access token was issued to.
+type Identity struct {
+	UserId   int64
+	Username string
+	Roles    []string
+	Scopes   []string
+}
+
+// HasRole reports whether the user has the role.
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token was granted the scope.
+func (i Identity) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
 
-	return token.SignedString([]byte(signingKey))
+// AccessClaims are the claims of an access token. The scopes are separated
+// by spaces, as in OAuth. Generation is the token generation of the user the
+// token was issued in, see Denylist.
+type AccessClaims struct {
+	// Type is set only on refresh tokens, which must not pass for access tokens
+	Type       string   `json:"typ,omitempty"`
+	UserId     int64    `json:"uid"`
+	Roles      []string `json:"roles,omitempty"`
+	Scope      string   `json:"scope,omitempty"`
+	Generation int64    `json:"gen,omitempty"`
+	jwt.StandardClaims
 }
 
-func VerifyToken(token string) (string, error) {
-	t, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return []byte(signingKey), nil
+// Identity returns the user the token was issued to.
+func (c AccessClaims) Identity() Identity {
+	return Identity{
+		UserId:   c.UserId,
+		Username: c.Subject,
+		Roles:    c.Roles,
+		Scopes:   strings.Fields(c.Scope),
+	}
+}
+
+// RefreshClaims are the claims of a refresh token. Every refresh token has a
+// unique id; the tokens rotated from the same login share the family.
+type RefreshClaims struct {
+	Type       string `json:"typ"`
+	Family     string `json:"fam"`
+	Generation int64  `json:"gen,omitempty"`
+	jwt.StandardClaims
+}
+
+// GenerateRefreshToken returns a refresh token of the user in the family, a
+// new family when it is empty, and the token generation, with its claims.
+func GenerateRefreshToken(username string, family string, generation int64) (string, RefreshClaims, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", RefreshClaims{}, err
+	}
+	if family == "" {
+		if family, err = newTokenID(); err != nil {
+			return "", RefreshClaims{}, err
+		}
+	}
+
+	now := time.Now()
+	claims := RefreshClaims{
+		Type:       refreshTokenType,
+		Family:     family,
+		Generation: generation,
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(refreshTokenTime).Unix(),
+			Subject:   username,
+		},
+	}
+	token, err := signToken(&claims)
+	return token, claims, err
+}
+
+// GenerateAccessToken returns an access token of the user with a unique id,
+// so the token can be revoked on its own. The token carries the id, roles and
+// scopes of the user, so they need no lookup on every request, and the token
+// generation.
+func GenerateAccessToken(identity Identity, generation int64) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return signToken(&AccessClaims{
+		UserId:     identity.UserId,
+		Roles:      identity.Roles,
+		Scope:      strings.Join(identity.Scopes, " "),
+		Generation: generation,
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(accessTokenTime).Unix(),
+			Subject:   identity.Username,
+		},
 	})
+}
+
+// VerifyToken returns the user of a valid access token.
+func VerifyToken(token string) (Identity, error) {
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		return Identity{}, err
+	}
+	return claims.Identity(), nil
+}
+
+// ParseAccessToken returns the claims of a valid access token. Whether the
+// token was revoked is up to the caller. Tokens issued before the claims had
+// the user id have it zero.
+func ParseAccessToken(token string) (AccessClaims, error) {
+	var claims AccessClaims
+	t, err := jwt.ParseWithClaims(token, &claims, verificationKey)
 	if err != nil {
 		log.ErrorLogger.Printf("Error parsing JWT token: %v", err)
-		return "", err
+		return AccessClaims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
 	}
 
-	claims, ok := t.Claims.(jwt.MapClaims)
-	if !ok || !t.Valid {
+	if !t.Valid || claims.Type == refreshTokenType || claims.Subject == "" {
 		log.ErrorLogger.Printf("Invalid JWT token")
-		return "", errors.New("invalid JWT token")
+		return AccessClaims{}, ErrInvalidToken
 	}
 
-	return claims["sub"].(string), nil
+	return claims, nil
 }
 
-func RefreshToken(refreshToken string) (string, error) {
-	username, err := VerifyToken(refreshToken)
+// ParseRefreshToken returns the claims of a valid refresh token. Whether the
+// token was revoked is up to the caller.
+func ParseRefreshToken(token string) (RefreshClaims, error) {
+	var claims RefreshClaims
+	t, err := jwt.ParseWithClaims(token, &claims, verificationKey)
 	if err != nil {
-		return "", err
+		log.ErrorLogger.Printf("Error parsing refresh token: %v", err)
+		return claims, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if !t.Valid || claims.Type != refreshTokenType || claims.Id == "" || claims.Family == "" || claims.Subject == "" {
+		log.ErrorLogger.Printf("Invalid refresh token")
+		return claims, ErrInvalidToken
 	}
 
-	return GenerateAccessToken(username)
-}
\ No newline at end of file
+	return claims, nil
+}
+
+// newTokenID returns a random token id.
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.ErrorLogger.Printf("Failed to generate token id: %v", err)
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
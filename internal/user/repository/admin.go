@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+)
+
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidPageToken = errors.New("malformed page token")
+)
+
+const (
+	defaultUsersPageSize = 50
+	maxUsersPageSize     = 500
+)
+
+// ListUsers returns a page of the users by id with their granted roles, and
+// the token of the next page, empty on the last one. A page starts after the
+// last user of the previous one, so users registered or deleted in between
+// do not shift the pages.
+func (r *Repository) ListUsers(pageSize int32, pageToken string) ([]models.UserAccount, string, error) {
+	afterID, err := decodePageToken(pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := int(pageSize)
+	if limit <= 0 {
+		limit = defaultUsersPageSize
+	}
+	if limit > maxUsersPageSize {
+		limit = maxUsersPageSize
+	}
+
+	rows, err := r.DB.Query(`SELECT u.id, u.username, u.email, u.disabled, COALESCE(GROUP_CONCAT(ur.role ORDER BY ur.role), '')
+		FROM users u LEFT JOIN user_roles ur ON ur.user_id = u.id
+		WHERE u.id > ? GROUP BY u.id ORDER BY u.id LIMIT ?`, afterID, limit+1)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to list users: %v", err)
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	users := []models.UserAccount{}
+	for rows.Next() {
+		var user models.UserAccount
+		var email sql.NullString
+		var roles string
+		if err := rows.Scan(&user.Id, &user.Username, &email, &user.Disabled, &roles); err != nil {
+			log.ErrorLogger.Printf("Failed to scan user: %v", err)
+			return nil, "", err
+		}
+		user.Email = email.String
+		user.Roles = []string{}
+		if roles != "" {
+			user.Roles = strings.Split(roles, ",")
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		log.ErrorLogger.Printf("Failed to list users: %v", err)
+		return nil, "", err
+	}
+
+	var nextPageToken string
+	if len(users) > limit {
+		users = users[:limit]
+		nextPageToken = encodePageToken(users[limit-1].Id)
+	}
+
+	return users, nextPageToken, nil
+}
+
+// SetUserDisabled disables or enables the user and returns its username.
+func (r *Repository) SetUserDisabled(id int64, disabled bool) (string, error) {
+	username, err := r.usernameByID(id)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := r.DB.Exec("UPDATE users SET disabled = ? WHERE id = ?", disabled, id); err != nil {
+		log.ErrorLogger.Printf("Failed to update user: %v", err)
+		return "", err
+	}
+
+	return username, nil
+}
+
+// ResetPassword replaces the password hash of the user and returns its username.
+func (r *Repository) ResetPassword(id int64, hashedPassword string) (string, error) {
+	username, err := r.usernameByID(id)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := r.DB.Exec("UPDATE users SET password = ? WHERE id = ?", hashedPassword, id); err != nil {
+		log.ErrorLogger.Printf("Failed to reset password: %v", err)
+		return "", err
+	}
+
+	return username, nil
+}
+
+func (r *Repository) usernameByID(id int64) (string, error) {
+	var username string
+	err := r.DB.QueryRow("SELECT username FROM users WHERE id = ?", id).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.ErrorLogger.Printf("User not found: %d", id)
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to get user: %v", err)
+		return "", err
+	}
+
+	return username, nil
+}
+
+// encodePageToken returns the token of the page after the user with the id.
+func encodePageToken(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodePageToken returns the id of the user a page starts after, 0 for the
+// first page.
+func decodePageToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidPageToken
+	}
+
+	id, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidPageToken
+	}
+
+	return id, nil
+}
@@ -72,6 +72,12 @@ func (r *Repository) CheckPassword(username string, password string) error {
 }
 
 func (r *Repository) DeleteUserFromDB(tx *sql.Tx, username string) error {
+	// Roles of the user go with it
+	if _, err := r.DB.Exec("DELETE user_roles FROM user_roles JOIN users ON users.id = user_roles.user_id WHERE users.username = ?", username); err != nil {
+		log.ErrorLogger.Printf("Failed to delete user roles: %v", err)
+		return err
+	}
+
 	result, err := r.DB.Exec("DELETE FROM users WHERE username = ?", username)
 	if err != nil {
 		log.ErrorLogger.Printf("Failed to delete user: %v", err)
@@ -0,0 +1,88 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/damirbeybitov/todo_project/internal/log"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/damirbeybitov/todo_project/internal/user/repository"
+	userPB "github.com/damirbeybitov/todo_project/proto/user"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListUsers возвращает страницу пользователей с их ролями. Доступ только для
+// администраторов проверяет шлюз.
+func (s *UserService) ListUsers(ctx context.Context, req *userPB.ListUsersRequest) (*userPB.ListUsersResponse, error) {
+	log.InfoLogger.Printf("Listing users, page size: %d", req.PageSize)
+
+	users, nextPageToken, err := s.repo.ListUsers(req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, userError(err)
+	}
+
+	response := &userPB.ListUsersResponse{NextPageToken: nextPageToken}
+	for _, user := range users {
+		response.Users = append(response.Users, models.UserAccountToPB(user))
+	}
+	return response, nil
+}
+
+// SetUserDisabled отключает или включает учетную запись. Токены отключенного
+// пользователя отзываются сразу, новые ему не выдаются.
+func (s *UserService) SetUserDisabled(ctx context.Context, req *userPB.SetUserDisabledRequest) (*userPB.SetUserDisabledResponse, error) {
+	log.InfoLogger.Printf("Setting user ID %d disabled: %t", req.Id, req.Disabled)
+
+	username, err := s.repo.SetUserDisabled(req.Id, req.Disabled)
+	if err != nil {
+		return nil, userError(err)
+	}
+
+	if req.Disabled {
+		if err := s.denylist.DenyUserTokens(username); err != nil {
+			return nil, userError(err)
+		}
+		return &userPB.SetUserDisabledResponse{Message: fmt.Sprintf("User %s disabled", username)}, nil
+	}
+	return &userPB.SetUserDisabledResponse{Message: fmt.Sprintf("User %s enabled", username)}, nil
+}
+
+// ResetPassword задает пользователю новый пароль и отзывает выданные ему токены.
+func (s *UserService) ResetPassword(ctx context.Context, req *userPB.ResetPasswordRequest) (*userPB.ResetPasswordResponse, error) {
+	log.InfoLogger.Printf("Resetting password of user ID: %d", req.Id)
+
+	if req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.ErrorLogger.Printf("Failed to hash password: %v", err)
+		return nil, userError(err)
+	}
+
+	username, err := s.repo.ResetPassword(req.Id, string(hashedPassword))
+	if err != nil {
+		return nil, userError(err)
+	}
+
+	if err := s.denylist.DenyUserTokens(username); err != nil {
+		return nil, userError(err)
+	}
+
+	return &userPB.ResetPasswordResponse{Message: fmt.Sprintf("Password of user %s reset", username)}, nil
+}
+
+// userError переводит ошибку репозитория в статус gRPC.
+func userError(err error) error {
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, repository.ErrInvalidPageToken) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/damirbeybitov/todo_project/internal/log"
+	token "github.com/damirbeybitov/todo_project/internal/token"
 	"github.com/damirbeybitov/todo_project/internal/user/repository"
 	userPB "github.com/damirbeybitov/todo_project/proto/user"
 	"golang.org/x/crypto/bcrypt"
@@ -12,11 +13,13 @@ import (
 
 type UserService struct{
 	repo *repository.Repository
+	// denylist revokes the tokens of deleted, disabled and reset users
+	denylist *token.Denylist
 	userPB.UnimplementedUserServiceServer
 }
 
-func NewUserService(repo *repository.Repository) userPB.UserServiceServer {
-	return &UserService{repo: repo}
+func NewUserService(repo *repository.Repository, denylist *token.Denylist) userPB.UserServiceServer {
+	return &UserService{repo: repo, denylist: denylist}
 }
 
 func (s *UserService) RegisterUser(ctx context.Context, req *userPB.RegisterUserRequest) (*userPB.RegisterUserResponse, error) {
@@ -105,6 +108,11 @@ func (s *UserService) DeleteUser(ctx context.Context, req *userPB.DeleteUserRequ
 		return nil, err
 	}
 
+	// Токены удаленного пользователя перестают действовать сразу
+	if err := s.denylist.DenyUserTokens(req.Username); err != nil {
+		return nil, err
+	}
+
 	log.InfoLogger.Printf("User deleted successfully with username: %s", req.Username)
 
 	message := fmt.Sprintf("User deleted successfully with username: %s", req.Username)
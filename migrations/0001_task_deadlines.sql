@@ -0,0 +1,8 @@
+-- Due dates, priorities and timestamps on tasks.
+ALTER TABLE tasks
+    ADD COLUMN due_at DATETIME NULL,
+    ADD COLUMN priority ENUM('low', 'medium', 'high', 'urgent') NOT NULL DEFAULT 'medium',
+    ADD COLUMN created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_tasks_user_due_at ON tasks (user_id, due_at);
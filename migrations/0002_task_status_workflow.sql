@@ -0,0 +1,8 @@
+-- Replace the boolean task status with a workflow status.
+ALTER TABLE tasks
+    ADD COLUMN workflow_status ENUM('todo', 'in_progress', 'blocked', 'done', 'cancelled') NOT NULL DEFAULT 'todo';
+
+UPDATE tasks SET workflow_status = IF(status, 'done', 'todo');
+
+ALTER TABLE tasks DROP COLUMN status;
+ALTER TABLE tasks RENAME COLUMN workflow_status TO status;
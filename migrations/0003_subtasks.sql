@@ -0,0 +1,4 @@
+-- Allow tasks to have a parent task.
+ALTER TABLE tasks
+    ADD COLUMN parent_id BIGINT NULL,
+    ADD INDEX idx_tasks_parent_id (parent_id);
@@ -0,0 +1,14 @@
+-- Projects group the tasks of a user.
+CREATE TABLE projects (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    user_id BIGINT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_projects_user_id (user_id)
+);
+
+ALTER TABLE tasks
+    ADD COLUMN project_id BIGINT NULL,
+    ADD INDEX idx_tasks_project_id (project_id);
@@ -0,0 +1,11 @@
+-- Project membership with roles. Every existing project gets its creator as owner.
+CREATE TABLE project_members (
+    project_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    role ENUM('owner', 'editor', 'viewer') NOT NULL,
+    PRIMARY KEY (project_id, user_id),
+    INDEX idx_project_members_user_id (user_id)
+);
+
+INSERT INTO project_members (project_id, user_id, role)
+SELECT id, user_id, 'owner' FROM projects;
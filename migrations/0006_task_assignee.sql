@@ -0,0 +1,4 @@
+-- Tasks can be assigned to another user.
+ALTER TABLE tasks
+    ADD COLUMN assignee_id BIGINT NULL,
+    ADD INDEX idx_tasks_assignee_id (assignee_id);
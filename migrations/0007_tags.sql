@@ -0,0 +1,14 @@
+-- Tags of a user and the tasks they are put on.
+CREATE TABLE tags (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    UNIQUE KEY uq_tags_user_name (user_id, name)
+);
+
+CREATE TABLE task_tags (
+    task_id BIGINT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    PRIMARY KEY (task_id, tag_id),
+    INDEX idx_task_tags_tag_id (tag_id)
+);
@@ -0,0 +1,10 @@
+-- Recurring tasks. Every occurrence of a series points at the first task of
+-- the series and remembers the moment it was scheduled for; the unique key
+-- keeps an occurrence from being created twice.
+ALTER TABLE tasks
+    ADD COLUMN recurrence VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN series_id BIGINT NULL,
+    ADD COLUMN occurrence_at DATETIME NULL,
+    ADD UNIQUE KEY uq_tasks_series_occurrence (series_id, occurrence_at);
+
+CREATE INDEX idx_tasks_recurrence_occurrence_at ON tasks (recurrence, occurrence_at);
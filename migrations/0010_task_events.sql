@@ -0,0 +1,11 @@
+-- Append-only history of task changes. Events outlive the tasks they
+-- describe; a NULL user_id marks changes made by the task service itself.
+CREATE TABLE task_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    task_id BIGINT NOT NULL,
+    user_id BIGINT NULL,
+    action ENUM('created', 'updated', 'deleted') NOT NULL,
+    changes JSON NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_task_events_task_id (task_id, id)
+);
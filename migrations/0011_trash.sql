@@ -0,0 +1,8 @@
+-- Deleted tasks stay in the trash until they are restored or purged.
+ALTER TABLE tasks
+    ADD COLUMN deleted_at DATETIME NULL;
+
+CREATE INDEX idx_tasks_deleted_at ON tasks (deleted_at);
+
+ALTER TABLE task_events
+    MODIFY COLUMN action ENUM('created', 'updated', 'deleted', 'restored', 'purged') NOT NULL;
@@ -0,0 +1,5 @@
+-- Full-text indexes used by task search.
+CREATE FULLTEXT INDEX ft_tasks_title ON tasks (title);
+CREATE FULLTEXT INDEX ft_tasks_description ON tasks (description);
+CREATE FULLTEXT INDEX ft_task_comments_body ON task_comments (body);
+CREATE FULLTEXT INDEX ft_tags_name ON tags (name);
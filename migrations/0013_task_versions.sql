@@ -0,0 +1,3 @@
+-- Every change of a task bumps its version, used for optimistic concurrency.
+ALTER TABLE tasks
+    ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,34 @@
+-- Webhook subscriptions. A webhook without a project receives the events of
+-- the tasks its user created or is assigned; a project webhook receives the
+-- events of the tasks of the project. Events is a comma-separated list of
+-- task event actions, empty for all of them.
+CREATE TABLE webhooks (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    project_id BIGINT NULL,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_webhooks_user_id (user_id),
+    INDEX idx_webhooks_project_id (project_id)
+);
+
+-- Deliveries are queued in the transaction that records the task event and
+-- sent by the task service. Failed deliveries are retried with exponential
+-- backoff; the ones that failed every attempt are dead until redelivered.
+CREATE TABLE webhook_deliveries (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    webhook_id BIGINT NOT NULL,
+    event_id BIGINT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    payload JSON NOT NULL,
+    status ENUM('pending', 'delivered', 'dead') NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error VARCHAR(1024) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at DATETIME NULL,
+    INDEX idx_webhook_deliveries_due (status, next_attempt_at),
+    INDEX idx_webhook_deliveries_webhook_id (webhook_id, status, id)
+);
@@ -0,0 +1,11 @@
+-- Roles granted to users on top of the user role every user has. The first
+-- admin is granted by hand:
+--   INSERT INTO user_roles (user_id, role) SELECT id, 'admin' FROM users WHERE username = '...';
+CREATE TABLE user_roles (
+    user_id BIGINT NOT NULL,
+    role ENUM('admin') NOT NULL,
+    PRIMARY KEY (user_id, role)
+);
+
+-- Disabled users can neither log in nor use the tokens they were issued.
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
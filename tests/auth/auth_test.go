@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/damirbeybitov/todo_project/internal/auth/repository"
+	"github.com/damirbeybitov/todo_project/internal/models"
+	token "github.com/damirbeybitov/todo_project/internal/token"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// Tokens are signed with a test key
+	keys, err := token.LoadKeys(models.TokenKeysConfig{
+		SigningKey: "test",
+		Keys:       []models.TokenKeyConfig{{Id: "test", Algorithm: token.AlgorithmHS256, Secret: "test-secret"}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	token.SetKeys(keys)
+	os.Exit(m.Run())
+}
+
+// createUser inserts the user unless it exists; tokens are issued to users only.
+func createUser(t *testing.T, db *sql.DB, username string) {
+	_, err := db.Exec("INSERT INTO users (username) SELECT ? FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM users WHERE username = ?)", username, username)
+	assert.NoError(t, err, "Failed to insert user into the database")
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+	createUser(t, db, "rotation_user")
+
+	_, refreshToken, err := repo.GenerateTokens("rotation_user")
+	if !assert.NoError(t, err, "Expected no error from GenerateTokens") {
+		return
+	}
+
+	_, err = token.VerifyToken(refreshToken)
+	assert.ErrorIs(t, err, token.ErrInvalidToken, "Expected a refresh token not to be an access token")
+
+	accessToken, rotated, err := repo.RotateRefreshToken(refreshToken)
+	assert.NoError(t, err, "Expected no error from RotateRefreshToken")
+	assert.NotEqual(t, refreshToken, rotated, "Expected a new refresh token")
+	identity, err := token.VerifyToken(accessToken)
+	assert.NoError(t, err, "Expected a valid access token")
+	assert.Equal(t, "rotation_user", identity.Username, "Expected the access token of the user")
+	assert.NotZero(t, identity.UserId, "Expected the access token to carry the user id")
+	assert.Equal(t, []string{token.RoleUser}, identity.Roles, "Expected the roles of the user")
+
+	// Reusing the first token revokes the family, the rotated token included
+	_, _, err = repo.RotateRefreshToken(refreshToken)
+	assert.ErrorIs(t, err, repository.ErrTokenReused, "Expected the reuse to be detected")
+	_, _, err = repo.RotateRefreshToken(rotated)
+	assert.ErrorIs(t, err, token.ErrTokenRevoked, "Expected the family to be revoked")
+
+	// Logout revokes one login, LogoutAll every login
+	_, first, err := repo.GenerateTokens("rotation_user")
+	assert.NoError(t, err, "Expected no error from GenerateTokens")
+	_, second, err := repo.GenerateTokens("rotation_user")
+	assert.NoError(t, err, "Expected no error from GenerateTokens")
+	_, third, err := repo.GenerateTokens("rotation_user")
+	assert.NoError(t, err, "Expected no error from GenerateTokens")
+
+	assert.NoError(t, repo.RevokeRefreshToken(first), "Expected no error from RevokeRefreshToken")
+	_, _, err = repo.RotateRefreshToken(first)
+	assert.ErrorIs(t, err, token.ErrTokenRevoked, "Expected the logged out token to be revoked")
+	_, second, err = repo.RotateRefreshToken(second)
+	assert.NoError(t, err, "Expected other logins to stay")
+
+	assert.NoError(t, repo.RevokeAllTokens("rotation_user"), "Expected no error from RevokeAllTokens")
+	_, _, err = repo.RotateRefreshToken(second)
+	assert.ErrorIs(t, err, token.ErrTokenRevoked, "Expected every login to be revoked")
+	_, _, err = repo.RotateRefreshToken(third)
+	assert.ErrorIs(t, err, token.ErrTokenRevoked, "Expected every login to be revoked")
+
+	_, _, err = repo.RotateRefreshToken("not a token")
+	assert.ErrorIs(t, err, token.ErrInvalidToken, "Expected a malformed token to be invalid")
+}
+
+func TestAccessTokenDenylist(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+	createUser(t, db, "denylist_user")
+	denylist := token.NewDenylist(rdb)
+
+	accessToken, _, err := repo.GenerateTokens("denylist_user")
+	if !assert.NoError(t, err, "Expected no error from GenerateTokens") {
+		return
+	}
+	otherToken, _, err := repo.GenerateTokens("denylist_user")
+	assert.NoError(t, err, "Expected no error from GenerateTokens")
+
+	claims, err := token.ParseAccessToken(accessToken)
+	assert.NoError(t, err, "Expected a valid access token")
+	assert.NotEmpty(t, claims.Id, "Expected the access token to have an id")
+	assert.NoError(t, denylist.Check(claims.StandardClaims, claims.Generation), "Expected a new token not to be revoked")
+
+	// Revoking one token leaves the others
+	assert.NoError(t, repo.RevokeAccessToken(accessToken), "Expected no error from RevokeAccessToken")
+	assert.ErrorIs(t, denylist.Check(claims.StandardClaims, claims.Generation), token.ErrTokenRevoked, "Expected the token to be revoked")
+	otherClaims, err := token.ParseAccessToken(otherToken)
+	assert.NoError(t, err, "Expected a valid access token")
+	assert.NoError(t, denylist.Check(otherClaims.StandardClaims, otherClaims.Generation), "Expected another token not to be revoked")
+
+	// Revoking the tokens of the user leaves the tokens issued right after,
+	// within the same second
+	assert.NoError(t, denylist.DenyUserTokens("denylist_user"), "Expected no error from DenyUserTokens")
+	assert.ErrorIs(t, denylist.Check(otherClaims.StandardClaims, otherClaims.Generation), token.ErrTokenRevoked, "Expected the tokens of the user to be revoked")
+
+	laterToken, laterRefreshToken, err := repo.GenerateTokens("denylist_user")
+	assert.NoError(t, err, "Expected no error from GenerateTokens")
+	laterClaims, err := token.ParseAccessToken(laterToken)
+	assert.NoError(t, err, "Expected a valid access token")
+	assert.NoError(t, denylist.Check(laterClaims.StandardClaims, laterClaims.Generation), "Expected a later token not to be revoked")
+	_, _, err = repo.RotateRefreshToken(laterRefreshToken)
+	assert.NoError(t, err, "Expected a later refresh token not to be revoked")
+
+	// Logging out everywhere and back in at once works too
+	assert.NoError(t, repo.RevokeAllTokens("denylist_user"), "Expected no error from RevokeAllTokens")
+	loginToken, _, err := repo.GenerateTokens("denylist_user")
+	assert.NoError(t, err, "Expected no error from GenerateTokens")
+	loginClaims, err := token.ParseAccessToken(loginToken)
+	assert.NoError(t, err, "Expected a valid access token")
+	assert.NoError(t, denylist.Check(loginClaims.StandardClaims, loginClaims.Generation), "Expected a token issued right after the logout not to be revoked")
+	assert.ErrorIs(t, denylist.Check(laterClaims.StandardClaims, laterClaims.Generation), token.ErrTokenRevoked, "Expected the tokens before the logout to be revoked")
+}
+
+func TestTokenKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err, "Failed to generate RSA key")
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	assert.NoError(t, err, "Failed to marshal RSA key")
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err, "Failed to generate Ed25519 key")
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	assert.NoError(t, err, "Failed to marshal Ed25519 key")
+	edPublicDER, err := x509.MarshalPKIXPublicKey(edKey.Public())
+	assert.NoError(t, err, "Failed to marshal Ed25519 public key")
+
+	rsaPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaDER}))
+	edPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}))
+	edPublicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: edPublicDER}))
+	t.Setenv("TEST_ED25519_KEY", edPEM)
+	defer func() {
+		keys, _ := token.LoadKeys(models.TokenKeysConfig{
+			SigningKey: "test",
+			Keys:       []models.TokenKeyConfig{{Id: "test", Algorithm: token.AlgorithmHS256, Secret: "test-secret"}},
+		})
+		token.SetKeys(keys)
+	}()
+
+	// Tokens are signed with RS256 while the Ed25519 key is rolled out
+	keys, err := token.LoadKeys(models.TokenKeysConfig{
+		SigningKey: "rsa-1",
+		Keys: []models.TokenKeyConfig{
+			{Id: "rsa-1", Algorithm: token.AlgorithmRS256, PrivateKey: rsaPEM},
+			{Id: "ed-2", Algorithm: token.AlgorithmEdDSA, PublicKey: edPublicPEM},
+		},
+	})
+	if !assert.NoError(t, err, "Expected no error from LoadKeys") {
+		return
+	}
+	token.SetKeys(keys)
+	rsaToken, err := token.GenerateAccessToken(token.Identity{UserId: 1, Username: "keys_user"}, 0)
+	assert.NoError(t, err, "Expected no error from GenerateAccessToken")
+
+	jwks, err := token.JWKS()
+	assert.NoError(t, err, "Expected no error from JWKS")
+	if assert.Len(t, jwks.Keys, 2, "Expected both public keys") {
+		assert.Equal(t, models.JWK{Kty: "OKP", Kid: "ed-2", Alg: "EdDSA", Use: "sig", Crv: "Ed25519", X: jwks.Keys[0].X}, jwks.Keys[0], "Expected the Ed25519 key")
+		assert.Equal(t, "RSA", jwks.Keys[1].Kty, "Expected the RSA key")
+		assert.Equal(t, "AQAB", jwks.Keys[1].E, "Expected the RSA exponent")
+	}
+
+	// Switching to the Ed25519 key keeps the RS256 tokens valid
+	keys, err = token.LoadKeys(models.TokenKeysConfig{
+		SigningKey: "ed-2",
+		Keys: []models.TokenKeyConfig{
+			{Id: "rsa-1", Algorithm: token.AlgorithmRS256, PrivateKey: rsaPEM},
+			{Id: "ed-2", Algorithm: token.AlgorithmEdDSA, PrivateKey: "env:TEST_ED25519_KEY"},
+		},
+	})
+	if !assert.NoError(t, err, "Expected no error from LoadKeys") {
+		return
+	}
+	token.SetKeys(keys)
+	edToken, err := token.GenerateAccessToken(token.Identity{UserId: 1, Username: "keys_user"}, 0)
+	assert.NoError(t, err, "Expected no error from GenerateAccessToken")
+
+	for _, signed := range []string{rsaToken, edToken} {
+		identity, err := token.VerifyToken(signed)
+		assert.NoError(t, err, "Expected the token to be verified")
+		assert.Equal(t, "keys_user", identity.Username, "Expected the user of the token")
+	}
+
+	// Retiring the RSA key invalidates its tokens
+	keys, err = token.LoadKeys(models.TokenKeysConfig{
+		SigningKey: "ed-2",
+		Keys:       []models.TokenKeyConfig{{Id: "ed-2", Algorithm: token.AlgorithmEdDSA, PrivateKey: "env:TEST_ED25519_KEY"}},
+	})
+	assert.NoError(t, err, "Expected no error from LoadKeys")
+	token.SetKeys(keys)
+	_, err = token.VerifyToken(rsaToken)
+	assert.ErrorIs(t, err, token.ErrInvalidToken, "Expected a token of a retired key to be invalid")
+
+	_, err = token.LoadKeys(models.TokenKeysConfig{
+		SigningKey: "ed-2",
+		Keys:       []models.TokenKeyConfig{{Id: "ed-2", Algorithm: token.AlgorithmEdDSA, PublicKey: edPublicPEM}},
+	})
+	assert.Error(t, err, "Expected a signing key without a private key to be rejected")
+	_, err = token.LoadKeys(models.TokenKeysConfig{
+		Keys: []models.TokenKeyConfig{{Id: "rsa-1", Algorithm: token.AlgorithmEdDSA, PrivateKey: rsaPEM}},
+	})
+	assert.Error(t, err, "Expected a key of another algorithm to be rejected")
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+	identity := token.Identity{
+		UserId:   42,
+		Username: "claims_user",
+		Roles:    []string{token.RoleUser},
+		Scopes:   token.ScopesForRoles([]string{token.RoleUser}),
+	}
+	assert.Equal(t, []string{token.ScopeProfile, token.ScopeProjects, token.ScopeTasks, token.ScopeWebhooks}, identity.Scopes, "Expected the scopes of the role, sorted")
+	assert.Empty(t, token.ScopesForRoles([]string{"unknown"}), "Expected no scopes for an unknown role")
+
+	accessToken, err := token.GenerateAccessToken(identity, 0)
+	if !assert.NoError(t, err, "Expected no error from GenerateAccessToken") {
+		return
+	}
+
+	verified, err := token.VerifyToken(accessToken)
+	assert.NoError(t, err, "Expected no error from VerifyToken")
+	assert.Equal(t, identity, verified, "Expected the identity of the claims")
+	assert.True(t, verified.HasRole(token.RoleUser), "Expected the role of the user")
+	assert.True(t, verified.HasScope(token.ScopeTasks), "Expected the tasks scope")
+	assert.False(t, verified.HasScope("admin"), "Expected no scope that was not granted")
+
+	refreshToken, _, err := token.GenerateRefreshToken("claims_user", "", 0)
+	assert.NoError(t, err, "Expected no error from GenerateRefreshToken")
+	_, err = token.VerifyToken(refreshToken)
+	assert.ErrorIs(t, err, token.ErrInvalidToken, "Expected a refresh token not to be an access token")
+}
+
+func TestUserRoles(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+	createUser(t, db, "roles_user")
+
+	var userID int64
+	if err := db.QueryRow("SELECT id FROM users WHERE username = ?", "roles_user").Scan(&userID); !assert.NoError(t, err, "Failed to get the user") {
+		return
+	}
+	_, err = db.Exec("INSERT IGNORE INTO user_roles (user_id, role) VALUES (?, 'admin')", userID)
+	assert.NoError(t, err, "Failed to grant the admin role")
+	defer db.Exec("DELETE FROM user_roles WHERE user_id = ?", userID)
+
+	// Granted roles and their scopes are in the claims
+	accessToken, refreshToken, err := repo.GenerateTokens("roles_user")
+	if !assert.NoError(t, err, "Expected no error from GenerateTokens") {
+		return
+	}
+	identity, err := token.VerifyToken(accessToken)
+	assert.NoError(t, err, "Expected a valid access token")
+	assert.Equal(t, userID, identity.UserId, "Expected the id of the user")
+	assert.Equal(t, []string{token.RoleUser, token.RoleAdmin}, identity.Roles, "Expected the granted roles")
+	assert.True(t, identity.HasScope(token.ScopeAdmin), "Expected the admin scope")
+
+	// Disabled users get no tokens
+	_, err = db.Exec("UPDATE users SET disabled = TRUE WHERE id = ?", userID)
+	assert.NoError(t, err, "Failed to disable the user")
+	defer db.Exec("UPDATE users SET disabled = FALSE WHERE id = ?", userID)
+
+	_, _, err = repo.GenerateTokens("roles_user")
+	assert.ErrorIs(t, err, repository.ErrAccountDisabled, "Expected a disabled user to get no tokens")
+	_, _, err = repo.RotateRefreshToken(refreshToken)
+	assert.ErrorIs(t, err, repository.ErrAccountDisabled, "Expected a disabled user not to refresh tokens")
+}
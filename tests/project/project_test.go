@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/damirbeybitov/todo_project/internal/models"
+	"github.com/damirbeybitov/todo_project/internal/project/repository"
+	taskRepository "github.com/damirbeybitov/todo_project/internal/task/repository"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjects(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repositories
+	repo := repository.NewRepository(db, rdb)
+	taskRepo := taskRepository.NewRepository(db, rdb)
+
+	projectID, err := repo.CreateProject(models.Project{Name: "Home", Description: "Chores", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateProject")
+
+	// Another user cannot see the project
+	_, err = repo.GetProjectByID(projectID, 2)
+	assert.ErrorIs(t, err, repository.ErrProjectNotFound, "Expected ErrProjectNotFound for another user's project")
+
+	// The project shows up in the cached project list after an update
+	project, err := repo.UpdateProject(models.Project{Id: projectID, Name: "House", Description: "Chores", UserId: 1})
+	assert.NoError(t, err, "Expected no error from UpdateProject")
+	assert.Equal(t, "House", project.Name, "Expected the project name to be updated")
+
+	projects, err := repo.GetProjects(1)
+	assert.NoError(t, err, "Expected no error from GetProjects")
+	assert.Contains(t, projects, project, "Expected the updated project in the list")
+
+	// Tasks can only be added to the user's own projects
+	_, err = taskRepo.CreateTask(models.Task{Title: "Foreign Task", Description: "Wrong project", UserId: 2, ProjectId: projectID})
+	assert.ErrorIs(t, err, taskRepository.ErrInvalidProject, "Expected ErrInvalidProject for another user's project")
+
+	taskID, err := taskRepo.CreateTask(models.Task{Title: "Project Task", Description: "In a project", UserId: 1, ProjectId: projectID})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	tasks, _, err := taskRepo.GetTasks(1, models.TaskFilter{ProjectId: projectID})
+	assert.NoError(t, err, "Expected no error from GetTasks")
+	assert.Len(t, tasks, 1, "Expected one task in the project")
+
+	// Deleting the project keeps its tasks outside of projects
+	err = repo.DeleteProject(projectID, 1)
+	assert.NoError(t, err, "Expected no error from DeleteProject")
+
+	task, err := taskRepo.GetTaskByID(taskID, 1)
+	assert.NoError(t, err, "Expected the task to survive the project")
+	assert.Zero(t, task.ProjectId, "Expected the task to leave the deleted project")
+
+	tasks, _, err = taskRepo.GetTasks(1, models.TaskFilter{ProjectId: projectID})
+	assert.NoError(t, err, "Expected no error from GetTasks")
+	assert.Empty(t, tasks, "Expected no tasks in the deleted project")
+}
+
+func TestProjectMembers(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repositories
+	repo := repository.NewRepository(db, rdb)
+	taskRepo := taskRepository.NewRepository(db, rdb)
+
+	projectID, err := repo.CreateProject(models.Project{Name: "Team", Description: "Shared", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateProject")
+	taskID, err := taskRepo.CreateTask(models.Task{Title: "Shared Task", Description: "Seen by the team", UserId: 1, ProjectId: projectID})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	// Only owners manage members
+	_, err = repo.AddProjectMember(projectID, 2, 2, models.RoleOwner)
+	assert.ErrorIs(t, err, repository.ErrProjectNotFound, "Expected ErrProjectNotFound for a non-member")
+
+	member, err := repo.AddProjectMember(projectID, 1, 2, models.RoleViewer)
+	assert.NoError(t, err, "Expected no error from AddProjectMember")
+	assert.Equal(t, models.RoleViewer, member.Role, "Expected the member to be a viewer")
+
+	// Viewers read the project tasks but cannot change them
+	task, err := taskRepo.GetTaskByID(taskID, 2)
+	assert.NoError(t, err, "Expected the viewer to read the task")
+	task.UserId = 2
+	_, err = taskRepo.UpdateTask(task, task.Status)
+	assert.ErrorIs(t, err, taskRepository.ErrForbidden, "Expected ErrForbidden for a viewer")
+
+	// Editors can change them
+	_, err = repo.AddProjectMember(projectID, 1, 2, models.RoleEditor)
+	assert.NoError(t, err, "Expected no error from AddProjectMember")
+	task.Title = "Edited Shared Task"
+	updated, err := taskRepo.UpdateTask(task, task.Status)
+	assert.NoError(t, err, "Expected the editor to update the task")
+	assert.Equal(t, int64(1), updated.UserId, "Expected the task to keep its creator")
+
+	// The only owner cannot leave
+	err = repo.RemoveProjectMember(projectID, 1, 1)
+	assert.ErrorIs(t, err, repository.ErrLastOwner, "Expected ErrLastOwner for the only owner")
+
+	members, err := repo.GetProjectMembers(projectID, 2)
+	assert.NoError(t, err, "Expected no error from GetProjectMembers")
+	assert.Len(t, members, 2, "Expected two members")
+
+	// Removed members lose access to the project tasks
+	err = repo.RemoveProjectMember(projectID, 1, 2)
+	assert.NoError(t, err, "Expected no error from RemoveProjectMember")
+	_, err = taskRepo.GetTaskByID(taskID, 2)
+	assert.ErrorIs(t, err, taskRepository.ErrTaskNotFound, "Expected ErrTaskNotFound after removal")
+}
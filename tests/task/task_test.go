@@ -5,10 +5,16 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/damirbeybitov/todo_project/internal/models"
 	"github.com/damirbeybitov/todo_project/internal/task/repository"
+	task "github.com/damirbeybitov/todo_project/internal/task/service"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -16,7 +22,7 @@ import (
 
 func TestCreateTask(t *testing.T) {
 	// Setup the database connection
-	dsn := "root:root@tcp(localhost:3306)/to_do"
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		t.Fatalf("Failed to connect to the database: %v", err)
@@ -42,7 +48,7 @@ func TestCreateTask(t *testing.T) {
 	task := models.Task{
 		Title:       "Test Task",
 		Description: "This is a test task",
-		Status:      true,
+		Status:      models.StatusDone,
 		UserId:      1,
 	}
 
@@ -74,21 +80,15 @@ func TestCreateTask(t *testing.T) {
 	assert.Equal(t, task.Status, cachedTask.Status, "Expected cached task status to match")
 	assert.Equal(t, task.UserId, cachedTask.UserId, "Expected cached task user ID to match")
 
-	// Verify the task list was updated in Redis
-	tasksKey := fmt.Sprintf("tasks:user:%d", task.UserId)
-	tasksJSON, err := rdb.Get(context.Background(), tasksKey).Result()
-	assert.NoError(t, err, "Expected no error when getting the task list from Redis")
-
-	var tasks []models.Task
-	err = json.Unmarshal([]byte(tasksJSON), &tasks)
-	assert.NoError(t, err, "Expected no error when unmarshaling the task list")
-	assert.Len(t, tasks, 1, "Expected the task list to contain one task")
-	assert.Equal(t, taskID, tasks[0].Id, "Expected the task list to contain the correct task ID")
+	// Verify the task lists cache of the user was invalidated
+	generation, err := rdb.Get(context.Background(), fmt.Sprintf("tasks:user:%d:gen", task.UserId)).Int64()
+	assert.NoError(t, err, "Expected no error when getting the task lists generation from Redis")
+	assert.Equal(t, int64(1), generation, "Expected the task lists generation to be bumped")
 }
 
 func TestGetTaskByID(t *testing.T) {
 	// Setup the database connection
-	dsn := "root:root@tcp(localhost:3306)/to_do"
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
 	db, err := sql.Open("mysql", dsn)
 	assert.NoError(t, err, "Failed to connect to the database")
 	defer db.Close()
@@ -107,15 +107,23 @@ func TestGetTaskByID(t *testing.T) {
 	repo := repository.NewRepository(db, rdb)
 
 	// Create a task to retrieve
+	now := time.Now().UTC().Truncate(time.Second)
+	dueAt := now.Add(24 * time.Hour)
 	task := models.Task{
 		Title:       "Test Task",
 		Description: "This is a test task",
-		Status:      true,
+		Status:      models.StatusDone,
 		UserId:      1,
+		DueAt:       &dueAt,
+		Priority:    models.PriorityHigh,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Version:     1,
 	}
 
 	// Insert the task into the database directly for testing
-	result, err := db.Exec("INSERT INTO tasks (title, description, status, user_id) VALUES (?, ?, ?, ?)", task.Title, task.Description, task.Status, task.UserId)
+	result, err := db.Exec("INSERT INTO tasks (title, description, status, user_id, due_at, priority, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		task.Title, task.Description, task.Status, task.UserId, task.DueAt, task.Priority, task.CreatedAt, task.UpdatedAt)
 	assert.NoError(t, err, "Failed to insert task into the database")
 
 	taskID, err := result.LastInsertId()
@@ -123,7 +131,7 @@ func TestGetTaskByID(t *testing.T) {
 	task.Id = taskID
 
 	// Test retrieval from the database when cache is empty
-	retrievedTask, err := repo.GetTaskByID(taskID)
+	retrievedTask, err := repo.GetTaskByID(taskID, task.UserId)
 	assert.NoError(t, err, "Expected no error from GetTaskByID")
 	assert.Equal(t, task, retrievedTask, "Expected retrieved task to match the inserted task")
 
@@ -138,14 +146,18 @@ func TestGetTaskByID(t *testing.T) {
 	assert.Equal(t, task, cachedTask, "Expected cached task to match the inserted task")
 
 	// Test retrieval from the cache
-	retrievedTask, err = repo.GetTaskByID(taskID)
+	retrievedTask, err = repo.GetTaskByID(taskID, task.UserId)
 	assert.NoError(t, err, "Expected no error from GetTaskByID on cache hit")
 	assert.Equal(t, task, retrievedTask, "Expected retrieved task to match the cached task")
+
+	// Test that another user cannot read the task
+	_, err = repo.GetTaskByID(taskID, task.UserId+1)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for another user's task")
 }
 
 func TestGetTasks(t *testing.T) {
 	// Setup the database connection
-	dsn := "root:root@tcp(localhost:3306)/to_do"
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
 	db, err := sql.Open("mysql", dsn)
 	assert.NoError(t, err, "Failed to connect to the database")
 	defer db.Close()
@@ -165,8 +177,8 @@ func TestGetTasks(t *testing.T) {
 
 	// Create tasks to retrieve
 	tasks := []models.Task{
-		{Title: "Task 1", Description: "Description 1", Status: false, UserId: 1},
-		{Title: "Task 2", Description: "Description 2", Status: true, UserId: 1},
+		{Title: "Task 1", Description: "Description 1", Status: models.StatusTodo, UserId: 1},
+		{Title: "Task 2", Description: "Description 2", Status: models.StatusDone, UserId: 1},
 	}
 
 	// Insert the tasks into the database directly for testing
@@ -179,8 +191,9 @@ func TestGetTasks(t *testing.T) {
 	}
 
 	// Test retrieval from the database when cache is empty
-	retrievedTasks, err := repo.GetTasks(1)
+	retrievedTasks, nextPageToken, err := repo.GetTasks(1, models.TaskFilter{})
 	assert.NoError(t, err, "Expected no error from GetTasks")
+	assert.Empty(t, nextPageToken, "Expected no next page")
 	assert.Len(t, retrievedTasks, len(tasks), "Expected number of retrieved tasks to match the inserted tasks")
 	for i, task := range tasks {
 		assert.Equal(t, task.Title, retrievedTasks[i].Title, "Expected task title to match")
@@ -189,18 +202,13 @@ func TestGetTasks(t *testing.T) {
 		assert.Equal(t, task.UserId, retrievedTasks[i].UserId, "Expected task user ID to match")
 	}
 
-	// Verify the tasks were cached in Redis
-	tasksKey := fmt.Sprintf("tasks:user:%d", 1)
-	tasksJSON, err := rdb.Get(context.Background(), tasksKey).Result()
-	assert.NoError(t, err, "Expected no error when getting the tasks from Redis")
-
-	var cachedTasks []models.Task
-	err = json.Unmarshal([]byte(tasksJSON), &cachedTasks)
-	assert.NoError(t, err, "Expected no error when unmarshaling the cached tasks")
-	assert.Len(t, cachedTasks, len(tasks), "Expected number of cached tasks to match the inserted tasks")
+	// Verify the page was cached in Redis
+	keys, err := rdb.Keys(context.Background(), "tasks:user:1:0:*").Result()
+	assert.NoError(t, err, "Expected no error when listing the cached pages in Redis")
+	assert.Len(t, keys, 1, "Expected one cached page")
 
 	// Test retrieval from the cache
-	retrievedTasks, err = repo.GetTasks(1)
+	retrievedTasks, _, err = repo.GetTasks(1, models.TaskFilter{})
 	assert.NoError(t, err, "Expected no error from GetTasks on cache hit")
 	assert.Len(t, retrievedTasks, len(tasks), "Expected number of retrieved tasks to match the cached tasks")
 	for i, task := range tasks {
@@ -209,13 +217,63 @@ func TestGetTasks(t *testing.T) {
 		assert.Equal(t, task.Status, retrievedTasks[i].Status, "Expected task status to match")
 		assert.Equal(t, task.UserId, retrievedTasks[i].UserId, "Expected task user ID to match")
 	}
-}
-
 
+	// Test pagination
+	retrievedTasks, nextPageToken, err = repo.GetTasks(1, models.TaskFilter{PageSize: 1})
+	assert.NoError(t, err, "Expected no error from GetTasks with page size")
+	assert.Len(t, retrievedTasks, 1, "Expected one task on the first page")
+	assert.NotEmpty(t, nextPageToken, "Expected a next page token")
+
+	retrievedTasks, nextPageToken, err = repo.GetTasks(1, models.TaskFilter{PageSize: 1, PageToken: nextPageToken})
+	assert.NoError(t, err, "Expected no error from GetTasks with page token")
+	assert.Len(t, retrievedTasks, 1, "Expected one task on the second page")
+	assert.Equal(t, tasks[1].Title, retrievedTasks[0].Title, "Expected the second task on the second page")
+	assert.Empty(t, nextPageToken, "Expected no next page")
+
+	// Test filtering and sorting
+	retrievedTasks, _, err = repo.GetTasks(1, models.TaskFilter{Status: models.StatusDone})
+	assert.NoError(t, err, "Expected no error from GetTasks with status filter")
+	assert.Len(t, retrievedTasks, 1, "Expected one done task")
+	assert.Equal(t, tasks[1].Title, retrievedTasks[0].Title, "Expected the done task")
+
+	retrievedTasks, _, err = repo.GetTasks(1, models.TaskFilter{Query: "Description 1"})
+	assert.NoError(t, err, "Expected no error from GetTasks with query")
+	assert.Len(t, retrievedTasks, 1, "Expected one matching task")
+	assert.Equal(t, tasks[0].Title, retrievedTasks[0].Title, "Expected the matching task")
+
+	retrievedTasks, _, err = repo.GetTasks(1, models.TaskFilter{SortBy: "title", SortDesc: true})
+	assert.NoError(t, err, "Expected no error from GetTasks with sort")
+	assert.Equal(t, tasks[1].Title, retrievedTasks[0].Title, "Expected tasks sorted by title descending")
+
+	// Test invalid filters
+	_, _, err = repo.GetTasks(1, models.TaskFilter{SortBy: "password"})
+	assert.ErrorIs(t, err, repository.ErrInvalidFilter, "Expected ErrInvalidFilter for unknown sort field")
+	_, _, err = repo.GetTasks(1, models.TaskFilter{PageToken: "???"})
+	assert.ErrorIs(t, err, repository.ErrInvalidFilter, "Expected ErrInvalidFilter for malformed page token")
+
+	// A page token only continues the sort order it was issued for
+	_, nextPageToken, err = repo.GetTasks(1, models.TaskFilter{PageSize: 1, SortBy: "status"})
+	assert.NoError(t, err, "Expected no error from GetTasks sorted by status")
+	_, _, err = repo.GetTasks(1, models.TaskFilter{PageSize: 1, SortBy: "title", PageToken: nextPageToken})
+	assert.ErrorIs(t, err, repository.ErrInvalidFilter, "Expected ErrInvalidFilter for a page token of another sort order")
+
+	// Tasks deleted between pages do not shift the next page
+	retrievedTasks, nextPageToken, err = repo.GetTasks(1, models.TaskFilter{PageSize: 1, SortBy: "status"})
+	assert.NoError(t, err, "Expected no error from GetTasks sorted by status")
+	assert.Equal(t, tasks[0].Title, retrievedTasks[0].Title, "Expected the todo task on the first page")
+	_, err = db.Exec("DELETE FROM tasks WHERE user_id = 1 AND title = ?", tasks[0].Title)
+	assert.NoError(t, err, "Failed to delete the task")
+
+	retrievedTasks, _, err = repo.GetTasks(1, models.TaskFilter{PageSize: 1, SortBy: "status", PageToken: nextPageToken})
+	assert.NoError(t, err, "Expected no error from GetTasks with page token")
+	if assert.Len(t, retrievedTasks, 1, "Expected one task on the second page") {
+		assert.Equal(t, tasks[1].Title, retrievedTasks[0].Title, "Expected the done task on the second page")
+	}
+}
 
 func TestUpdateTask(t *testing.T) {
 	// Setup the database connection
-	dsn := "root:root@tcp(localhost:3306)/to_do"
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
 	db, err := sql.Open("mysql", dsn)
 	assert.NoError(t, err, "Failed to connect to the database")
 	defer db.Close()
@@ -237,7 +295,7 @@ func TestUpdateTask(t *testing.T) {
 	task := models.Task{
 		Title:       "Original Task",
 		Description: "This is the original task",
-		Status:      false,
+		Status:      models.StatusTodo,
 		UserId:      1,
 	}
 
@@ -255,26 +313,26 @@ func TestUpdateTask(t *testing.T) {
 	err = rdb.Set(context.Background(), taskKey, taskJSON, 0).Err()
 	assert.NoError(t, err, "Failed to set task in Redis")
 
-	// Create a list of tasks and cache it
-	tasks := []models.Task{task}
-	tasksKey := fmt.Sprintf("tasks:user:%d", task.UserId)
-	tasksJSON, err := json.Marshal(tasks)
-	assert.NoError(t, err, "Failed to marshal tasks for caching")
-	err = rdb.Set(context.Background(), tasksKey, tasksJSON, 0).Err()
-	assert.NoError(t, err, "Failed to set tasks in Redis")
+	// Cache the list of tasks
+	filter := models.TaskFilter{Query: task.Title}
+	_, _, err = repo.GetTasks(task.UserId, filter)
+	assert.NoError(t, err, "Failed to cache the tasks list")
 
 	// Update the task
 	updatedTask := models.Task{
 		Id:          taskID,
 		Title:       "Updated Task",
 		Description: "This is the updated task",
-		Status:      true,
+		Status:      models.StatusDone,
 		UserId:      1,
 	}
 
 	// Call the function to test
-	err = repo.UpdateTask(updatedTask)
+	storedTask, err := repo.UpdateTask(updatedTask, models.StatusTodo)
 	assert.NoError(t, err, "Expected no error from UpdateTask")
+	assert.Equal(t, updatedTask.Title, storedTask.Title, "Expected the returned task title to be updated")
+	assert.Equal(t, models.PriorityMedium, storedTask.Priority, "Expected the default priority")
+	assert.False(t, storedTask.UpdatedAt.IsZero(), "Expected the update time to be set")
 
 	// Verify the task was updated in the database
 	var retrievedTask models.Task
@@ -298,24 +356,27 @@ func TestUpdateTask(t *testing.T) {
 	assert.Equal(t, updatedTask.Status, cachedTask.Status, "Expected cached task status to be updated")
 	assert.Equal(t, updatedTask.UserId, cachedTask.UserId, "Expected cached task user ID to remain the same")
 
-	// Verify the task list was updated in Redis
-	tasksJSON, err = rdb.Get(context.Background(), tasksKey).Bytes()
-	assert.NoError(t, err, "Expected no error when getting the tasks list from Redis")
-
-	var cachedTasks []models.Task
-	err = json.Unmarshal([]byte(tasksJSON), &cachedTasks)
-	assert.NoError(t, err, "Expected no error when unmarshaling the cached tasks")
-	assert.Len(t, cachedTasks, 1, "Expected the tasks list to contain one task")
-	assert.Equal(t, updatedTask.Id, cachedTasks[0].Id, "Expected the task ID to match")
-	assert.Equal(t, updatedTask.Title, cachedTasks[0].Title, "Expected the cached task title to be updated")
-	assert.Equal(t, updatedTask.Description, cachedTasks[0].Description, "Expected the cached task description to be updated")
-	assert.Equal(t, updatedTask.Status, cachedTasks[0].Status, "Expected the cached task status to be updated")
-	assert.Equal(t, updatedTask.UserId, cachedTasks[0].UserId, "Expected the cached task user ID to remain the same")
+	// Verify the cached task list does not return the stale task
+	cachedTasks, _, err := repo.GetTasks(task.UserId, models.TaskFilter{Query: updatedTask.Title})
+	assert.NoError(t, err, "Expected no error when getting the tasks list")
+	assert.NotEmpty(t, cachedTasks, "Expected the tasks list to contain the updated task")
+	for _, cachedTask := range cachedTasks {
+		if cachedTask.Id == updatedTask.Id {
+			assert.Equal(t, updatedTask.Title, cachedTask.Title, "Expected the task title to be updated")
+			assert.Equal(t, updatedTask.Description, cachedTask.Description, "Expected the task description to be updated")
+			assert.Equal(t, updatedTask.Status, cachedTask.Status, "Expected the task status to be updated")
+		}
+	}
+
+	// A status change read before a concurrent transition is not written over it
+	updatedTask.Status = models.StatusInProgress
+	_, err = repo.UpdateTask(updatedTask, models.StatusTodo)
+	assert.ErrorIs(t, err, repository.ErrStatusChanged, "Expected ErrStatusChanged for a stale status")
 }
 
 func TestDeleteTask(t *testing.T) {
 	// Setup the database connection
-	dsn := "root:root@tcp(localhost:3306)/to_do"
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
 	db, err := sql.Open("mysql", dsn)
 	assert.NoError(t, err, "Failed to connect to the database")
 	defer db.Close()
@@ -337,7 +398,7 @@ func TestDeleteTask(t *testing.T) {
 	task := models.Task{
 		Title:       "Task to Delete",
 		Description: "This task will be deleted",
-		Status:      true,
+		Status:      models.StatusDone,
 		UserId:      1,
 	}
 
@@ -355,43 +416,42 @@ func TestDeleteTask(t *testing.T) {
 	err = rdb.Set(context.Background(), taskKey, taskJSON, 0).Err()
 	assert.NoError(t, err, "Failed to set task in Redis")
 
-	// Create a list of tasks and cache it
-	tasks := []models.Task{task}
-	tasksKey := fmt.Sprintf("tasks:user:%d", task.UserId)
-	tasksJSON, err := json.Marshal(tasks)
-	assert.NoError(t, err, "Failed to marshal tasks for caching")
-	err = rdb.Set(context.Background(), tasksKey, tasksJSON, 0).Err()
-	assert.NoError(t, err, "Failed to set tasks in Redis")
+	// Cache the list of tasks
+	filter := models.TaskFilter{Query: task.Title}
+	_, _, err = repo.GetTasks(task.UserId, filter)
+	assert.NoError(t, err, "Failed to cache the tasks list")
+
+	// Test that another user cannot delete the task
+	err = repo.DeleteTask(taskID, task.UserId+1, false)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for another user's task")
 
 	// Call the function to test
-	err = repo.DeleteTask(taskID)
+	err = repo.DeleteTask(taskID, task.UserId, false)
 	assert.NoError(t, err, "Expected no error from DeleteTask")
 
-	// Verify the task was deleted from the database
+	// Verify the task was moved to the trash in the database
 	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM tasks WHERE id = ?", taskID).Scan(&count)
+	err = db.QueryRow("SELECT COUNT(*) FROM tasks WHERE id = ? AND deleted_at IS NULL", taskID).Scan(&count)
 	assert.NoError(t, err, "Expected no error when querying the task from the database")
-	assert.Equal(t, 0, count, "Expected the task to be deleted from the database")
+	assert.Equal(t, 0, count, "Expected the task to be moved to the trash")
 
 	// Verify the task was deleted from Redis
 	taskJSON, err = rdb.Get(context.Background(), taskKey).Bytes()
 	assert.Error(t, err, "Expected an error when getting the task from Redis")
 	assert.Equal(t, redis.Nil, err, "Expected redis.Nil error when getting the task from Redis")
 
-	// Verify the task list was updated in Redis
-	tasksJSON, err = rdb.Get(context.Background(), tasksKey).Bytes()
-	assert.NoError(t, err, "Expected no error when getting the tasks list from Redis")
-
-	var cachedTasks []models.Task
-	err = json.Unmarshal([]byte(tasksJSON), &cachedTasks)
-	assert.NoError(t, err, "Expected no error when unmarshaling the cached tasks")
-	assert.Len(t, cachedTasks, 0, "Expected the tasks list to be empty after deletion")
+	// Verify the cached task list does not return the deleted task
+	cachedTasks, _, err := repo.GetTasks(task.UserId, filter)
+	assert.NoError(t, err, "Expected no error when getting the tasks list")
+	for _, cachedTask := range cachedTasks {
+		assert.NotEqual(t, taskID, cachedTask.Id, "Expected the deleted task to be gone from the tasks list")
+	}
 }
 
 
 func TestGetUserIdWithUsername(t *testing.T) {
 	// Setup the database connection
-	dsn := "root:root@tcp(localhost:3306)/to_do"
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
 	db, err := sql.Open("mysql", dsn)
 	assert.NoError(t, err, "Failed to connect to the database")
 	defer db.Close()
@@ -420,4 +480,913 @@ func TestGetUserIdWithUsername(t *testing.T) {
 	userID, err = repo.GetUserIdWithUsername(nonExistentUsername)
 	assert.Error(t, err, "Expected an error when querying a non-existing user")
 	assert.Zero(t, userID, "Expected user ID to be zero for non-existing user")
-}
\ No newline at end of file
+}
+
+func TestGetOverdueTasks(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, nil)
+
+	// Insert tasks with different due dates directly for testing
+	now := time.Now().UTC().Truncate(time.Second)
+	userID := int64(2)
+	dueDates := map[string]time.Time{
+		"Overdue Task":  now.Add(-time.Hour),
+		"Due Soon Task": now.Add(time.Hour),
+		"Later Task":    now.Add(72 * time.Hour),
+	}
+	for title, dueAt := range dueDates {
+		_, err := db.Exec("INSERT INTO tasks (title, description, status, user_id, due_at) VALUES (?, ?, ?, ?, ?)", title, "Deadline test", models.StatusTodo, userID, dueAt)
+		assert.NoError(t, err, "Failed to insert task into the database")
+	}
+
+	// Only the overdue task is returned without a window
+	tasks, err := repo.GetOverdueTasks(userID, now)
+	assert.NoError(t, err, "Expected no error from GetOverdueTasks")
+	for _, task := range tasks {
+		assert.True(t, task.DueAt.Before(now) || task.DueAt.Equal(now), "Expected only overdue tasks")
+		assert.NotContains(t, []string{models.StatusDone, models.StatusCancelled}, task.Status, "Expected only open tasks")
+	}
+
+	// The due soon task is returned with a window
+	tasks, err = repo.GetOverdueTasks(userID, now.Add(2*time.Hour))
+	assert.NoError(t, err, "Expected no error from GetOverdueTasks with a window")
+	var titles []string
+	for _, task := range tasks {
+		titles = append(titles, task.Title)
+	}
+	assert.Contains(t, titles, "Overdue Task", "Expected the overdue task")
+	assert.Contains(t, titles, "Due Soon Task", "Expected the task due soon")
+	assert.NotContains(t, titles, "Later Task", "Expected no task due later")
+}
+
+func TestTransitionTask(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	taskID, err := repo.CreateTask(models.Task{Title: "Workflow Task", Description: "Moves through statuses", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	// Move the task forward
+	task, err := repo.TransitionTask(taskID, 1, models.StatusTodo, models.StatusInProgress)
+	assert.NoError(t, err, "Expected no error from TransitionTask")
+	assert.Equal(t, models.StatusInProgress, task.Status, "Expected the task to be in progress")
+
+	// The cached task reflects the new status
+	cachedTask, err := repo.GetTaskByID(taskID, 1)
+	assert.NoError(t, err, "Expected no error from GetTaskByID")
+	assert.Equal(t, models.StatusInProgress, cachedTask.Status, "Expected the cached task to be in progress")
+
+	// A stale expected status is rejected
+	_, err = repo.TransitionTask(taskID, 1, models.StatusTodo, models.StatusDone)
+	assert.ErrorIs(t, err, repository.ErrStatusChanged, "Expected ErrStatusChanged for a stale status")
+}
+
+func TestSubtasks(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	rootID, err := repo.CreateTask(models.Task{Title: "Root Task", Description: "Has subtasks", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+	childID, err := repo.CreateTask(models.Task{Title: "Child Task", Description: "Subtask", UserId: 1, ParentId: rootID})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+	grandchildID, err := repo.CreateTask(models.Task{Title: "Grandchild Task", Description: "Nested subtask", UserId: 1, ParentId: childID})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	// A subtask cannot be attached to another user's task
+	_, err = repo.CreateTask(models.Task{Title: "Foreign Task", Description: "Wrong parent", UserId: 2, ParentId: rootID})
+	assert.ErrorIs(t, err, repository.ErrInvalidParent, "Expected ErrInvalidParent for another user's parent")
+
+	// List and cache the children of the root
+	children, err := repo.GetSubtasks(rootID, 1)
+	assert.NoError(t, err, "Expected no error from GetSubtasks")
+	assert.Len(t, children, 1, "Expected one subtask")
+	assert.Equal(t, childID, children[0].Id, "Expected the child task")
+
+	// A task cannot be moved under its own subtask
+	_, err = repo.MoveTask(rootID, 1, grandchildID)
+	assert.ErrorIs(t, err, repository.ErrInvalidParent, "Expected ErrInvalidParent for a cycle")
+
+	// Moving the grandchild under the root refreshes the cached children
+	moved, err := repo.MoveTask(grandchildID, 1, rootID)
+	assert.NoError(t, err, "Expected no error from MoveTask")
+	assert.Equal(t, rootID, moved.ParentId, "Expected the task to be moved under the root")
+
+	children, err = repo.GetSubtasks(rootID, 1)
+	assert.NoError(t, err, "Expected no error from GetSubtasks")
+	assert.Len(t, children, 2, "Expected two subtasks after the move")
+
+	// Deleting the child moves nothing, deleting the root with cascade removes the rest
+	err = repo.DeleteTask(childID, 1, false)
+	assert.NoError(t, err, "Expected no error from DeleteTask")
+	err = repo.DeleteTask(rootID, 1, true)
+	assert.NoError(t, err, "Expected no error from DeleteTask")
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM tasks WHERE id IN (?, ?, ?) AND deleted_at IS NULL", rootID, childID, grandchildID).Scan(&count)
+	assert.NoError(t, err, "Expected no error when querying the tasks from the database")
+	assert.Equal(t, 0, count, "Expected the whole hierarchy to be moved to the trash")
+
+	_, err = repo.GetTaskByID(grandchildID, 1)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected the cached subtask to be gone")
+}
+
+func TestAssignTask(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	taskID, err := repo.CreateTask(models.Task{Title: "Assigned Task", Description: "For a teammate", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	// Only users who may change the task can assign it
+	_, err = repo.AssignTask(taskID, 2, 2)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for another user's task")
+
+	task, err := repo.AssignTask(taskID, 1, 2)
+	assert.NoError(t, err, "Expected no error from AssignTask")
+	assert.Equal(t, int64(2), task.AssigneeId, "Expected the task to be assigned")
+
+	// The assignee sees the task in their assigned tasks
+	tasks, _, err := repo.GetTasks(2, models.TaskFilter{AssigneeId: 2})
+	assert.NoError(t, err, "Expected no error from GetTasks")
+	assert.Contains(t, tasks, task, "Expected the task among the assigned tasks")
+
+	// The assignee may change the status but not delete the task
+	_, err = repo.TransitionTask(taskID, 2, models.StatusTodo, models.StatusInProgress)
+	assert.NoError(t, err, "Expected the assignee to change the status")
+	err = repo.DeleteTask(taskID, 2, false)
+	assert.ErrorIs(t, err, repository.ErrForbidden, "Expected ErrForbidden for the assignee")
+
+	// Unassigned tasks are hidden from the former assignee
+	_, err = repo.AssignTask(taskID, 1, 0)
+	assert.NoError(t, err, "Expected no error from AssignTask")
+	_, err = repo.GetTaskByID(taskID, 2)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound after unassigning")
+}
+
+func TestTags(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	name := fmt.Sprintf("bug-%d", time.Now().UnixNano())
+	tag, err := repo.CreateTag(1, name)
+	assert.NoError(t, err, "Expected no error from CreateTag")
+
+	_, err = repo.CreateTag(1, name)
+	assert.ErrorIs(t, err, repository.ErrTagExists, "Expected ErrTagExists for a duplicate name")
+
+	taskID, err := repo.CreateTask(models.Task{Title: "Tagged Task", Description: "Has a tag", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	// Another user's tag cannot be attached
+	_, err = repo.AttachTag(taskID, tag.Id, 2)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for another user's task")
+
+	task, err := repo.AttachTag(taskID, tag.Id, 1)
+	assert.NoError(t, err, "Expected no error from AttachTag")
+	assert.Equal(t, []string{name}, task.Tags, "Expected the tag on the task")
+
+	// Filter by tag and cache the page
+	filter := models.TaskFilter{Tags: []string{name}}
+	tasks, _, err := repo.GetTasks(1, filter)
+	assert.NoError(t, err, "Expected no error from GetTasks")
+	assert.Len(t, tasks, 1, "Expected one tagged task")
+
+	// Renaming the tag refreshes the cached task and pages
+	_, err = repo.RenameTag(tag.Id, 1, name+"-renamed")
+	assert.NoError(t, err, "Expected no error from RenameTag")
+	cachedTask, err := repo.GetTaskByID(taskID, 1)
+	assert.NoError(t, err, "Expected no error from GetTaskByID")
+	assert.Equal(t, []string{name + "-renamed"}, cachedTask.Tags, "Expected the renamed tag on the task")
+
+	tasks, _, err = repo.GetTasks(1, filter)
+	assert.NoError(t, err, "Expected no error from GetTasks")
+	assert.Empty(t, tasks, "Expected no task with the old tag name")
+
+	// Deleting the tag takes it off the task
+	err = repo.DeleteTag(tag.Id, 1)
+	assert.NoError(t, err, "Expected no error from DeleteTag")
+	cachedTask, err = repo.GetTaskByID(taskID, 1)
+	assert.NoError(t, err, "Expected no error from GetTaskByID")
+	assert.Empty(t, cachedTask.Tags, "Expected no tags on the task")
+}
+
+func TestComments(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	taskID, err := repo.CreateTask(models.Task{Title: "Discussed Task", Description: "Has comments", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	comment, err := repo.AddComment(taskID, 1, "First comment")
+	assert.NoError(t, err, "Expected no error from AddComment")
+	assert.Equal(t, int64(1), comment.AuthorId, "Expected the caller to be the author")
+
+	// Only users who can see the task may comment on it
+	_, err = repo.AddComment(taskID, 2, "Not my task")
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for another user's task")
+
+	comments, err := repo.ListComments(taskID, 1)
+	assert.NoError(t, err, "Expected no error from ListComments")
+	assert.Len(t, comments, 1, "Expected one comment")
+
+	edited, err := repo.EditComment(comment.Id, taskID, 1, "Edited comment")
+	assert.NoError(t, err, "Expected no error from EditComment")
+	assert.Equal(t, "Edited comment", edited.Body, "Expected the new comment text")
+
+	// An assignee can read and comment, but not change someone else's comment
+	_, err = repo.AssignTask(taskID, 1, 2)
+	assert.NoError(t, err, "Expected no error from AssignTask")
+	_, err = repo.EditComment(comment.Id, taskID, 2, "Hijacked")
+	assert.ErrorIs(t, err, repository.ErrNotCommentAuthor, "Expected ErrNotCommentAuthor for another user")
+	err = repo.DeleteComment(comment.Id, taskID, 2)
+	assert.ErrorIs(t, err, repository.ErrNotCommentAuthor, "Expected ErrNotCommentAuthor for another user")
+
+	err = repo.DeleteComment(comment.Id, taskID, 1)
+	assert.NoError(t, err, "Expected no error from DeleteComment")
+	err = repo.DeleteComment(comment.Id, taskID, 1)
+	assert.ErrorIs(t, err, repository.ErrCommentNotFound, "Expected ErrCommentNotFound after deletion")
+}
+
+func TestRecurringTasks(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	dueAt := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	taskID, err := repo.CreateTask(models.Task{Title: "Weekly Chore", Description: "Take out the trash", UserId: 1, DueAt: &dueAt, Recurrence: "FREQ=WEEKLY"})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	// Running the scheduler twice, as after a restart, creates one occurrence
+	scheduler := task.NewScheduler(repo, time.Minute)
+	now := time.Now().UTC()
+	assert.NoError(t, scheduler.RunOnce(now), "Expected no error from the first run")
+	assert.NoError(t, scheduler.RunOnce(now), "Expected no error from the second run")
+
+	source, err := repo.GetOccurrence(taskID)
+	assert.NoError(t, err, "Expected no error from GetOccurrence")
+	assert.Empty(t, source.Task.Recurrence, "Expected the rule to move to the next occurrence")
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM tasks WHERE series_id = ?", source.SeriesId).Scan(&count)
+	assert.NoError(t, err, "Expected no error counting the series")
+	assert.Equal(t, 2, count, "Expected exactly one new occurrence")
+
+	var nextAt time.Time
+	err = db.QueryRow("SELECT occurrence_at FROM tasks WHERE series_id = ? AND id <> ?", source.SeriesId, taskID).Scan(&nextAt)
+	assert.NoError(t, err, "Expected no error reading the next occurrence")
+	assert.Equal(t, dueAt.AddDate(0, 0, 7), nextAt.UTC(), "Expected the next occurrence a week later")
+
+	// A previously materialized occurrence is not created again
+	createdID, err := repo.CreateOccurrence(source, nextAt)
+	assert.NoError(t, err, "Expected no error from CreateOccurrence")
+	assert.Zero(t, createdID, "Expected the existing occurrence to be kept")
+}
+
+func TestTaskHistory(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	taskID, err := repo.CreateTask(models.Task{Title: "Audited Task", Description: "Before", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	_, err = repo.UpdateTask(models.Task{Id: taskID, Title: "Audited Task", Description: "After", UserId: 1}, models.StatusTodo)
+	assert.NoError(t, err, "Expected no error from UpdateTask")
+
+	_, err = repo.TransitionTask(taskID, 1, models.StatusTodo, models.StatusInProgress)
+	assert.NoError(t, err, "Expected no error from TransitionTask")
+
+	events, err := repo.GetTaskHistory(taskID, 1)
+	assert.NoError(t, err, "Expected no error from GetTaskHistory")
+	assert.Len(t, events, 3, "Expected create, update and transition events")
+	assert.Equal(t, models.EventCreated, events[0].Action, "Expected the first event to be the creation")
+	assert.Equal(t, []models.FieldChange{{Field: "description", From: "Before", To: "After"}}, events[1].Changes, "Expected only the description to change")
+	assert.Equal(t, []models.FieldChange{{Field: "status", From: models.StatusTodo, To: models.StatusInProgress}}, events[2].Changes, "Expected only the status to change")
+	assert.Equal(t, int64(1), events[2].UserId, "Expected the user who made the change")
+
+	// Other users cannot read the history
+	_, err = repo.GetTaskHistory(taskID, 2)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for another user's task")
+
+	// Deleting the task keeps its history
+	err = repo.DeleteTask(taskID, 1, false)
+	assert.NoError(t, err, "Expected no error from DeleteTask")
+	var action string
+	err = db.QueryRow("SELECT action FROM task_events WHERE task_id = ? ORDER BY id DESC LIMIT 1", taskID).Scan(&action)
+	assert.NoError(t, err, "Expected the deletion to be recorded")
+	assert.Equal(t, models.EventDeleted, action, "Expected the last event to be the deletion")
+}
+
+func TestTrash(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	rootID, err := repo.CreateTask(models.Task{Title: "Trashed Task", Description: "Deleted by mistake", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+	childID, err := repo.CreateTask(models.Task{Title: "Trashed Subtask", Description: "Deleted with its parent", UserId: 1, ParentId: rootID})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	err = repo.DeleteTask(rootID, 1, true)
+	assert.NoError(t, err, "Expected no error from DeleteTask")
+
+	// Trashed tasks are hidden everywhere but the trash
+	_, err = repo.GetTaskByID(rootID, 1)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected the trashed task to be hidden")
+	trash, err := repo.ListTrash(1)
+	assert.NoError(t, err, "Expected no error from ListTrash")
+	var trashedIDs []int64
+	for _, task := range trash {
+		trashedIDs = append(trashedIDs, task.Id)
+	}
+	assert.Contains(t, trashedIDs, rootID, "Expected the task in the trash")
+	assert.Contains(t, trashedIDs, childID, "Expected the subtask in the trash")
+
+	// Other users can neither see nor restore the task
+	_, err = repo.RestoreTask(rootID, 2)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for another user's task")
+
+	restored, err := repo.RestoreTask(rootID, 1)
+	assert.NoError(t, err, "Expected no error from RestoreTask")
+	assert.Nil(t, restored.DeletedAt, "Expected the task out of the trash")
+	child, err := repo.GetTaskByID(childID, 1)
+	assert.NoError(t, err, "Expected the subtask to be restored with its parent")
+	assert.Equal(t, rootID, child.ParentId, "Expected the subtask under its parent")
+
+	// Only tasks in the trash can be purged
+	err = repo.PurgeTask(rootID, 1)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for a live task")
+
+	err = repo.DeleteTask(rootID, 1, true)
+	assert.NoError(t, err, "Expected no error from DeleteTask")
+	err = repo.PurgeTask(rootID, 1)
+	assert.NoError(t, err, "Expected no error from PurgeTask")
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM tasks WHERE id IN (?, ?)", rootID, childID).Scan(&count)
+	assert.NoError(t, err, "Expected no error when querying the tasks from the database")
+	assert.Equal(t, 0, count, "Expected the tasks to be purged")
+
+	// The retention job purges tasks that stayed in the trash too long
+	expiredID, err := repo.CreateTask(models.Task{Title: "Expired Task", Description: "Forgotten in the trash", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+	err = repo.DeleteTask(expiredID, 1, false)
+	assert.NoError(t, err, "Expected no error from DeleteTask")
+
+	cleaner := task.NewTrashCleaner(repo, 24*time.Hour)
+	assert.NoError(t, cleaner.RunOnce(time.Now().UTC().Add(48*time.Hour)), "Expected no error from the trash cleaner")
+	err = db.QueryRow("SELECT COUNT(*) FROM tasks WHERE id = ?", expiredID).Scan(&count)
+	assert.NoError(t, err, "Expected no error when querying the task from the database")
+	assert.Equal(t, 0, count, "Expected the expired task to be purged")
+}
+
+func TestSearchTasks(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	word := fmt.Sprintf("zebrafish%d", time.Now().UnixNano())
+	titleID, err := repo.CreateTask(models.Task{Title: "Feed the " + word, Description: "Twice a day", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+	commentID, err := repo.CreateTask(models.Task{Title: "Clean the aquarium", Description: "Use <soft> brushes", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+	_, err = repo.AddComment(commentID, 1, "Mind the "+word+" while cleaning")
+	assert.NoError(t, err, "Expected no error from AddComment")
+
+	// Prefixes of the words match, title matches rank first
+	results, nextPageToken, err := repo.SearchTasks(1, word[:len(word)-3], 0, "")
+	assert.NoError(t, err, "Expected no error from SearchTasks")
+	assert.Empty(t, nextPageToken, "Expected a single page")
+	if assert.Len(t, results, 2, "Expected the task matching by title and the task matching by comment") {
+		assert.Equal(t, titleID, results[0].Task.Id, "Expected the title match first")
+		assert.Equal(t, "title", results[0].Highlights[0].Field, "Expected the title highlighted")
+		assert.Equal(t, "Feed the <mark>"+word+"</mark>", results[0].Highlights[0].Snippet, "Expected the match marked")
+		assert.Equal(t, commentID, results[1].Task.Id, "Expected the comment match second")
+		assert.Equal(t, "comment", results[1].Highlights[0].Field, "Expected the comment highlighted")
+	}
+
+	// Results are paged by score and id
+	results, nextPageToken, err = repo.SearchTasks(1, word, 1, "")
+	assert.NoError(t, err, "Expected no error from SearchTasks with page size")
+	assert.NotEmpty(t, nextPageToken, "Expected a next page token")
+	if assert.Len(t, results, 1, "Expected one result on the first page") {
+		assert.Equal(t, titleID, results[0].Task.Id, "Expected the title match on the first page")
+	}
+	results, nextPageToken, err = repo.SearchTasks(1, word, 1, nextPageToken)
+	assert.NoError(t, err, "Expected no error from SearchTasks with page token")
+	assert.Empty(t, nextPageToken, "Expected no next page")
+	if assert.Len(t, results, 1, "Expected one result on the second page") {
+		assert.Equal(t, commentID, results[0].Task.Id, "Expected the comment match on the second page")
+	}
+
+	// Other users see nothing of the tasks
+	results, _, err = repo.SearchTasks(2, word, 0, "")
+	assert.NoError(t, err, "Expected no error from SearchTasks")
+	assert.Empty(t, results, "Expected no results for another user")
+
+	_, _, err = repo.SearchTasks(1, "  *** ", 0, "")
+	assert.ErrorIs(t, err, repository.ErrInvalidFilter, "Expected ErrInvalidFilter for a query without words")
+}
+
+func TestBatchTasks(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	// A task that cannot be created does not stop the others
+	created, err := repo.BatchCreateTasks([]models.Task{
+		{Title: "Batch Task 1", Description: "First", UserId: 1},
+		{Title: "Batch Task 2", Description: "Under a missing parent", UserId: 1, ParentId: -1},
+		{Title: "Batch Task 3", Description: "Third", UserId: 1},
+	})
+	assert.NoError(t, err, "Expected no error from BatchCreateTasks")
+	if !assert.Len(t, created, 3, "Expected a result per task") {
+		return
+	}
+	assert.NoError(t, created[0].Err, "Expected the first task to be created")
+	assert.ErrorIs(t, created[1].Err, repository.ErrInvalidParent, "Expected ErrInvalidParent for the second task")
+	assert.NoError(t, created[2].Err, "Expected the third task to be created")
+	assert.Equal(t, "Batch Task 1", created[0].Task.Title, "Expected the created task in the result")
+	firstID, thirdID := created[0].Task.Id, created[2].Task.Id
+
+	updated, err := repo.BatchUpdateTasks(1, []models.Task{
+		{Id: firstID, Title: "Batch Task 1 Updated", Description: "First", Status: models.StatusInProgress},
+		{Id: thirdID, Title: "Batch Task 3 Updated", Description: "Third", Status: models.StatusInProgress},
+	}, []string{models.StatusTodo, models.StatusTodo})
+	assert.NoError(t, err, "Expected no error from BatchUpdateTasks")
+	for _, result := range updated {
+		assert.NoError(t, result.Err, "Expected the task to be updated")
+		assert.Equal(t, models.StatusInProgress, result.Task.Status, "Expected the updated status")
+	}
+
+	// A status read before a concurrent transition fails that task alone
+	updated, err = repo.BatchUpdateTasks(1, []models.Task{
+		{Id: firstID, Title: "Batch Task 1 Updated", Description: "First", Status: models.StatusDone},
+		{Id: thirdID, Title: "Batch Task 3 Renamed", Description: "Third", Status: models.StatusInProgress},
+	}, []string{models.StatusTodo, models.StatusInProgress})
+	assert.NoError(t, err, "Expected no error from BatchUpdateTasks")
+	assert.ErrorIs(t, updated[0].Err, repository.ErrStatusChanged, "Expected ErrStatusChanged for a stale status")
+	assert.NoError(t, updated[1].Err, "Expected the other task to be updated")
+	assert.Equal(t, "Batch Task 3 Renamed", updated[1].Task.Title, "Expected the updated title")
+
+	// Other users cannot update the tasks
+	updated, err = repo.BatchUpdateTasks(2, []models.Task{{Id: firstID, Title: "Stolen", Description: "First"}}, []string{models.StatusInProgress})
+	assert.NoError(t, err, "Expected no error from BatchUpdateTasks")
+	assert.ErrorIs(t, updated[0].Err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for another user's task")
+
+	deleted, err := repo.BatchDeleteTasks(1, []int64{firstID, -1, thirdID}, false)
+	assert.NoError(t, err, "Expected no error from BatchDeleteTasks")
+	assert.NoError(t, deleted[0].Err, "Expected the first task to be deleted")
+	assert.ErrorIs(t, deleted[1].Err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for a missing task")
+	assert.NoError(t, deleted[2].Err, "Expected the third task to be deleted")
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM tasks WHERE id IN (?, ?) AND deleted_at IS NULL", firstID, thirdID).Scan(&count)
+	assert.NoError(t, err, "Expected no error when querying the tasks from the database")
+	assert.Equal(t, 0, count, "Expected the tasks in the trash")
+}
+
+func TestPatchTask(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	taskID, err := repo.CreateTask(models.Task{Title: "Patched Task", Description: "Original description", UserId: 1, Priority: models.PriorityHigh})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	// A concurrent edit of the title is kept by a status-only patch
+	_, err = db.Exec("UPDATE tasks SET title = ? WHERE id = ?", "Edited Elsewhere", taskID)
+	assert.NoError(t, err, "Expected no error when editing the task in the database")
+
+	task, err := repo.PatchTask(models.Task{Id: taskID, UserId: 1, Status: models.StatusInProgress}, []string{"status"}, models.StatusTodo)
+	assert.NoError(t, err, "Expected no error from PatchTask")
+	assert.Equal(t, models.StatusInProgress, task.Status, "Expected the status to change")
+	assert.Equal(t, "Edited Elsewhere", task.Title, "Expected the title to be kept")
+	assert.Equal(t, "Original description", task.Description, "Expected the description to be kept")
+	assert.Equal(t, models.PriorityHigh, task.Priority, "Expected the priority to be kept")
+
+	// The status is changed only from the expected one
+	_, err = repo.PatchTask(models.Task{Id: taskID, UserId: 1, Status: models.StatusDone}, []string{"status"}, models.StatusTodo)
+	assert.ErrorIs(t, err, repository.ErrStatusChanged, "Expected ErrStatusChanged for a stale status")
+
+	// Other users cannot patch the task
+	_, err = repo.PatchTask(models.Task{Id: taskID, UserId: 2, Title: "Stolen"}, []string{"title"}, models.StatusInProgress)
+	assert.ErrorIs(t, err, repository.ErrTaskNotFound, "Expected ErrTaskNotFound for another user's task")
+
+	// The assignee may patch the status but nothing else
+	_, err = repo.AssignTask(taskID, 1, 2)
+	assert.NoError(t, err, "Expected no error from AssignTask")
+	task, err = repo.PatchTask(models.Task{Id: taskID, UserId: 2, Status: models.StatusDone}, []string{"status"}, models.StatusInProgress)
+	assert.NoError(t, err, "Expected the assignee to patch the status")
+	assert.Equal(t, models.StatusDone, task.Status, "Expected the status to change")
+	_, err = repo.PatchTask(models.Task{Id: taskID, UserId: 2, Title: "Renamed", Status: models.StatusTodo}, []string{"title", "status"}, models.StatusDone)
+	assert.ErrorIs(t, err, repository.ErrForbidden, "Expected ErrForbidden for the assignee changing the title")
+}
+
+func TestTaskVersions(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	taskID, err := repo.CreateTask(models.Task{Title: "Versioned Task", Description: "Version 1", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+	task, err := repo.GetTaskByID(taskID, 1)
+	assert.NoError(t, err, "Expected no error from GetTaskByID")
+	assert.Equal(t, int64(1), task.Version, "Expected a new task at version 1")
+
+	// Every change bumps the version
+	task, err = repo.UpdateTask(models.Task{Id: taskID, Title: "Versioned Task", Description: "Version 2", UserId: 1, Version: 1}, models.StatusTodo)
+	assert.NoError(t, err, "Expected no error from UpdateTask")
+	assert.Equal(t, int64(2), task.Version, "Expected the version to grow")
+	task, err = repo.TransitionTask(taskID, 1, models.StatusTodo, models.StatusInProgress)
+	assert.NoError(t, err, "Expected no error from TransitionTask")
+	assert.Equal(t, int64(3), task.Version, "Expected the version to grow")
+
+	// A stale version does not overwrite the newer changes
+	_, err = repo.UpdateTask(models.Task{Id: taskID, Title: "Versioned Task", Description: "Stale", UserId: 1, Version: 2}, models.StatusInProgress)
+	assert.ErrorIs(t, err, repository.ErrVersionMismatch, "Expected ErrVersionMismatch for a stale version")
+	_, err = repo.PatchTask(models.Task{Id: taskID, UserId: 1, Title: "Stale", Version: 2}, []string{"title"}, models.StatusInProgress)
+	assert.ErrorIs(t, err, repository.ErrVersionMismatch, "Expected ErrVersionMismatch for a stale version")
+	err = repo.DeleteTaskIfVersion(taskID, 1, false, 2)
+	assert.ErrorIs(t, err, repository.ErrVersionMismatch, "Expected ErrVersionMismatch for a stale version")
+
+	task, err = repo.GetTaskByID(taskID, 1)
+	assert.NoError(t, err, "Expected no error from GetTaskByID")
+	assert.Equal(t, "Version 2", task.Description, "Expected the task unchanged by stale writes")
+
+	// A patch that changes nothing keeps the version
+	task, err = repo.PatchTask(models.Task{Id: taskID, UserId: 1, Title: "Versioned Task", Version: 3}, []string{"title"}, models.StatusInProgress)
+	assert.NoError(t, err, "Expected no error from PatchTask")
+	assert.Equal(t, int64(3), task.Version, "Expected a no-op patch to keep the version")
+
+	err = repo.DeleteTaskIfVersion(taskID, 1, false, 3)
+	assert.NoError(t, err, "Expected no error from DeleteTaskIfVersion")
+}
+
+func TestImportExportTasks(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	tasks := []models.Task{
+		{Title: "Imported Task 1", Description: "Done in the old tracker", Status: models.StatusDone, Priority: models.PriorityHigh, Tags: []string{"imported"}},
+		{Title: "Imported Task 2", Description: "In a missing project", ProjectId: -1},
+	}
+
+	// A dry run reports the results but saves nothing
+	results, err := repo.ImportTasks(1, tasks, true)
+	assert.NoError(t, err, "Expected no error from a dry run of ImportTasks")
+	if !assert.Len(t, results, 2, "Expected a result per task") {
+		return
+	}
+	assert.NoError(t, results[0].Err, "Expected the first task to be importable")
+	assert.Zero(t, results[0].Task.Id, "Expected no id for a task of a dry run")
+	assert.ErrorIs(t, results[1].Err, repository.ErrInvalidProject, "Expected ErrInvalidProject for the second task")
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM tasks WHERE title = ?", "Imported Task 1").Scan(&count)
+	assert.NoError(t, err, "Expected no error when querying the tasks from the database")
+	assert.Equal(t, 0, count, "Expected a dry run to save nothing")
+
+	results, err = repo.ImportTasks(1, tasks, false)
+	assert.NoError(t, err, "Expected no error from ImportTasks")
+	assert.NoError(t, results[0].Err, "Expected the first task to be imported")
+	assert.Error(t, results[1].Err, "Expected the second task to fail")
+	imported := results[0].Task
+	assert.NotZero(t, imported.Id, "Expected the imported task to have an id")
+	assert.Equal(t, models.StatusDone, imported.Status, "Expected the imported task to keep its status")
+	assert.Equal(t, []string{"imported"}, imported.Tags, "Expected the imported task to have its tags")
+
+	// The export streams the imported task with its tags
+	var exported []models.Task
+	err = repo.ExportTasks(1, func(task models.Task) error {
+		exported = append(exported, task)
+		return nil
+	})
+	assert.NoError(t, err, "Expected no error from ExportTasks")
+	found := false
+	for i, task := range exported {
+		if i > 0 {
+			assert.Greater(t, task.Id, exported[i-1].Id, "Expected the tasks oldest first")
+		}
+		if task.Id == imported.Id {
+			found = true
+			assert.Equal(t, imported.Title, task.Title, "Expected the exported task title")
+			assert.Equal(t, imported.Tags, task.Tags, "Expected the exported task tags")
+		}
+	}
+	assert.True(t, found, "Expected the imported task in the export")
+}
+
+func TestWatchTasks(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	watch, err := repo.WatchTasks(ctx, 1)
+	if !assert.NoError(t, err, "Expected no error from WatchTasks") {
+		return
+	}
+	defer watch.Close()
+
+	taskID, err := repo.CreateTask(models.Task{Title: "Watched Task", Description: "Changes are pushed", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+	change, err := watch.Next(ctx)
+	assert.NoError(t, err, "Expected a change after CreateTask")
+	assert.Equal(t, models.TaskChange{Action: models.EventCreated, TaskId: taskID}, change, "Expected the task to be created")
+
+	_, err = repo.UpdateTask(models.Task{Id: taskID, Title: "Watched Task Updated", Description: "Changes are pushed", Status: models.StatusTodo, UserId: 1}, models.StatusTodo)
+	assert.NoError(t, err, "Expected no error from UpdateTask")
+	change, err = watch.Next(ctx)
+	assert.NoError(t, err, "Expected a change after UpdateTask")
+	assert.Equal(t, models.TaskChange{Action: models.EventUpdated, TaskId: taskID}, change, "Expected the task to be updated")
+
+	err = repo.DeleteTask(taskID, 1, false)
+	assert.NoError(t, err, "Expected no error from DeleteTask")
+	change, err = watch.Next(ctx)
+	assert.NoError(t, err, "Expected a change after DeleteTask")
+	assert.Equal(t, models.TaskChange{Action: models.EventDeleted, TaskId: taskID}, change, "Expected the task to be deleted")
+
+	// Other users are not told about the task
+	otherWatch, err := repo.WatchTasks(ctx, 2)
+	if !assert.NoError(t, err, "Expected no error from WatchTasks") {
+		return
+	}
+	defer otherWatch.Close()
+	_, err = repo.RestoreTask(taskID, 1)
+	assert.NoError(t, err, "Expected no error from RestoreTask")
+	change, err = watch.Next(ctx)
+	assert.NoError(t, err, "Expected a change after RestoreTask")
+	assert.Equal(t, models.EventCreated, change.Action, "Expected the restored task to reappear as created")
+
+	otherCtx, otherCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer otherCancel()
+	_, err = otherWatch.Next(otherCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "Expected no change for another user")
+}
+
+func TestWebhooks(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Create the repository
+	repo := repository.NewRepository(db, rdb)
+	// The receivers run on the loopback interface, which only listed hosts may use
+	dispatcher := task.NewWebhookDispatcher(repo, time.Second, task.NewWebhookTargets([]string{"127.0.0.1"}))
+	ctx := context.Background()
+
+	// The receiver checks the signature of every delivery
+	payloads := make(chan models.WebhookPayload, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(task.WebhookTimestampHeader), 10, 64)
+		if r.Header.Get(task.WebhookSignatureHeader) != task.SignWebhook("receiver-secret", timestamp, body) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var payload models.WebhookPayload
+		json.Unmarshal(body, &payload)
+		payloads <- payload
+	}))
+	defer receiver.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	webhook, err := repo.CreateWebhook(models.Webhook{UserId: 1, Url: receiver.URL, Secret: "receiver-secret", Events: []string{models.EventCreated}})
+	if !assert.NoError(t, err, "Expected no error from CreateWebhook") {
+		return
+	}
+	defer repo.DeleteWebhook(webhook.Id, 1)
+	assert.Equal(t, []string{models.EventCreated}, webhook.Events, "Expected the webhook to keep its events")
+
+	broken, err := repo.CreateWebhook(models.Webhook{UserId: 1, Url: failing.URL, Secret: "failing-secret"})
+	if !assert.NoError(t, err, "Expected no error from CreateWebhook") {
+		return
+	}
+	defer repo.DeleteWebhook(broken.Id, 1)
+
+	_, err = repo.CreateWebhook(models.Webhook{UserId: 1, ProjectId: -1, Url: receiver.URL, Secret: "receiver-secret"})
+	assert.ErrorIs(t, err, repository.ErrInvalidProject, "Expected a project webhook to need a project of the user")
+
+	taskID, err := repo.CreateTask(models.Task{Title: "Hooked Task", Description: "Events are delivered", UserId: 1})
+	assert.NoError(t, err, "Expected no error from CreateTask")
+
+	now := time.Now().UTC()
+	assert.NoError(t, dispatcher.RunOnce(ctx, now), "Expected no error from RunOnce")
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, "task."+models.EventCreated, payload.Event, "Expected a created event")
+		assert.Equal(t, taskID, payload.TaskId, "Expected the event of the task")
+		assert.Equal(t, "Hooked Task", payload.Task.Title, "Expected the task in the payload")
+	default:
+		t.Error("Expected the receiver to get the created event")
+	}
+
+	// Updates are not among the events of the receiver, the broken webhook gets every attempt
+	_, err = repo.UpdateTask(models.Task{Id: taskID, Title: "Hooked Task Updated", Description: "Events are delivered", Status: models.StatusTodo, UserId: 1}, models.StatusTodo)
+	assert.NoError(t, err, "Expected no error from UpdateTask")
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, dispatcher.RunOnce(ctx, now.Add(time.Duration(i)*3*time.Hour)), "Expected no error from RunOnce")
+	}
+	assert.Empty(t, payloads, "Expected no update event for the receiver")
+
+	dead, err := repo.ListDeadDeliveries(broken.Id, 1)
+	assert.NoError(t, err, "Expected no error from ListDeadDeliveries")
+	if assert.Len(t, dead, 2, "Expected both deliveries of the broken webhook to be dead") {
+		assert.Equal(t, models.EventUpdated, dead[0].Action, "Expected the newest delivery first")
+		assert.Equal(t, int32(8), dead[0].Attempts, "Expected every attempt to be made")
+		assert.Contains(t, dead[0].LastError, "503", "Expected the last error to be kept")
+	}
+
+	_, err = repo.ListDeadDeliveries(broken.Id, 2)
+	assert.ErrorIs(t, err, repository.ErrWebhookNotFound, "Expected another user not to see the webhook")
+
+	if len(dead) > 0 {
+		delivery, err := repo.RedeliverWebhook(broken.Id, dead[0].Id, 1)
+		assert.NoError(t, err, "Expected no error from RedeliverWebhook")
+		assert.Equal(t, models.DeliveryPending, delivery.Status, "Expected the delivery to be queued again")
+		assert.Zero(t, delivery.Attempts, "Expected the attempts to start over")
+
+		_, err = repo.RedeliverWebhook(broken.Id, dead[0].Id, 1)
+		assert.ErrorIs(t, err, repository.ErrDeliveryNotFound, "Expected a queued delivery not to be dead")
+	}
+}
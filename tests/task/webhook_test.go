@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/damirbeybitov/todo_project/internal/task/repository"
+	task "github.com/damirbeybitov/todo_project/internal/task/service"
+	taskPB "github.com/damirbeybitov/todo_project/proto/task"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWebhookValidation(t *testing.T) {
+	// Setup the database connection
+	dsn := "root:root@tcp(localhost:3306)/to_do?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err, "Failed to connect to the database")
+	defer db.Close()
+
+	// Setup the Redis connection
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	service := task.NewTaskService(repository.NewRepository(db, rdb), task.DefaultWorkflow, task.NewWebhookTargets([]string{"receiver.internal"}))
+
+	for _, webhook := range []*taskPB.Webhook{
+		{Url: "https://example.com/hook", Events: []taskPB.TaskEventAction{taskPB.TaskEventAction_TASK_EVENT_ACTION_UNSPECIFIED}},
+		{Url: "https://example.com/hook", Events: []taskPB.TaskEventAction{99}},
+		{Url: "http://127.0.0.1:8080/hook"},
+		{Url: "http://localhost/hook"},
+		{Url: "http://10.0.0.5/hook"},
+		{Url: "http://169.254.169.254/latest/meta-data"},
+		{Url: "http://[::1]/hook"},
+		{Url: "http://0.0.0.0/hook"},
+	} {
+		_, err := service.CreateWebhook(context.Background(), &taskPB.CreateWebhookRequest{UserId: 1, Webhook: webhook})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "Expected InvalidArgument for %s %v", webhook.Url, webhook.Events)
+	}
+
+	// Only the listed internal hosts are accepted, with known events
+	_, err = service.UpdateWebhook(context.Background(), &taskPB.UpdateWebhookRequest{UserId: 1, Webhook: &taskPB.Webhook{
+		Id: -1, Url: "http://receiver.internal/hook", Events: []taskPB.TaskEventAction{taskPB.TaskEventAction_TASK_EVENT_ACTION_CREATED, taskPB.TaskEventAction_TASK_EVENT_ACTION_PURGED},
+	}})
+	assert.NotEqual(t, codes.InvalidArgument, status.Code(err), "Expected the listed host and known events to be accepted")
+}
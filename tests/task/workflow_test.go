@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/damirbeybitov/todo_project/internal/models"
+	task "github.com/damirbeybitov/todo_project/internal/task/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultWorkflow(t *testing.T) {
+	workflow, err := task.NewWorkflow(nil)
+	assert.NoError(t, err, "Expected no error for an empty transitions table")
+
+	assert.True(t, workflow.CanTransition(models.StatusTodo, models.StatusInProgress), "Expected todo -> in_progress to be allowed")
+	assert.True(t, workflow.CanTransition(models.StatusDone, models.StatusDone), "Expected keeping the status to be allowed")
+	assert.False(t, workflow.CanTransition(models.StatusDone, models.StatusInProgress), "Expected done -> in_progress to be rejected")
+	assert.False(t, workflow.CanTransition(models.StatusCancelled, models.StatusDone), "Expected cancelled -> done to be rejected")
+}
+
+func TestConfiguredWorkflow(t *testing.T) {
+	workflow, err := task.NewWorkflow(map[string][]string{
+		models.StatusTodo: {models.StatusDone},
+	})
+	assert.NoError(t, err, "Expected no error for a valid transitions table")
+	assert.True(t, workflow.CanTransition(models.StatusTodo, models.StatusDone), "Expected todo -> done to be allowed")
+	assert.False(t, workflow.CanTransition(models.StatusTodo, models.StatusInProgress), "Expected todo -> in_progress to be rejected")
+	assert.False(t, workflow.CanTransition(models.StatusDone, models.StatusTodo), "Expected done to be final")
+
+	_, err = task.NewWorkflow(map[string][]string{
+		models.StatusTodo: {"archived"},
+	})
+	assert.Error(t, err, "Expected an error for an unknown status")
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 
 	"testing"
 
 	"github.com/damirbeybitov/todo_project/internal/log"
 	"github.com/damirbeybitov/todo_project/internal/user/repository"
 	_ "github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func setupTestDB(t *testing.T) *sql.DB {
@@ -169,3 +171,72 @@ func TestDeleteuserFromDB(t *testing.T) {
     }
 }
 
+func TestAdminUsers(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    r := &repository.Repository{DB: db}
+
+    // Add a user for testing
+    tx, err := db.Begin()
+    if err != nil {
+        t.Fatalf("Error beginning transaction: %v", err)
+    }
+    id, err := r.AddUserToDB(tx, "admin_managed_user", "admin_managed@example.com", "password")
+    if err != nil {
+        t.Fatalf("Error adding user to test database: %v", err)
+    }
+    if err := tx.Commit(); err != nil {
+        t.Fatalf("Error committing transaction: %v", err)
+    }
+    defer db.Exec("DELETE FROM users WHERE id = ?", id)
+
+    // Users are listed page by page
+    users, nextPageToken, err := r.ListUsers(1, "")
+    if err != nil {
+        t.Fatalf("ListUsers returned an error: %v", err)
+    }
+    if len(users) != 1 {
+        t.Errorf("Expected one user on the page, got %d", len(users))
+    }
+    if nextPageToken != "" {
+        nextUsers, _, err := r.ListUsers(1, nextPageToken)
+        if err != nil {
+            t.Errorf("ListUsers returned an error for the next page: %v", err)
+        } else if len(nextUsers) == 1 && len(users) == 1 && nextUsers[0].Id <= users[0].Id {
+            t.Errorf("Expected the next page to start after user %d, got user %d", users[0].Id, nextUsers[0].Id)
+        }
+    }
+    if _, _, err := r.ListUsers(1, "not a token"); !errors.Is(err, repository.ErrInvalidPageToken) {
+        t.Errorf("Expected ErrInvalidPageToken for a malformed token, got: %v", err)
+    }
+
+    // Disabling a user is seen in the list
+    username, err := r.SetUserDisabled(id, true)
+    if err != nil {
+        t.Fatalf("SetUserDisabled returned an error: %v", err)
+    }
+    if username != "admin_managed_user" {
+        t.Errorf("Expected the username of the disabled user, got %q", username)
+    }
+    var disabled bool
+    if err := db.QueryRow("SELECT disabled FROM users WHERE id = ?", id).Scan(&disabled); err != nil || !disabled {
+        t.Errorf("Expected the user to be disabled, got %t: %v", disabled, err)
+    }
+
+    // A reset password replaces the old one
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte("new_password"), bcrypt.DefaultCost)
+    if err != nil {
+        t.Fatalf("Error hashing password: %v", err)
+    }
+    if _, err := r.ResetPassword(id, string(hashedPassword)); err != nil {
+        t.Fatalf("ResetPassword returned an error: %v", err)
+    }
+    if err := r.CheckPassword("admin_managed_user", "new_password"); err != nil {
+        t.Errorf("Expected the new password to be accepted, got: %v", err)
+    }
+
+    if _, err := r.SetUserDisabled(-1, true); !errors.Is(err, repository.ErrUserNotFound) {
+        t.Errorf("Expected ErrUserNotFound for an unknown user, got: %v", err)
+    }
+}